@@ -3,18 +3,27 @@ package main
 import (
 	"context"
 	"fmt"
-	jira "github.com/andygrunwald/go-jira"
 	"github.com/davecgh/go-spew/spew"
+	"github.com/mfojtik/shodan/pkg/command"
 	"github.com/mfojtik/shodan/pkg/config"
+	"github.com/mfojtik/shodan/pkg/digest"
+	"github.com/mfojtik/shodan/pkg/identity"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/policy"
+	"github.com/mfojtik/shodan/pkg/remotelink"
+	"github.com/mfojtik/shodan/pkg/store"
+	"github.com/mfojtik/shodan/pkg/subscription"
+	"github.com/mfojtik/shodan/pkg/threadsync"
+	"github.com/mfojtik/shodan/pkg/triage"
+	"github.com/mfojtik/shodan/pkg/unfurl"
+	"github.com/mfojtik/shodan/pkg/webhook"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 	"github.com/slack-go/slack/socketmode"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
 	"os/signal"
-	"strings"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -41,60 +50,6 @@ func setupShutdownSignalHandling(shutdown context.CancelFunc) {
 	}
 }
 
-func handleJiraLinks(jiraClient *jira.Client, slackClient *slack.Client, ev *slackevents.LinkSharedEvent) error {
-	unfurls := map[string]slack.Attachment{}
-	for _, l := range ev.Links {
-		// example: https://issues.redhat.com/browse/API-1299
-		u, err := url.Parse(l.URL)
-		if err != nil {
-			log.Printf("failed to parse jira url %q: %v", l, u)
-		}
-
-		if u.Host != "issues.redhat.com" {
-			continue
-		}
-
-		comps := strings.Split(strings.TrimLeft(u.Path, "/"), "/")
-		if len(comps) != 2 || comps[0] != "browse" {
-			continue
-		}
-		id := comps[1]
-		if len(id) == 0 {
-			continue
-		}
-
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-		defer cancel()
-		issue, _, err := jiraClient.Issue.GetWithContext(ctx, id, nil)
-		if err != nil {
-			log.Printf("failed to get %s: %v", u.String(), err)
-			continue
-		}
-
-		emoji := ""
-		switch issue.Fields.Type.Name {
-		case "Bug":
-			emoji = ":bugzilla:"
-		case "Epic":
-			emoji = ":epic-win:"
-		default:
-			emoji = ":jira-dumpster-fire:"
-		}
-
-		text := fmt.Sprintf("%s <https://issues.redhat.com/browse/%s|#%s> %s – by %s", emoji, id, id, issue.Fields.Summary, issue.Fields.Reporter.Name)
-		unfurls[l.URL] = slack.Attachment{
-			Blocks: slack.Blocks{[]slack.Block{
-				slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", text, false, false), nil, nil),
-			}},
-		}
-	}
-	if len(unfurls) == 0 {
-		return nil
-	}
-	_, _, _, err := slackClient.UnfurlMessage(ev.Channel, ev.MessageTimeStamp, unfurls)
-	return err
-}
-
 func main() {
 	api := slack.New(
 		cfg.Slack.BotToken,
@@ -108,14 +63,71 @@ func main() {
 		socketmode.OptionLog(log.New(os.Stdout, "socketmode: ", log.Lshortfile|log.LstdFlags)),
 	)
 
-	tp := jira.PATAuthTransport{Token: os.Getenv("JIRA_TOKEN")}
-	jiraClient, err := jira.NewClient(tp.Client(), "https://issues.redhat.com/")
+	jiraInstances, err := jiraclient.NewInstances(cfg.Jira)
 	if err != nil {
 		log.Fatalf("ERROR: jira client failed: %v", err)
 	}
 
+	state, err := store.Open(cfg.StateFile)
+	if err != nil {
+		log.Fatalf("ERROR: failed to open state: %v", err)
+	}
+	if err := store.Migrate(state, migrations); err != nil {
+		log.Fatalf("ERROR: failed to migrate state: %v", err)
+	}
+	identities := identity.NewResolver(api, state)
+	visibility := policy.New(cfg.PolicyRules)
+	unfurler := unfurl.New(jiraInstances, api, visibility, identities, cfg.Unfurl, cfg.Cache)
+	remoteLinker := remotelink.New(jiraInstances, api, visibility, state, cfg.RemoteLinks)
+	unfurler.OnShared(remoteLinker.HandleShared)
+	tracker := unfurl.NewTracker(unfurler, state)
+	unfurler.OnShared(tracker.HandleShared)
+
+	botIdentity, err := api.AuthTest()
+	if err != nil {
+		log.Fatalf("ERROR: slack auth failed: %v", err)
+	}
+	messageListener := unfurl.NewMessageListener(unfurler, state, botIdentity.UserID, cfg.IssueKeyChannels)
+	syncer := threadsync.New(jiraInstances, api, identities, visibility, state, botIdentity.UserID)
+	subscriptions := subscription.NewStore(state)
+	digests := digest.NewScheduler(jiraInstances, api, unfurler, state)
+
+	commands := command.NewRouter("/shodan",
+		&command.IssueCommand{Instances: jiraInstances, Unfurler: unfurler},
+		&command.SearchCommand{Instances: jiraInstances, Unfurler: unfurler},
+		&command.AssignCommand{Instances: jiraInstances, Unfurler: unfurler, Identities: identities},
+		&command.MineCommand{Instances: jiraInstances, Identities: identities},
+		&command.LinkAccountCommand{Instances: jiraInstances, Identities: identities},
+		&command.SyncCommand{Instances: jiraInstances, Syncer: syncer},
+		&command.SubscribeCommand{Instances: jiraInstances, Subscriptions: subscriptions},
+		&command.IssueKeysCommand{Listener: messageListener},
+		&command.DigestCommand{Instances: jiraInstances, Scheduler: digests},
+	)
+	issueActions := &command.IssueActions{Instances: jiraInstances, Unfurler: unfurler, Identities: identities, SlackClient: api}
+	commands.RegisterActions(issueActions)
+	commands.RegisterViews(issueActions)
+	createIssue := &command.CreateIssueShortcut{Instances: jiraInstances, Identities: identities, SlackClient: api}
+	commands.RegisterShortcuts(createIssue)
+	commands.RegisterActions(createIssue)
+	commands.RegisterViews(createIssue)
+	triager := triage.New(jiraInstances, api, unfurler, identities, state, cfg.Triage)
+	commands.RegisterActions(&command.TriageActions{Instances: jiraInstances, Triager: triager, SlackClient: api})
+	reactionActions := &command.ReactionActions{
+		Instances:   jiraInstances,
+		Unfurler:    unfurler,
+		Identities:  identities,
+		SlackClient: api,
+		Store:       state,
+		Actions:     cfg.ReactionActions,
+	}
+
 	botContext, shutdown := context.WithCancel(context.Background())
 	go setupShutdownSignalHandling(shutdown)
+	go digests.Run(botContext)
+	go tracker.Run(botContext)
+	if len(cfg.Triage.Rules) > 0 {
+		go triager.Run(botContext)
+	}
 
 	// these are set in slack handler, but read in /healthz endpoint
 	var (
@@ -125,6 +137,16 @@ func main() {
 	slackEventHandlerReady.Store(false)
 	slackEventHandlerBooted.Store(false)
 
+	// thread replies are synced to Jira in background, one by one, so the comments keep the order of the replies
+	threadReplies := make(chan *slackevents.MessageEvent, 1000)
+	go func() {
+		for ev := range threadReplies {
+			if err := syncer.HandleMessage(ev); err != nil {
+				log.Printf("failed to sync thread reply: %v", err)
+			}
+		}
+	}()
+
 	go func() {
 		client.Debugf("Waiting for slack events ...")
 		for evt := range client.Events {
@@ -159,9 +181,12 @@ func main() {
 						continue
 					}
 
-					if err := handleJiraLinks(jiraClient, api, linkSharedEvent); err != nil {
-						log.Printf("failed to unfurl link: %v", err)
-					}
+					// unfurling waits for Jira, the next events should not wait for it
+					go func() {
+						if err := unfurler.HandleLinkShared(linkSharedEvent); err != nil {
+							log.Printf("failed to unfurl link: %v", err)
+						}
+					}()
 				}
 
 				switch eventsAPIEvent.Type {
@@ -170,13 +195,35 @@ func main() {
 					switch ev := innerEvent.Data.(type) {
 					case *slackevents.AppMentionEvent:
 						log.Printf("[shodan][debug] received mention %s", ev.Channel)
-						user, err := client.GetUserInfo(ev.User)
-						if err != nil {
-							log.Printf("Failed to get user %q info: %v", ev.User, err)
-						}
-						if _, _, err := api.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Yes, hello @%s.", user.Profile.DisplayName), false)); err != nil {
-							log.Printf("Failed posting message: %v", err)
-						}
+						go func() {
+							if handled, err := syncer.HandleMention(ev); handled {
+								if err != nil {
+									log.Printf("failed to handle sync mention: %v", err)
+								}
+								return
+							}
+							if _, _, err := api.PostMessage(ev.Channel, slack.MsgOptionText(fmt.Sprintf("Yes, hello <@%s>.", ev.User), false)); err != nil {
+								log.Printf("Failed posting message: %v", err)
+							}
+						}()
+					case *slackevents.MessageEvent:
+						go func() {
+							if err := messageListener.HandleMessage(ev); err != nil {
+								log.Printf("failed to unfurl issue keys: %v", err)
+							}
+						}()
+						threadReplies <- ev
+					case *slackevents.ReactionAddedEvent:
+						go func() {
+							if err := remoteLinker.HandleReactionAdded(ev); err != nil {
+								log.Printf("failed to link slack thread: %v", err)
+							}
+						}()
+						go func() {
+							if err := reactionActions.HandleReactionAdded(ev); err != nil {
+								log.Printf("failed to run %q reaction action: %v", ev.Reaction, err)
+							}
+						}()
 					}
 				default:
 					client.Debugf("unsupported Events API event received")
@@ -192,9 +239,44 @@ func main() {
 				switch callback.Type {
 				case slack.InteractionTypeBlockActions:
 					// See https://api.slack.com/apis/connections/socket-implement#button
+					go func() {
+						ctx, cancel := context.WithTimeout(botContext, time.Minute)
+						defer cancel()
+						for _, action := range callback.ActionCallback.BlockActions {
+							resp := commands.HandleAction(ctx, &callback, action)
+							if resp == nil || len(callback.ResponseURL) == 0 {
+								continue
+							}
+							if err := slack.PostWebhookContext(ctx, callback.ResponseURL, resp.WebhookMessage()); err != nil {
+								log.Printf("failed to respond to action %q: %v", action.ActionID, err)
+							}
+						}
+					}()
 				case slack.InteractionTypeShortcut:
+				case slack.InteractionTypeMessageAction:
+					// message shortcuts (eg. "Create Jira issue") come as message actions
+					go func() {
+						ctx, cancel := context.WithTimeout(botContext, time.Minute)
+						defer cancel()
+						if err := commands.HandleShortcut(ctx, &callback); err != nil {
+							log.Printf("failed to handle shortcut %q: %v", callback.CallbackID, err)
+						}
+					}()
 				case slack.InteractionTypeViewSubmission:
 					// See https://api.slack.com/apis/connections/socket-implement#modal
+					// invalid submission is acked with the errors and the modal stays open,
+					// otherwise the empty ack closes the modal and the submission is handled in background
+					if validationErrors := commands.ValidateViewSubmission(&callback); len(validationErrors) > 0 {
+						payload = slack.NewErrorsViewSubmissionResponse(validationErrors)
+						break
+					}
+					go func() {
+						ctx, cancel := context.WithTimeout(botContext, time.Minute)
+						defer cancel()
+						if err := commands.HandleViewSubmission(ctx, &callback); err != nil {
+							log.Printf("failed to handle view %q submission: %v", callback.View.CallbackID, err)
+						}
+					}()
 				case slack.InteractionTypeDialogSubmission:
 				default:
 				}
@@ -206,28 +288,16 @@ func main() {
 				}
 				log.Printf("[shodan][debug]: Received slash command: %v", spew.Sdump(cmd))
 
-				payload := map[string]interface{}{
-					"blocks": []slack.Block{
-						slack.NewSectionBlock(
-							&slack.TextBlockObject{
-								Type: slack.MarkdownType,
-								Text: "foo",
-							},
-							nil,
-							slack.NewAccessory(
-								slack.NewButtonBlockElement(
-									"",
-									"somevalue",
-									&slack.TextBlockObject{
-										Type: slack.PlainTextType,
-										Text: "bar",
-									},
-								),
-							),
-						),
-					}}
-
-				client.Ack(*evt.Request, payload)
+				// acknowledge right away, Jira might take longer than the 3 seconds Slack waits for the response
+				client.Ack(*evt.Request)
+				go func() {
+					ctx, cancel := context.WithTimeout(botContext, time.Minute)
+					defer cancel()
+					resp := commands.Handle(ctx, cmd)
+					if err := slack.PostWebhookContext(ctx, cmd.ResponseURL, resp.WebhookMessage()); err != nil {
+						log.Printf("failed to respond to %s %s: %v", cmd.Command, cmd.Text, err)
+					}
+				}()
 			case socketmode.EventTypeHello:
 				// we only receive hello after boot and connection to slack
 				slackEventHandlerBooted.Store(true)
@@ -251,6 +321,27 @@ func main() {
 		log.Println("/healthz NOT_READY")
 		w.WriteHeader(http.StatusServiceUnavailable)
 	})
+	// expose the Jira issue cache counters in Prometheus text format
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		stats := unfurler.CacheStats()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprintf(w, "shodan_jira_cache_hits_total %d\n", stats.Hits)
+		fmt.Fprintf(w, "shodan_jira_cache_misses_total %d\n", stats.Misses)
+		fmt.Fprintf(w, "shodan_jira_cache_evictions_total %d\n", stats.Evictions)
+		fmt.Fprintf(w, "shodan_jira_cache_entries %d\n", stats.Size)
+	})
+	// receive Jira webhooks at "https://<host>/webhooks/jira", Jira sends JIRA_WEBHOOK_SECRET as bearer token or signs the body with it
+	if len(cfg.WebhookSecret) > 0 {
+		webhooks := webhook.New(jiraInstances, api, unfurler, subscriptions, state, cfg.WebhookSecret)
+		webhooks.OnChanged(tracker.Refresh)
+		http.Handle("/webhooks/jira", webhooks)
+	} else if cfg.SubscriptionPollInterval > 0 {
+		// without webhooks, subscriptions are served by polling Jira
+		log.Printf("JIRA_WEBHOOK_SECRET not set, polling subscriptions every %s", cfg.SubscriptionPollInterval)
+		poller := subscription.NewPoller(jiraInstances, api, unfurler, subscriptions, cfg.SubscriptionPollInterval)
+		poller.OnChanged(tracker.Refresh)
+		go poller.Run(botContext)
+	}
 	go http.ListenAndServe(":8080", nil)
 
 	// run the main slack handler
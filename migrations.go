@@ -0,0 +1,14 @@
+package main
+
+import (
+	"github.com/mfojtik/shodan/pkg/store"
+)
+
+// migrations upgrade the state written by older Shodan versions. New migrations are appended with the next version.
+var migrations = []store.Migration{
+	{
+		// state written before the schema was versioned has the same layout
+		Version:     1,
+		Description: "record schema version",
+	},
+}
@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LRU is a size bounded cache that evicts least recently used entries and expires entries after TTL.
+// Besides values it can also remember errors (negative caching), eg. for issues that do not exist.
+type LRU[V any] struct {
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	// isNegative returns true for errors that should be cached
+	isNegative func(error) bool
+
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	// fetching are the keys being fetched by Get, so Invalidate can tell the fetches their result is stale
+	fetching map[string]*inflight
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+type entry[V any] struct {
+	key     string
+	value   V
+	err     error
+	expires time.Time
+}
+
+// inflight tracks the running fetches of a key.
+type inflight struct {
+	running int
+	// generation is bumped by Invalidate, fetches started in an older generation are not cached
+	generation uint64
+}
+
+// Stats are the cache counters since the cache was created.
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int
+}
+
+// New returns cache holding at most size entries for ttl.
+// Errors for which isNegative returns true are cached for negativeTTL, other errors are never cached.
+// Non-positive size or ttl disables caching (Get always fetches), such cache can't be used with Add.
+func New[V any](size int, ttl, negativeTTL time.Duration, isNegative func(error) bool) *LRU[V] {
+	if isNegative == nil {
+		isNegative = func(error) bool { return false }
+	}
+	return &LRU[V]{
+		size:        size,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		isNegative:  isNegative,
+		entries:     map[string]*list.Element{},
+		order:       list.New(),
+		fetching:    map[string]*inflight{},
+	}
+}
+
+// Get returns the cached value (or cached error) for the key.
+// When the key is not cached or expired, fetch is called and its result cached,
+// unless the key was invalidated while fetching (the result may predate the change that invalidated it).
+func (c *LRU[V]) Get(key string, fetch func() (V, error)) (V, error) {
+	if value, err, ok := c.lookup(key); ok {
+		atomic.AddUint64(&c.hits, 1)
+		return value, err
+	}
+	atomic.AddUint64(&c.misses, 1)
+
+	generation := c.startFetch(key)
+	value, err := fetch()
+	switch {
+	case err == nil:
+		c.finishFetch(key, generation, value, nil, c.ttl)
+	case c.isNegative(err) && c.negativeTTL > 0:
+		c.finishFetch(key, generation, value, err, c.negativeTTL)
+	default:
+		c.finishFetch(key, generation, value, err, 0)
+	}
+	return value, err
+}
+
+// Add caches the value unless the key is already cached. It returns false when the key was cached (and not expired).
+// The check and the insert are done under single lock, so concurrent callers can use it to claim the key.
+// It panics for cache with caching disabled, as it would claim every key.
+func (c *LRU[V]) Add(key string, value V) bool {
+	if c.size <= 0 || c.ttl <= 0 {
+		panic("cache: Add needs positive size and ttl")
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e, ok := c.entries[key]; ok && !time.Now().After(e.Value.(*entry[V]).expires) {
+		return false
+	}
+	c.insert(key, value, nil, c.ttl)
+	return true
+}
+
+// Invalidate removes the key from the cache, so the next Get fetches fresh value.
+func (c *LRU[V]) Invalidate(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.order.Remove(e)
+		delete(c.entries, key)
+	}
+	if f, ok := c.fetching[key]; ok {
+		f.generation++
+	}
+}
+
+// Stats returns the hit, miss and eviction counters.
+func (c *LRU[V]) Stats() Stats {
+	c.lock.Lock()
+	size := c.order.Len()
+	c.lock.Unlock()
+	return Stats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Evictions: atomic.LoadUint64(&c.evictions),
+		Size:      size,
+	}
+}
+
+func (c *LRU[V]) lookup(key string) (V, error, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var empty V
+	e, ok := c.entries[key]
+	if !ok {
+		return empty, nil, false
+	}
+	item := e.Value.(*entry[V])
+	if time.Now().After(item.expires) {
+		c.order.Remove(e)
+		delete(c.entries, key)
+		return empty, nil, false
+	}
+	c.order.MoveToFront(e)
+	return item.value, item.err, true
+}
+
+// startFetch registers fetch of the key and returns its generation.
+func (c *LRU[V]) startFetch(key string) uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	f, ok := c.fetching[key]
+	if !ok {
+		f = &inflight{}
+		c.fetching[key] = f
+	}
+	f.running++
+	return f.generation
+}
+
+// finishFetch caches the fetched value for ttl (zero ttl caches nothing), unless the key was invalidated since the fetch started.
+func (c *LRU[V]) finishFetch(key string, generation uint64, value V, err error, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	f := c.fetching[key]
+	if f.running--; f.running == 0 {
+		delete(c.fetching, key)
+	}
+	if f.generation == generation && ttl > 0 {
+		c.insert(key, value, err, ttl)
+	}
+}
+
+// insert adds the entry, evicting the least recently used ones. The lock must be held.
+func (c *LRU[V]) insert(key string, value V, err error, ttl time.Duration) {
+	if c.size <= 0 || ttl <= 0 {
+		return
+	}
+	item := &entry[V]{key: key, value: value, err: err, expires: time.Now().Add(ttl)}
+	if e, ok := c.entries[key]; ok {
+		e.Value = item
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(item)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry[V]).key)
+		atomic.AddUint64(&c.evictions, 1)
+	}
+}
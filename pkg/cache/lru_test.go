@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var errNotFound = errors.New("not found")
+
+// fetcher returns fetch functions returning the value and recording the fetched keys.
+type fetcher struct {
+	fetched []string
+}
+
+func (f *fetcher) fetch(key string, value int, err error) func() (int, error) {
+	return func() (int, error) {
+		f.fetched = append(f.fetched, key)
+		return value, err
+	}
+}
+
+func TestLRUEviction(t *testing.T) {
+	c := New[int](2, time.Hour, 0, nil)
+	f := &fetcher{}
+	for _, key := range []string{"a", "b", "a", "c", "a", "b"} {
+		if _, err := c.Get(key, f.fetch(key, 1, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// "a" was used before "c" was added, so "b" was the least recently used and got evicted
+	if expected := []string{"a", "b", "c", "b"}; !reflect.DeepEqual(f.fetched, expected) {
+		t.Errorf("expected fetched %v, got %v", expected, f.fetched)
+	}
+	if stats := c.Stats(); stats != (Stats{Hits: 2, Misses: 4, Evictions: 2, Size: 2}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestLRUExpiry(t *testing.T) {
+	c := New[int](10, 20*time.Millisecond, 0, nil)
+	f := &fetcher{}
+	c.Get("a", f.fetch("a", 1, nil))
+	c.Get("a", f.fetch("a", 1, nil))
+	time.Sleep(30 * time.Millisecond)
+	value, err := c.Get("a", f.fetch("a", 2, nil))
+	if err != nil || value != 2 {
+		t.Errorf("expected expired value fetched again, got %d %v", value, err)
+	}
+	if len(f.fetched) != 2 {
+		t.Errorf("expected two fetches, got %v", f.fetched)
+	}
+}
+
+func TestLRUNegativeCaching(t *testing.T) {
+	isNotFound := func(err error) bool { return errors.Is(err, errNotFound) }
+	tests := []struct {
+		name          string
+		negativeTTL   time.Duration
+		err           error
+		expectFetches int
+	}{
+		{name: "negative error is cached", negativeTTL: time.Hour, err: errNotFound, expectFetches: 1},
+		{name: "other errors are not cached", negativeTTL: time.Hour, err: errors.New("timeout"), expectFetches: 3},
+		{name: "zero negative TTL caches no errors", err: errNotFound, expectFetches: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := New[int](10, time.Hour, test.negativeTTL, isNotFound)
+			f := &fetcher{}
+			for i := 0; i < 3; i++ {
+				if _, err := c.Get("a", f.fetch("a", 0, test.err)); err != test.err {
+					t.Errorf("expected %v, got %v", test.err, err)
+				}
+			}
+			if len(f.fetched) != test.expectFetches {
+				t.Errorf("expected %d fetches, got %d", test.expectFetches, len(f.fetched))
+			}
+		})
+	}
+}
+
+func TestLRUDisabled(t *testing.T) {
+	for _, c := range []*LRU[int]{New[int](0, time.Hour, 0, nil), New[int](10, 0, 0, nil)} {
+		f := &fetcher{}
+		c.Get("a", f.fetch("a", 1, nil))
+		c.Get("a", f.fetch("a", 1, nil))
+		if len(f.fetched) != 2 {
+			t.Errorf("expected every Get fetched, got %v", f.fetched)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected Add to panic for disabled cache")
+		}
+	}()
+	New[int](0, time.Hour, 0, nil).Add("a", 1)
+}
+
+func TestLRUAdd(t *testing.T) {
+	c := New[bool](10, 20*time.Millisecond, 0, nil)
+	if !c.Add("a", true) {
+		t.Error("expected the first Add to claim the key")
+	}
+	if c.Add("a", true) {
+		t.Error("expected the key claimed already")
+	}
+	if value, _ := c.Get("a", func() (bool, error) { return false, nil }); !value {
+		t.Error("expected the added value cached")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if !c.Add("a", true) {
+		t.Error("expected expired key claimed again")
+	}
+}
+
+func TestLRUInvalidateDuringFetch(t *testing.T) {
+	c := New[int](10, time.Hour, 0, nil)
+	started, finish := make(chan struct{}), make(chan struct{})
+	done := make(chan int)
+	go func() {
+		value, _ := c.Get("a", func() (int, error) {
+			close(started)
+			<-finish
+			return 1, nil
+		})
+		done <- value
+	}()
+
+	// the issue changes while it is being fetched, the fetched value may be the old one
+	<-started
+	c.Invalidate("a")
+	close(finish)
+	if value := <-done; value != 1 {
+		t.Errorf("expected the fetched value returned, got %d", value)
+	}
+
+	if value, _ := c.Get("a", func() (int, error) { return 2, nil }); value != 2 {
+		t.Errorf("expected the value fetched before invalidation not cached, got %d", value)
+	}
+	if value, _ := c.Get("a", func() (int, error) { return 3, nil }); value != 2 {
+		t.Errorf("expected the value fetched after invalidation cached, got %d", value)
+	}
+	if len(c.fetching) != 0 {
+		t.Errorf("expected no fetches tracked, got %v", c.fetching)
+	}
+}
@@ -0,0 +1,60 @@
+package command
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// smartQuotes replaces the typographic quotes Slack clients like to insert with plain ones.
+var smartQuotes = strings.NewReplacer("“", `"`, "”", `"`, "‘", "'", "’", "'")
+
+// ParseArgs splits the command text into arguments on whitespace.
+// Arguments can be quoted with single or double quotes to include whitespace, eg. `search "project = API"`.
+// Slack "smart" quotes are treated as regular double quotes.
+func ParseArgs(text string) ([]string, error) {
+	args, _, err := CutArgs(text, -1)
+	return args, err
+}
+
+// CutArgs parses the first n arguments (all arguments when n is negative) like ParseArgs
+// and returns the rest of the text as is, eg. JQL query following the arguments.
+func CutArgs(text string, n int) ([]string, string, error) {
+	text = smartQuotes.Replace(text)
+
+	var (
+		args    []string
+		current strings.Builder
+		quote   rune
+		inArg   bool
+	)
+	for i, r := range text {
+		if n >= 0 && len(args) == n {
+			return args, strings.TrimSpace(text[i:]), nil
+		}
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, "", errors.New("unterminated quote in command arguments")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, "", nil
+}
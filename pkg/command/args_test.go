@@ -0,0 +1,60 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+		err      bool
+	}{
+		{text: "", expected: nil},
+		{text: "  API-1   API-2 ", expected: []string{"API-1", "API-2"}},
+		{text: `"project = API" open`, expected: []string{"project = API", "open"}},
+		{text: `'single quoted' x`, expected: []string{"single quoted", "x"}},
+		{text: `“smart quotes”`, expected: []string{"smart quotes"}},
+		{text: `a"b c"d`, expected: []string{"ab cd"}},
+		{text: `""`, expected: []string{""}},
+		{text: `can't`, err: true},
+		{text: `"unterminated`, err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			args, err := ParseArgs(test.text)
+			if (err != nil) != test.err {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(args, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, args)
+			}
+		})
+	}
+}
+
+func TestCutArgs(t *testing.T) {
+	tests := []struct {
+		text string
+		n    int
+		args []string
+		rest string
+	}{
+		{text: `add "0 9 * * 1" Europe/Prague status = "In Progress"`, n: 3, args: []string{"add", "0 9 * * 1", "Europe/Prague"}, rest: `status = "In Progress"`},
+		{text: "add @daily UTC", n: 3, args: []string{"add", "@daily", "UTC"}, rest: ""},
+		{text: "jql text ~ can't", n: 1, args: []string{"jql"}, rest: "text ~ can't"},
+		{text: "a b c", n: -1, args: []string{"a", "b", "c"}, rest: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			args, rest, err := CutArgs(test.text, test.n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(args, test.args) || rest != test.rest {
+				t.Errorf("expected %q + %q, got %q + %q", test.args, test.rest, args, rest)
+			}
+		})
+	}
+}
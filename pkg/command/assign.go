@@ -0,0 +1,60 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mfojtik/shodan/pkg/identity"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/unfurl"
+	"strings"
+)
+
+// AssignCommand changes the issue assignee.
+type AssignCommand struct {
+	Instances  jiraclient.Instances
+	Unfurler   *unfurl.Unfurler
+	Identities *identity.Resolver
+}
+
+func (c *AssignCommand) Name() string  { return "assign" }
+func (c *AssignCommand) Usage() string { return "<KEY> <jira-username>|none" }
+func (c *AssignCommand) Help() string {
+	return "Assign the issue to a Jira user, or unassign it with \"none\"."
+}
+
+func (c *AssignCommand) Run(ctx context.Context, req *Request) (*Response, error) {
+	if len(req.Args) != 2 {
+		return nil, Usagef("Issue key and Jira username are required.")
+	}
+	key, username := strings.ToUpper(req.Args[0]), strings.TrimPrefix(req.Args[1], "@")
+	instance := c.Instances.ForKey(key)
+
+	// the issue is assigned with Shodan account, so the invoker's Jira account must be allowed to do it
+	user, err := c.Identities.Authorize(ctx, instance, req.UserID, key, "ASSIGN_ISSUES")
+	if errors.Is(err, identity.ErrNotMapped) {
+		return Errorf("I don't know your Jira account: %v", err), nil
+	}
+	if errors.Is(err, identity.ErrForbidden) {
+		return Errorf("Your Jira account is not allowed to assign %s.", key), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.EqualFold(username, "none"):
+		username = ""
+	case strings.EqualFold(username, "me"):
+		username = identity.QueryID(user)
+	}
+	if err := instance.Assign(ctx, key, username); err != nil {
+		return nil, err
+	}
+	c.Unfurler.Invalidate(instance, key)
+
+	if username == "" {
+		return &Response{Text: fmt.Sprintf("<%s|%s> is now unassigned.", instance.BrowseURL(key), key)}, nil
+	}
+	return &Response{Text: fmt.Sprintf("<%s|%s> is now assigned to %s.", instance.BrowseURL(key), key, username)}, nil
+}
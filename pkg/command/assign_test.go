@@ -0,0 +1,61 @@
+package command
+
+import (
+	"context"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"strings"
+	"testing"
+)
+
+func TestAssignPermission(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		permissions map[string][]string
+		expectJira  []string
+		expectText  string
+	}{
+		{
+			name:        "allowed",
+			args:        []string{"api-1", "@bob"},
+			permissions: map[string][]string{"ASSIGN_ISSUES/API-1": {"alice"}},
+			expectJira:  []string{`PUT issue/API-1/assignee {"name":"bob"}`},
+			expectText:  "is now assigned to bob.",
+		},
+		{
+			name:        "me",
+			args:        []string{"API-1", "me"},
+			permissions: map[string][]string{"ASSIGN_ISSUES/API-1": {"alice"}},
+			expectJira:  []string{`PUT issue/API-1/assignee {"name":"alice"}`},
+			expectText:  "is now assigned to alice.",
+		},
+		{
+			name:        "forbidden",
+			args:        []string{"API-1", "bob"},
+			permissions: map[string][]string{"ASSIGN_ISSUES/API-1": {"bob"}},
+			expectText:  ":warning: Your Jira account is not allowed to assign API-1.",
+		},
+		{
+			name:        "unassign forbidden",
+			args:        []string{"API-1", "none"},
+			permissions: map[string][]string{"ASSIGN_ISSUES/API-2": {"alice"}},
+			expectText:  ":warning: Your Jira account is not allowed to assign API-1.",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newFakeServices(t, test.permissions)
+			assign := &AssignCommand{Instances: jiraclient.Instances{f.instance}, Unfurler: f.unfurler, Identities: f.identities}
+			resp, err := assign.Run(context.Background(), &Request{UserID: "UALICE", Args: test.args})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(resp.Text, test.expectText) {
+				t.Errorf("expected response ending with %q, got %q", test.expectText, resp.Text)
+			}
+			if strings.Join(f.jiraRequests, "\n") != strings.Join(test.expectJira, "\n") {
+				t.Errorf("expected Jira requests %q, got %q", test.expectJira, f.jiraRequests)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/identity"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/markup"
+	"github.com/mfojtik/shodan/pkg/render"
+	"github.com/slack-go/slack"
+	"log"
+	"strings"
+)
+
+const (
+	// CreateIssueShortcutID is the callback ID of the "Create Jira issue" message shortcut configured in the Slack app.
+	CreateIssueShortcutID = "create_jira_issue"
+	// createIssueCallbackID is the callback ID of the create issue modal.
+	createIssueCallbackID = "create_jira_issue_modal"
+
+	// block IDs of the create issue modal inputs, the action IDs are "create_issue_<block ID>"
+	projectBlockID     = "project"
+	summaryBlockID     = "summary"
+	descriptionBlockID = "description"
+	typeBlockID        = "type"
+	componentBlockID   = "component"
+	priorityBlockID    = "priority"
+
+	// summaryMaxLength is the maximum length of Jira issue summary.
+	summaryMaxLength = 255
+	// inputMaxLength is the maximum length of Slack plain text input.
+	inputMaxLength = 3000
+)
+
+// CreateIssueShortcut creates Jira issue from a Slack message and posts the issue link back to the message thread.
+// The project is picked first, issue types, components and priorities are then loaded for the selected project.
+type CreateIssueShortcut struct {
+	Instances   jiraclient.Instances
+	Identities  *identity.Resolver
+	SlackClient *slack.Client
+}
+
+// createIssueModal is the state the modal is opened with.
+type createIssueModal struct {
+	ChannelID        string `json:"c"`
+	MessageTimeStamp string `json:"m"`
+	ThreadTimeStamp  string `json:"t,omitempty"`
+}
+
+// projectFields are the choices for the selected project.
+type projectFields struct {
+	issueTypes []jira.IssueType
+	components []jira.ProjectComponent
+	priorities []jira.Priority
+}
+
+func (c *CreateIssueShortcut) ShortcutIDs() []string { return []string{CreateIssueShortcutID} }
+func (c *CreateIssueShortcut) CallbackIDs() []string { return []string{createIssueCallbackID} }
+func (c *CreateIssueShortcut) ActionIDs() []string {
+	return []string{createIssueActionID(projectBlockID)}
+}
+
+func (c *CreateIssueShortcut) HandleShortcut(ctx context.Context, shortcut *Shortcut) error {
+	projects := c.projectOptions()
+	if len(projects) == 0 {
+		notify(ctx, c.SlackClient, shortcut.ChannelID, shortcut.ThreadTimeStamp, shortcut.UserID, Errorf("There are no Jira projects configured.").Text)
+		return nil
+	}
+	metadata, err := json.Marshal(&createIssueModal{
+		ChannelID:        shortcut.ChannelID,
+		MessageTimeStamp: shortcut.MessageTimeStamp,
+		ThreadTimeStamp:  shortcut.ThreadTimeStamp,
+	})
+	if err != nil {
+		return err
+	}
+
+	summary, _, _ := strings.Cut(strings.TrimSpace(shortcut.MessageText), "\n")
+	view := &createIssueView{
+		metadata:    string(metadata),
+		projects:    projects,
+		summary:     render.Truncate(summary, summaryMaxLength),
+		description: render.Truncate(shortcut.MessageText, inputMaxLength),
+	}
+	if len(projects) == 1 {
+		view.project = projects[0]
+	}
+	// the trigger ID expires in 3 seconds, so the modal is opened before the project fields are loaded
+	resp, err := c.SlackClient.OpenViewContext(ctx, shortcut.TriggerID, view.request())
+	if err != nil {
+		return fmt.Errorf("failed to open create issue dialog: %v", err)
+	}
+	if view.project == nil {
+		return nil
+	}
+	return c.loadFields(ctx, view, &resp.View)
+}
+
+func (c *CreateIssueShortcut) HandleAction(ctx context.Context, action *Action) (*Response, error) {
+	if action.View == nil {
+		return nil, nil
+	}
+	view := &createIssueView{
+		metadata: action.View.PrivateMetadata,
+		projects: c.projectOptions(),
+	}
+	for _, p := range view.projects {
+		if p.Value == action.Value {
+			view.project = p
+		}
+	}
+	if view.project == nil {
+		return nil, fmt.Errorf("unknown project %q", action.Value)
+	}
+	return nil, c.loadFields(ctx, view, action.View)
+}
+
+// ValidateViewSubmission checks the inputs Slack can't check by itself, so the user can fix them in the modal.
+func (c *CreateIssueShortcut) ValidateViewSubmission(submission *ViewSubmission) map[string]string {
+	errors := map[string]string{}
+	instanceName, projectKey, _ := strings.Cut(createIssueValue(submission, projectBlockID), "/")
+	switch {
+	case c.Instances.ByName(instanceName) == nil:
+		errors[projectBlockID] = "Select one of the listed projects."
+	case len(createIssueValue(submission, typeBlockID)) == 0:
+		// the issue type input is added once the project is loaded
+		errors[projectBlockID] = fmt.Sprintf("Wait for the issue types of %s to load.", projectKey)
+	}
+	if len(createIssueValue(submission, summaryBlockID)) == 0 {
+		errors[summaryBlockID] = "Summary can't be empty."
+	}
+	return errors
+}
+
+func (c *CreateIssueShortcut) HandleViewSubmission(ctx context.Context, submission *ViewSubmission) error {
+	modal := &createIssueModal{}
+	if err := json.Unmarshal([]byte(submission.PrivateMetadata), modal); err != nil {
+		return fmt.Errorf("invalid create issue modal state %q", submission.PrivateMetadata)
+	}
+	if err := c.create(ctx, modal, submission); err != nil {
+		notify(ctx, c.SlackClient, modal.ChannelID, modal.ThreadTimeStamp, submission.UserID, Errorf("Failed to create Jira issue: %v", err).Text)
+		return err
+	}
+	return nil
+}
+
+// create creates the issue from the submitted modal and posts its link to the thread of the original message.
+// The submission was validated by ValidateViewSubmission before.
+func (c *CreateIssueShortcut) create(ctx context.Context, modal *createIssueModal, submission *ViewSubmission) error {
+	value := func(blockID string) string {
+		return createIssueValue(submission, blockID)
+	}
+
+	instanceName, projectKey, _ := strings.Cut(value(projectBlockID), "/")
+	instance := c.Instances.ByName(instanceName)
+	if instance == nil {
+		return fmt.Errorf("unknown Jira instance %q", instanceName)
+	}
+
+	fields := &jira.IssueFields{
+		Project:     jira.Project{Key: projectKey},
+		Type:        jira.IssueType{ID: value(typeBlockID)},
+		Summary:     value(summaryBlockID),
+		Description: value(descriptionBlockID),
+	}
+	if id := value(componentBlockID); len(id) > 0 {
+		fields.Components = []*jira.Component{{ID: id}}
+	}
+	if id := value(priorityBlockID); len(id) > 0 {
+		fields.Priority = &jira.Priority{ID: id}
+	}
+	issue, err := createFromMessage(ctx, c.SlackClient, c.Identities, instance, fields, submission.UserID, modal.ChannelID, modal.MessageTimeStamp)
+	if err != nil {
+		return err
+	}
+
+	thread := modal.ThreadTimeStamp
+	if len(thread) == 0 {
+		thread = modal.MessageTimeStamp
+	}
+	return announceCreated(ctx, c.SlackClient, instance, issue, submission.UserID, modal.ChannelID, thread)
+}
+
+// createFromMessage creates Jira issue from the Slack message on behalf of the Slack user.
+// The description is Slack text, it is converted to Jira markup first.
+// The issue is created by Shodan account, so the user and the message are referenced in the description.
+func createFromMessage(ctx context.Context, slackClient *slack.Client, identities *identity.Resolver, instance *jiraclient.Instance, fields *jira.IssueFields, slackUserID, channel, messageTimeStamp string) (*jira.Issue, error) {
+	fields.Description = markup.FromSlack(fields.Description, func(slackUserID string) string {
+		return identities.Attribution(ctx, instance, slackUserID)
+	})
+	fields.Description += "\n\n----\nCreated from Slack by " + identities.Attribution(ctx, instance, slackUserID)
+	if permalink, err := slackClient.GetPermalinkContext(ctx, &slack.PermalinkParameters{Channel: channel, Ts: messageTimeStamp}); err == nil {
+		fields.Description += fmt.Sprintf(" ([original message|%s])", permalink)
+	} else {
+		log.Printf("failed to get permalink of %s/%s: %v", channel, messageTimeStamp, err)
+	}
+
+	issue, _, err := instance.Client.Issue.CreateWithContext(ctx, &jira.Issue{Fields: fields})
+	if err != nil {
+		return nil, err
+	}
+	// the created issue only has the key, the summary is what we sent
+	issue.Fields = fields
+	return issue, nil
+}
+
+// announceCreated posts the link to the created issue to the thread.
+func announceCreated(ctx context.Context, slackClient *slack.Client, instance *jiraclient.Instance, issue *jira.Issue, slackUserID, channel, threadTimeStamp string) error {
+	text := fmt.Sprintf(":white_check_mark: <@%s> created <%s|%s>: %s", slackUserID, instance.BrowseURL(issue.Key), issue.Key, render.Escape(issue.Fields.Summary))
+	_, _, err := slackClient.PostMessageContext(ctx, channel, slack.MsgOptionTS(threadTimeStamp), slack.MsgOptionText(text, false))
+	return err
+}
+
+// loadFields fetches the choices of the selected project and updates the modal with them.
+func (c *CreateIssueShortcut) loadFields(ctx context.Context, view *createIssueView, current *slack.View) error {
+	instanceName, projectKey, _ := strings.Cut(view.project.Value, "/")
+	instance := c.Instances.ByName(instanceName)
+	if instance == nil {
+		return fmt.Errorf("unknown Jira instance %q", instanceName)
+	}
+
+	project, _, err := instance.Client.Project.GetWithContext(ctx, projectKey)
+	if err != nil {
+		return fmt.Errorf("failed to get project %s: %v", projectKey, err)
+	}
+	priorities, _, err := instance.Client.Priority.GetListWithContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get priorities: %v", err)
+	}
+	view.fields = &projectFields{components: project.Components, priorities: priorities}
+	for _, t := range project.IssueTypes {
+		if !t.Subtask {
+			view.fields.issueTypes = append(view.fields.issueTypes, t)
+		}
+	}
+
+	if _, err := c.SlackClient.UpdateViewContext(ctx, view.request(), "", current.Hash, current.ID); err != nil {
+		return fmt.Errorf("failed to update create issue dialog: %v", err)
+	}
+	return nil
+}
+
+// projectOptions returns the configured projects of all instances, valued "<instance>/<project key>".
+func (c *CreateIssueShortcut) projectOptions() []*slack.OptionBlockObject {
+	var options []*slack.OptionBlockObject
+	for _, instance := range c.Instances {
+		for _, project := range instance.Projects {
+			text := project
+			if len(c.Instances) > 1 {
+				text += " (" + instance.DisplayName + ")"
+			}
+			options = append(options, slack.NewOptionBlockObject(instance.Name+"/"+project, slack.NewTextBlockObject(slack.PlainTextType, text, false, false), nil))
+		}
+	}
+	if len(options) > render.MaxSelectOptions {
+		options = options[:render.MaxSelectOptions]
+	}
+	return options
+}
+
+// createIssueView is the create issue modal content.
+// Inputs keep their block IDs when the modal is updated, so Slack preserves the values users already entered.
+type createIssueView struct {
+	metadata    string
+	projects    []*slack.OptionBlockObject
+	project     *slack.OptionBlockObject
+	summary     string
+	description string
+	// fields are set once the selected project is loaded
+	fields *projectFields
+}
+
+func (v *createIssueView) request() slack.ModalViewRequest {
+	text := func(s string) *slack.TextBlockObject {
+		return slack.NewTextBlockObject(slack.PlainTextType, s, false, false)
+	}
+
+	projectSelect := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, text("Select project"), createIssueActionID(projectBlockID), v.projects...)
+	projectSelect.InitialOption = v.project
+	project := slack.NewInputBlock(projectBlockID, text("Project"), nil, projectSelect)
+	project.DispatchAction = true
+
+	summary := slack.NewPlainTextInputBlockElement(nil, createIssueActionID(summaryBlockID))
+	summary.InitialValue = v.summary
+	summary.MaxLength = summaryMaxLength
+	description := slack.NewPlainTextInputBlockElement(nil, createIssueActionID(descriptionBlockID))
+	description.InitialValue = v.description
+	description.Multiline = true
+
+	blocks := []slack.Block{
+		project,
+		slack.NewInputBlock(summaryBlockID, text("Summary"), nil, summary),
+		slack.NewInputBlock(descriptionBlockID, text("Description"), nil, description),
+	}
+
+	if v.fields == nil {
+		if v.project != nil {
+			blocks = append(blocks, slack.NewContextBlock("", text("Loading issue types…")))
+		}
+	} else {
+		var types, components, priorities []*slack.OptionBlockObject
+		for _, t := range v.fields.issueTypes {
+			types = append(types, slack.NewOptionBlockObject(t.ID, text(t.Name), nil))
+		}
+		for _, c := range v.fields.components {
+			components = append(components, slack.NewOptionBlockObject(c.ID, text(c.Name), nil))
+		}
+		for _, p := range v.fields.priorities {
+			priorities = append(priorities, slack.NewOptionBlockObject(p.ID, text(p.Name), nil))
+		}
+		selectInput := func(blockID, label string, options []*slack.OptionBlockObject, optional bool) *slack.InputBlock {
+			if len(options) > render.MaxSelectOptions {
+				options = options[:render.MaxSelectOptions]
+			}
+			input := slack.NewInputBlock(blockID, text(label), nil, slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, text("Select "+strings.ToLower(label)), createIssueActionID(blockID), options...))
+			input.Optional = optional
+			return input
+		}
+		if len(types) > 0 {
+			blocks = append(blocks, selectInput(typeBlockID, "Issue type", types, false))
+		}
+		if len(components) > 0 {
+			blocks = append(blocks, selectInput(componentBlockID, "Component", components, true))
+		}
+		if len(priorities) > 0 {
+			blocks = append(blocks, selectInput(priorityBlockID, "Priority", priorities, true))
+		}
+	}
+
+	return slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		CallbackID:      createIssueCallbackID,
+		PrivateMetadata: v.metadata,
+		Title:           text("Create Jira issue"),
+		Submit:          text("Create"),
+		Close:           text("Cancel"),
+		Blocks:          slack.Blocks{BlockSet: blocks},
+	}
+}
+
+// createIssueValue returns the submitted value of the modal input, text or selected option.
+func createIssueValue(submission *ViewSubmission, blockID string) string {
+	action := submission.Values[blockID][createIssueActionID(blockID)]
+	if len(action.Value) > 0 {
+		return strings.TrimSpace(action.Value)
+	}
+	return action.SelectedOption.Value
+}
+
+func createIssueActionID(blockID string) string {
+	return "create_issue_" + blockID
+}
@@ -0,0 +1,67 @@
+package command
+
+import (
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/slack-go/slack"
+	"reflect"
+	"testing"
+)
+
+func TestCreateIssueValidation(t *testing.T) {
+	instance, err := jiraclient.NewInstance("jira", "Jira", "https://jira.example.com", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shortcut := &CreateIssueShortcut{Instances: jiraclient.Instances{instance}}
+	router := NewRouter("/shodan")
+	router.RegisterViews(shortcut)
+
+	submission := func(project, summary, issueType string) *slack.InteractionCallback {
+		values := map[string]map[string]slack.BlockAction{
+			projectBlockID: {createIssueActionID(projectBlockID): {SelectedOption: slack.OptionBlockObject{Value: project}}},
+			summaryBlockID: {createIssueActionID(summaryBlockID): {Value: summary}},
+		}
+		if len(issueType) > 0 {
+			values[typeBlockID] = map[string]slack.BlockAction{createIssueActionID(typeBlockID): {SelectedOption: slack.OptionBlockObject{Value: issueType}}}
+		}
+		return &slack.InteractionCallback{View: slack.View{CallbackID: createIssueCallbackID, State: &slack.ViewState{Values: values}}}
+	}
+
+	tests := []struct {
+		name     string
+		callback *slack.InteractionCallback
+		expected map[string]string
+	}{
+		{
+			name:     "valid",
+			callback: submission("jira/API", "Login fails", "1"),
+			expected: map[string]string{},
+		},
+		{
+			name:     "unknown instance",
+			callback: submission("nope/API", "Login fails", "1"),
+			expected: map[string]string{projectBlockID: "Select one of the listed projects."},
+		},
+		{
+			name:     "issue types not loaded",
+			callback: submission("jira/API", "Login fails", ""),
+			expected: map[string]string{projectBlockID: "Wait for the issue types of API to load."},
+		},
+		{
+			name:     "blank summary",
+			callback: submission("jira/API", "  ", "1"),
+			expected: map[string]string{summaryBlockID: "Summary can't be empty."},
+		},
+		{
+			name:     "modal without validation",
+			callback: &slack.InteractionCallback{View: slack.View{CallbackID: "other"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if errors := router.ValidateViewSubmission(test.callback); !reflect.DeepEqual(errors, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, errors)
+			}
+		})
+	}
+}
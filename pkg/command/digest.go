@@ -0,0 +1,114 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/digest"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/render"
+	"strings"
+	"time"
+)
+
+// DigestCommand manages the scheduled digests of Jira activity posted to the channel.
+type DigestCommand struct {
+	Instances jiraclient.Instances
+	Scheduler *digest.Scheduler
+}
+
+func (c *DigestCommand) Name() string { return "digest" }
+func (c *DigestCommand) Usage() string {
+	return `[add "<schedule>" <time zone> <JQL>|remove <ID>|run <ID>]`
+}
+func (c *DigestCommand) Help() string {
+	return "List digests of this channel, or schedule a summary of issues created, resolved and blocked, and top priority unassigned issues matching the JQL query. " +
+		`Schedule is a cron expression (eg. "0 9 * * mon-fri") or @daily, @weekdays or @weekly, time zone is eg. Europe/Prague.`
+}
+
+// UsesRawArgs tells the router not to parse quotes, the digest scope is JQL query.
+func (c *DigestCommand) UsesRawArgs() {}
+
+func (c *DigestCommand) Run(ctx context.Context, req *Request) (*Response, error) {
+	if len(req.Args) == 0 {
+		return c.list(req.ChannelID)
+	}
+	switch strings.ToLower(req.Args[0]) {
+	case "add":
+		args, jql, err := CutArgs(req.RawArgs, 3)
+		if err != nil {
+			return nil, Usagef("%v", err)
+		}
+		if len(args) < 3 || len(jql) == 0 {
+			return nil, Usagef("Schedule, time zone and JQL query are required.")
+		}
+		instance := c.Instances.Default()
+		if _, _, err := instance.Client.Issue.SearchWithContext(ctx, jql, &jira.SearchOptions{MaxResults: 1, Fields: []string{"key"}}); err != nil {
+			return Errorf("Invalid JQL query: %v", err), nil
+		}
+		d := &digest.Digest{
+			Instance:  instance.Name,
+			Channel:   req.ChannelID,
+			Schedule:  args[1],
+			TimeZone:  args[2],
+			JQL:       jql,
+			CreatedBy: req.UserID,
+		}
+		if err := c.Scheduler.Add(d); err != nil {
+			return Errorf("%v", err), nil
+		}
+		return &Response{
+			Text:      fmt.Sprintf(":newspaper: <@%s> scheduled digest %s of %s, first on %s.", req.UserID, d.ID, render.Escape(d.JQL), d.NextRun.Format("Mon Jan 2 15:04 MST")),
+			InChannel: true,
+		}, nil
+	case "remove":
+		if len(req.Args) != 2 {
+			return nil, Usagef("Digest ID is required.")
+		}
+		removed, err := c.Scheduler.Remove(req.ChannelID, req.Args[1])
+		if err != nil {
+			return nil, err
+		}
+		if !removed {
+			return Errorf("This channel has no digest %q.", req.Args[1]), nil
+		}
+		return &Response{Text: fmt.Sprintf("Digest %s removed.", req.Args[1])}, nil
+	case "run":
+		if len(req.Args) != 2 {
+			return nil, Usagef("Digest ID is required.")
+		}
+		d, err := c.Scheduler.Get(req.ChannelID, req.Args[1])
+		if err != nil {
+			return nil, err
+		}
+		if d == nil {
+			return Errorf("This channel has no digest %q.", req.Args[1]), nil
+		}
+		from := d.LastRun
+		if from.IsZero() {
+			from = time.Now().Add(-24 * time.Hour)
+		}
+		if err := c.Scheduler.Post(ctx, d, from, time.Now()); err != nil {
+			return nil, err
+		}
+		return &Response{Text: "Digest posted, the schedule is not affected."}, nil
+	default:
+		return nil, Usagef("Unknown digest command %q.", req.Args[0])
+	}
+}
+
+func (c *DigestCommand) list(channel string) (*Response, error) {
+	digests, err := c.Scheduler.List(channel)
+	if err != nil {
+		return nil, err
+	}
+	if len(digests) == 0 {
+		return &Response{Text: "This channel has no digests."}, nil
+	}
+	lines := []string{"Digests of this channel:"}
+	for _, d := range digests {
+		lines = append(lines, fmt.Sprintf("• `%s` %s at `%s` (%s), next on %s, by <@%s>",
+			d.ID, render.Escape(d.JQL), d.Schedule, d.TimeZone, d.NextRun.Format("Mon Jan 2 15:04 MST"), d.CreatedBy))
+	}
+	return &Response{Text: strings.Join(lines, "\n")}, nil
+}
@@ -0,0 +1,38 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"github.com/slack-go/slack"
+	"strings"
+)
+
+type helpCommand struct {
+	router *Router
+}
+
+func (c *helpCommand) Name() string  { return "help" }
+func (c *helpCommand) Usage() string { return "[command]" }
+func (c *helpCommand) Help() string  { return "Show available commands or help for a single command." }
+
+func (c *helpCommand) Run(_ context.Context, req *Request) (*Response, error) {
+	if len(req.Args) > 0 {
+		cmd, ok := c.router.commands[strings.ToLower(req.Args[0])]
+		if !ok {
+			return nil, Usagef("Unknown command %q.", req.Args[0])
+		}
+		text := fmt.Sprintf("`%s`\n%s", c.router.usage(cmd), cmd.Help())
+		return &Response{Text: text, Blocks: []slack.Block{markdownSection(text)}}, nil
+	}
+
+	lines := []string{"*Available commands:*"}
+	for _, cmd := range c.router.Commands() {
+		lines = append(lines, fmt.Sprintf("• `%s` – %s", c.router.usage(cmd), cmd.Help()))
+	}
+	text := strings.Join(lines, "\n")
+	return &Response{Text: text, Blocks: []slack.Block{markdownSection(text)}}, nil
+}
+
+func markdownSection(text string) slack.Block {
+	return slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil)
+}
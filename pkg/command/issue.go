@@ -0,0 +1,33 @@
+package command
+
+import (
+	"context"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/unfurl"
+	"strings"
+)
+
+// IssueCommand shows the issue card.
+type IssueCommand struct {
+	Instances jiraclient.Instances
+	Unfurler  *unfurl.Unfurler
+}
+
+func (c *IssueCommand) Name() string  { return "issue" }
+func (c *IssueCommand) Usage() string { return "<KEY>" }
+func (c *IssueCommand) Help() string  { return "Show the Jira issue card." }
+
+func (c *IssueCommand) Run(ctx context.Context, req *Request) (*Response, error) {
+	if len(req.Args) != 1 {
+		return nil, Usagef("Exactly one issue key is required.")
+	}
+	key := strings.ToUpper(req.Args[0])
+	blocks, err := c.Unfurler.IssueBlocks(ctx, req.ChannelID, c.Instances.ForKey(key), key)
+	if err != nil {
+		return nil, err
+	}
+	if len(blocks) == 0 {
+		return Errorf("%s can't be shown in this channel.", key), nil
+	}
+	return &Response{Text: key, Blocks: blocks}, nil
+}
@@ -0,0 +1,207 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/identity"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/render"
+	"github.com/mfojtik/shodan/pkg/unfurl"
+	"github.com/slack-go/slack"
+	"strings"
+)
+
+const (
+	// commentCallbackID is the callback ID of the add comment modal.
+	commentCallbackID = "issue_comment_modal"
+	// commentBlockID and commentActionID identify the comment input in the modal.
+	commentBlockID  = "comment"
+	commentActionID = "comment_text"
+)
+
+// IssueActions handles the issue card actions: assigning the issue, moving it through the workflow and commenting.
+type IssueActions struct {
+	Instances   jiraclient.Instances
+	Unfurler    *unfurl.Unfurler
+	Identities  *identity.Resolver
+	SlackClient *slack.Client
+}
+
+// commentModal is the state the comment modal is opened with, so the card can be refreshed after submission.
+type commentModal struct {
+	Ref              *unfurl.IssueRef `json:"r"`
+	ChannelID        string           `json:"c"`
+	MessageTimeStamp string           `json:"m"`
+	ThreadTimeStamp  string           `json:"t,omitempty"`
+}
+
+func (c *IssueActions) ActionIDs() []string {
+	return []string{render.AssignToMeActionID, render.TransitionActionID, render.CommentActionID}
+}
+
+func (c *IssueActions) CallbackIDs() []string {
+	return []string{commentCallbackID}
+}
+
+func (c *IssueActions) HandleAction(ctx context.Context, action *Action) (*Response, error) {
+	ref, err := unfurl.ParseIssueRef(action.BlockID)
+	if err != nil {
+		return nil, err
+	}
+	instance := c.Instances.ByName(ref.Instance)
+	if instance == nil {
+		return nil, fmt.Errorf("unknown Jira instance %q", ref.Instance)
+	}
+
+	switch action.ActionID {
+	case render.AssignToMeActionID:
+		user, err := c.Identities.Authorize(ctx, instance, action.UserID, ref.Key, "ASSIGN_ISSUES", "ASSIGNABLE_USER")
+		if errors.Is(err, identity.ErrForbidden) {
+			return Errorf("Your Jira account is not allowed to assign %s to yourself.", ref.Key), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := instance.Assign(ctx, ref.Key, identity.QueryID(user)); err != nil {
+			return nil, fmt.Errorf("failed to assign %s: %v", ref.Key, err)
+		}
+	case render.TransitionActionID:
+		if resp, err := c.checkTransition(ctx, instance, ref.Key, action); resp != nil || err != nil {
+			return resp, err
+		}
+		if _, err := instance.Client.Issue.DoTransitionWithContext(ctx, ref.Key, action.Value); err != nil {
+			return nil, fmt.Errorf("failed to transition %s: %v", ref.Key, err)
+		}
+	case render.CommentActionID:
+		// checked also on submission, this just spares the user writing a comment that can't be added
+		_, err := c.Identities.Authorize(ctx, instance, action.UserID, ref.Key, "ADD_COMMENTS")
+		if errors.Is(err, identity.ErrForbidden) {
+			return Errorf("Your Jira account is not allowed to comment %s.", ref.Key), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return nil, c.openCommentModal(ctx, action, ref)
+	}
+	c.Unfurler.Invalidate(instance, ref.Key)
+	return c.refresh(ctx, instance, ref, action.ChannelID, action.MessageTimeStamp)
+}
+
+// checkTransition makes sure the transition offered by the card is still available and the Slack user
+// is allowed to transition the issue in Jira. It returns the response to show when the transition can't be done.
+func (c *IssueActions) checkTransition(ctx context.Context, instance *jiraclient.Instance, key string, action *Action) (*Response, error) {
+	_, err := c.Identities.Authorize(ctx, instance, action.UserID, key, "TRANSITION_ISSUES")
+	if errors.Is(err, identity.ErrForbidden) {
+		return Errorf("Your Jira account is not allowed to transition %s.", key), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	transitions, _, err := instance.Client.Issue.GetTransitionsWithContext(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transitions of %s: %v", key, err)
+	}
+	for _, t := range transitions {
+		if t.ID == action.Value {
+			return nil, nil
+		}
+	}
+	// the card offered outdated transitions, the next unfurl fetches the current ones
+	c.Unfurler.Invalidate(instance, key)
+	return Errorf("%s was changed meanwhile and this transition is no longer available, try again.", key), nil
+}
+
+func (c *IssueActions) HandleViewSubmission(ctx context.Context, submission *ViewSubmission) error {
+	modal := &commentModal{}
+	if err := json.Unmarshal([]byte(submission.PrivateMetadata), modal); err != nil || modal.Ref == nil {
+		return fmt.Errorf("invalid comment modal state %q", submission.PrivateMetadata)
+	}
+
+	instance := c.Instances.ByName(modal.Ref.Instance)
+	if instance == nil {
+		return fmt.Errorf("unknown Jira instance %q", modal.Ref.Instance)
+	}
+	err := c.addComment(ctx, instance, modal.Ref.Key, submission)
+	if errors.Is(err, identity.ErrForbidden) {
+		notify(ctx, c.SlackClient, modal.ChannelID, modal.ThreadTimeStamp, submission.UserID, Errorf("Your Jira account is not allowed to comment %s.", modal.Ref.Key).Text)
+		return nil
+	}
+	if err != nil {
+		notify(ctx, c.SlackClient, modal.ChannelID, modal.ThreadTimeStamp, submission.UserID, Errorf("Failed to comment %s: %v", modal.Ref.Key, err).Text)
+		return err
+	}
+
+	c.Unfurler.Invalidate(instance, modal.Ref.Key)
+	resp, err := c.refresh(ctx, instance, modal.Ref, modal.ChannelID, modal.MessageTimeStamp)
+	if err != nil || resp == nil {
+		return err
+	}
+	// cards posted by Shodan are updated directly, there is no response URL for modals
+	_, _, _, err = c.SlackClient.UpdateMessageContext(ctx, modal.ChannelID, modal.MessageTimeStamp,
+		slack.MsgOptionText(resp.Text, false),
+		slack.MsgOptionBlocks(resp.Blocks...),
+	)
+	return err
+}
+
+// addComment adds the submitted comment to the issue, when the user's Jira account is allowed to comment it.
+func (c *IssueActions) addComment(ctx context.Context, instance *jiraclient.Instance, key string, submission *ViewSubmission) error {
+	text := strings.TrimSpace(submission.Values[commentBlockID][commentActionID].Value)
+	if len(text) == 0 {
+		return nil
+	}
+	if _, err := c.Identities.Authorize(ctx, instance, submission.UserID, key, "ADD_COMMENTS"); err != nil {
+		return err
+	}
+
+	// comments are posted by Shodan account, so the author is mentioned explicitly
+	comment := &jira.Comment{Body: fmt.Sprintf("%s wrote in Slack:\n\n%s", c.Identities.Attribution(ctx, instance, submission.UserID), text)}
+	_, _, err := instance.Client.Issue.AddCommentWithContext(ctx, key, comment)
+	return err
+}
+
+// refresh updates the card after the issue changed. Unfurls are updated right away,
+// cards posted by Shodan are returned as response replacing the original message.
+func (c *IssueActions) refresh(ctx context.Context, instance *jiraclient.Instance, ref *unfurl.IssueRef, channelID, messageTimeStamp string) (*Response, error) {
+	if len(ref.URL) > 0 {
+		return nil, c.Unfurler.Refresh(ctx, channelID, messageTimeStamp, ref.URL)
+	}
+	blocks, err := c.Unfurler.IssueBlocks(ctx, channelID, instance, ref.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{Text: ref.Key, Blocks: blocks, ReplaceOriginal: true}, nil
+}
+
+func (c *IssueActions) openCommentModal(ctx context.Context, action *Action, ref *unfurl.IssueRef) error {
+	metadata, err := json.Marshal(&commentModal{
+		Ref:              ref,
+		ChannelID:        action.ChannelID,
+		MessageTimeStamp: action.MessageTimeStamp,
+		ThreadTimeStamp:  action.ThreadTimeStamp,
+	})
+	if err != nil {
+		return err
+	}
+	input := slack.NewPlainTextInputBlockElement(nil, commentActionID)
+	input.Multiline = true
+	_, err = c.SlackClient.OpenViewContext(ctx, action.TriggerID, slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		CallbackID:      commentCallbackID,
+		PrivateMetadata: string(metadata),
+		Title:           slack.NewTextBlockObject(slack.PlainTextType, "Comment "+ref.Key, false, false),
+		Submit:          slack.NewTextBlockObject(slack.PlainTextType, "Comment", false, false),
+		Close:           slack.NewTextBlockObject(slack.PlainTextType, "Cancel", false, false),
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			slack.NewInputBlock(commentBlockID, slack.NewTextBlockObject(slack.PlainTextType, "Comment", false, false), nil, input),
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open comment dialog: %v", err)
+	}
+	return nil
+}
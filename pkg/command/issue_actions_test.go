@@ -0,0 +1,106 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/render"
+	"github.com/mfojtik/shodan/pkg/unfurl"
+	"github.com/slack-go/slack"
+	"strings"
+	"testing"
+)
+
+func TestIssueActionsPermissions(t *testing.T) {
+	tests := []struct {
+		name        string
+		actionID    string
+		permissions map[string][]string
+		expectJira  []string
+		expectText  string
+	}{
+		{
+			name:        "assign to me",
+			actionID:    render.AssignToMeActionID,
+			permissions: map[string][]string{"ASSIGN_ISSUES/API-1": {"alice"}, "ASSIGNABLE_USER/API-1": {"alice"}},
+			expectJira:  []string{`PUT issue/API-1/assignee {"name":"alice"}`},
+			expectText:  "API-1",
+		},
+		{
+			name:        "assign to me without assign permission",
+			actionID:    render.AssignToMeActionID,
+			permissions: map[string][]string{"ASSIGNABLE_USER/API-1": {"alice"}},
+			expectText:  ":warning: Your Jira account is not allowed to assign API-1 to yourself.",
+		},
+		{
+			name:        "assign to me when not assignable",
+			actionID:    render.AssignToMeActionID,
+			permissions: map[string][]string{"ASSIGN_ISSUES/API-1": {"alice"}},
+			expectText:  ":warning: Your Jira account is not allowed to assign API-1 to yourself.",
+		},
+		{
+			name:       "transition without permission",
+			actionID:   render.TransitionActionID,
+			expectText: ":warning: Your Jira account is not allowed to transition API-1.",
+		},
+		{
+			name:       "comment without permission",
+			actionID:   render.CommentActionID,
+			expectText: ":warning: Your Jira account is not allowed to comment API-1.",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newFakeServices(t, test.permissions)
+			actions := &IssueActions{Instances: jiraclient.Instances{f.instance}, Unfurler: f.unfurler, Identities: f.identities, SlackClient: f.slackClient}
+
+			resp, err := actions.HandleAction(context.Background(), &Action{
+				ActionID:         test.actionID,
+				BlockID:          (&unfurl.IssueRef{Instance: "jira", Key: "API-1"}).BlockID(),
+				Value:            "21",
+				UserID:           "UALICE",
+				ChannelID:        "C1",
+				MessageTimeStamp: "1.1",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp == nil || resp.Text != test.expectText {
+				t.Errorf("expected response %q, got %#v", test.expectText, resp)
+			}
+			if strings.Join(f.jiraRequests, "\n") != strings.Join(test.expectJira, "\n") {
+				t.Errorf("expected Jira requests %q, got %q", test.expectJira, f.jiraRequests)
+			}
+		})
+	}
+}
+
+func TestIssueActionsCommentPermission(t *testing.T) {
+	for _, allowed := range []bool{true, false} {
+		permissions := map[string][]string{}
+		if allowed {
+			permissions["ADD_COMMENTS/API-1"] = []string{"alice"}
+		}
+		f := newFakeServices(t, permissions)
+		actions := &IssueActions{Instances: jiraclient.Instances{f.instance}, Unfurler: f.unfurler, Identities: f.identities, SlackClient: f.slackClient}
+
+		metadata, _ := json.Marshal(&commentModal{Ref: &unfurl.IssueRef{Instance: "jira", Key: "API-1"}, ChannelID: "C1", MessageTimeStamp: "1.1"})
+		err := actions.HandleViewSubmission(context.Background(), &ViewSubmission{
+			CallbackID:      commentCallbackID,
+			PrivateMetadata: string(metadata),
+			Values:          map[string]map[string]slack.BlockAction{commentBlockID: {commentActionID: {Value: "Looks good"}}},
+			UserID:          "UALICE",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		commented := len(f.jiraRequests) == 1 && strings.HasPrefix(f.jiraRequests[0], "POST issue/API-1/comment")
+		if commented != allowed {
+			t.Errorf("expected commented %v, got Jira requests %q", allowed, f.jiraRequests)
+		}
+		denied := len(f.posted) == 1 && f.posted[0] == "ephemeral::warning: Your Jira account is not allowed to comment API-1."
+		if denied == allowed {
+			t.Errorf("expected denial posted %v, got %q", !allowed, f.posted)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package command
+
+import (
+	"context"
+	"github.com/mfojtik/shodan/pkg/unfurl"
+	"strings"
+)
+
+// IssueKeysCommand turns unfurling of bare issue keys mentioned in the channel messages on or off.
+type IssueKeysCommand struct {
+	Listener *unfurl.MessageListener
+}
+
+func (c *IssueKeysCommand) Name() string  { return "issue-keys" }
+func (c *IssueKeysCommand) Usage() string { return "[on|off]" }
+func (c *IssueKeysCommand) Help() string {
+	return "Show or change whether issue keys mentioned in this channel (eg. \"see API-1\") are answered with issue cards."
+}
+
+func (c *IssueKeysCommand) Run(ctx context.Context, req *Request) (*Response, error) {
+	switch {
+	case len(req.Args) == 0:
+	case len(req.Args) == 1 && (strings.EqualFold(req.Args[0], "on") || strings.EqualFold(req.Args[0], "off")):
+		if err := c.Listener.SetIssueKeys(req.ChannelID, strings.EqualFold(req.Args[0], "on")); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, Usagef("Expected \"on\" or \"off\".")
+	}
+
+	enabled, err := c.Listener.IssueKeysEnabled(req.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return &Response{Text: "Issue keys mentioned in this channel are answered with issue cards in thread."}, nil
+	}
+	return &Response{Text: "Issue keys mentioned in this channel are ignored, only Jira links are unfurled."}, nil
+}
@@ -0,0 +1,113 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mfojtik/shodan/pkg/identity"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"strings"
+)
+
+// LinkAccountCommand shows the Jira account the invoking Slack user is mapped to. Workspace admins use it
+// to link Slack users to Jira accounts with a different email, which are not matched automatically.
+type LinkAccountCommand struct {
+	Instances  jiraclient.Instances
+	Identities *identity.Resolver
+}
+
+func (c *LinkAccountCommand) Name() string { return "link-account" }
+func (c *LinkAccountCommand) Usage() string {
+	return "[<jira-username>|reset] [<instance>] [<@slack-user>]"
+}
+func (c *LinkAccountCommand) Help() string {
+	return "Show your Jira account, it is matched by email. Workspace admins can link yours (or the mentioned user's) " +
+		"to a Jira account with a different email, \"reset\" goes back to matching by email."
+}
+
+func (c *LinkAccountCommand) Run(ctx context.Context, req *Request) (*Response, error) {
+	args, slackUserID := req.Args, req.UserID
+	if len(args) > 0 {
+		if id, ok := slackUserMention(args[len(args)-1]); ok {
+			args, slackUserID = args[:len(args)-1], id
+		}
+	}
+	if len(args) > 2 {
+		return nil, Usagef("Too many arguments.")
+	}
+	if len(args) == 0 && slackUserID != req.UserID {
+		return nil, Usagef("Jira username or \"reset\" is required to link other users.")
+	}
+	instance := c.Instances.Default()
+	if len(args) == 2 {
+		if instance = c.Instances.ByName(args[1]); instance == nil {
+			return nil, Usagef("Unknown Jira instance %q.", args[1])
+		}
+	}
+
+	switch {
+	case len(args) == 0:
+		return c.show(ctx, instance, req.UserID)
+	case strings.EqualFold(args[0], "reset"):
+		err := c.Identities.RemoveOverride(ctx, instance, req.UserID, slackUserID)
+		if errors.Is(err, identity.ErrNotAllowed) {
+			return Errorf("You can't reset the link of <@%s>, only workspace admins can.", slackUserID), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if slackUserID != req.UserID {
+			return &Response{Text: fmt.Sprintf("<@%s> is now matched to %s Jira account by email.", slackUserID, instance.DisplayName)}, nil
+		}
+		return c.show(ctx, instance, req.UserID)
+	}
+
+	username := strings.TrimPrefix(args[0], "@")
+	user, err := identity.FindUser(ctx, instance, username)
+	if errors.Is(err, identity.ErrNotMapped) {
+		return Errorf("There is no Jira user %q in %s.", username, instance.DisplayName), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = c.Identities.SetOverride(ctx, instance, req.UserID, slackUserID, user)
+	switch {
+	case errors.Is(err, identity.ErrNotAllowed):
+		return Errorf("Only workspace admins can link Jira accounts, ask one to run `link-account %s %s <@%s>`.", user.Name, instance.Name, slackUserID), nil
+	case errors.Is(err, identity.ErrAlreadyLinked):
+		return Errorf("%s Jira user *%s* is already linked to another Slack user.", instance.DisplayName, user.Name), nil
+	case err != nil:
+		return nil, err
+	}
+	if slackUserID != req.UserID {
+		return &Response{Text: fmt.Sprintf(":link: <@%s> is now linked to %s Jira user *%s*.", slackUserID, instance.DisplayName, user.Name)}, nil
+	}
+	return &Response{Text: fmt.Sprintf(":link: Your Slack account is now linked to %s Jira user *%s*.", instance.DisplayName, user.Name)}, nil
+}
+
+// slackUserMention returns the user ID of an escaped Slack mention argument, eg. "<@U123|alice>".
+func slackUserMention(arg string) (string, bool) {
+	if !strings.HasPrefix(arg, "<@") || !strings.HasSuffix(arg, ">") {
+		return "", false
+	}
+	id, _, _ := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(arg, "<@"), ">"), "|")
+	return id, len(id) > 0
+}
+
+// show reports the Jira account the user is currently mapped to and how.
+func (c *LinkAccountCommand) show(ctx context.Context, instance *jiraclient.Instance, slackUserID string) (*Response, error) {
+	if username, ok, err := c.Identities.Override(instance, slackUserID); err != nil {
+		return nil, err
+	} else if ok {
+		return &Response{Text: fmt.Sprintf("Your Slack account is linked to %s Jira user *%s*.", instance.DisplayName, username)}, nil
+	}
+
+	user, err := c.Identities.JiraUser(ctx, instance, slackUserID)
+	if errors.Is(err, identity.ErrNotMapped) {
+		return &Response{Text: fmt.Sprintf("I don't know your %s Jira account (%v). Ask a workspace admin to link it with `link-account <jira-username> %s <@%s>`.", instance.DisplayName, err, instance.Name, slackUserID)}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Response{Text: fmt.Sprintf("Your Slack account is matched by email to %s Jira user *%s*.", instance.DisplayName, identity.QueryID(user))}, nil
+}
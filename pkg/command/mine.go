@@ -0,0 +1,98 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/identity"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/render"
+	"sort"
+)
+
+// mineLimit is the maximum number of issues listed by /shodan mine.
+const mineLimit = 50
+
+// MineCommand lists open issues assigned to the invoking user.
+type MineCommand struct {
+	Instances  jiraclient.Instances
+	Identities *identity.Resolver
+}
+
+func (c *MineCommand) Name() string  { return "mine" }
+func (c *MineCommand) Usage() string { return "" }
+func (c *MineCommand) Help() string {
+	return "List your open assigned issues, grouped by status and sorted by priority."
+}
+
+func (c *MineCommand) Run(ctx context.Context, req *Request) (*Response, error) {
+	instance := c.Instances.Default()
+	user, err := c.Identities.JiraUser(ctx, instance, req.UserID)
+	if errors.Is(err, identity.ErrNotMapped) {
+		return Errorf("I don't know your Jira account: %v", err), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	jql := fmt.Sprintf("assignee = %q AND resolution = Unresolved ORDER BY priority DESC, updated DESC", identity.QueryID(user))
+	issues, resp, err := instance.Client.Issue.SearchWithContext(ctx, jql, &jira.SearchOptions{
+		MaxResults: mineLimit,
+		Fields:     []string{"summary", "status", "assignee", "priority"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search %q: %v", jql, err)
+	}
+	if len(issues) == 0 {
+		return &Response{Text: ":tada: You have no open issues assigned."}, nil
+	}
+
+	header := fmt.Sprintf(":clipboard: <%s|Your open issues>", instance.SearchURL(jql))
+	if resp != nil && resp.Total > len(issues) {
+		header += fmt.Sprintf(" (showing %d of %d)", len(issues), resp.Total)
+	}
+	return &Response{Text: "Your open issues", Blocks: render.IssueGroups(header, groupByStatus(instance, issues))}, nil
+}
+
+// groupByStatus groups issues by status, keeping their order within the group.
+// In progress statuses go first, followed by to do and any other statuses.
+func groupByStatus(instance *jiraclient.Instance, issues []jira.Issue) []render.IssueGroup {
+	var (
+		groups   []render.IssueGroup
+		category = map[string]string{}
+		index    = map[string]int{}
+	)
+	for i := range issues {
+		status, statusCategory := "Unknown", ""
+		if issues[i].Fields.Status != nil {
+			status, statusCategory = issues[i].Fields.Status.Name, issues[i].Fields.Status.StatusCategory.Key
+		}
+		if _, ok := index[status]; !ok {
+			index[status] = len(groups)
+			category[status] = statusCategory
+			groups = append(groups, render.IssueGroup{Title: status})
+		}
+		g := &groups[index[status]]
+		g.Lines = append(g.Lines, render.IssueLine(&issues[i], instance.BrowseURL(issues[i].Key)))
+	}
+
+	rank := func(statusCategory string) int {
+		switch statusCategory {
+		case jira.StatusCategoryInProgress:
+			return 0
+		case jira.StatusCategoryToDo:
+			return 1
+		default:
+			return 2
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		ri, rj := rank(category[groups[i].Title]), rank(category[groups[j].Title])
+		if ri != rj {
+			return ri < rj
+		}
+		return groups[i].Title < groups[j].Title
+	})
+	return groups
+}
@@ -0,0 +1,195 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/identity"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/render"
+	"github.com/mfojtik/shodan/pkg/store"
+	"github.com/mfojtik/shodan/pkg/unfurl"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// reactionCreatedBucket records issues created by reactions, keyed by "<channel>/<message>", so every message is filed once.
+	reactionCreatedBucket = "reaction-created"
+	// defaultIssueType is the type of issues created by reactions when the action does not name one.
+	defaultIssueType = "Task"
+)
+
+// reactionPermissions are the Jira permissions the user needs for the reaction actions updating issues.
+var reactionPermissions = map[string][]string{
+	"assign":     {"ASSIGN_ISSUES", "ASSIGNABLE_USER"},
+	"transition": {"TRANSITION_ISSUES"},
+}
+
+// ReactionActions runs Jira actions configured for emoji reactions on messages and confirms them in the message thread.
+type ReactionActions struct {
+	Instances   jiraclient.Instances
+	Unfurler    *unfurl.Unfurler
+	Identities  *identity.Resolver
+	SlackClient *slack.Client
+	Store       store.Store
+	// Actions are the emoji actions per channel, "*" applies to all channels
+	Actions map[string]map[string]string
+}
+
+// reactionIssue is the issue created from a message.
+type reactionIssue struct {
+	Instance string `json:"instance"`
+	Key      string `json:"key"`
+}
+
+// HandleReactionAdded runs the action configured for the reaction in the channel.
+// Assign and transition act on all issues linked or mentioned in the message, create files the message as a new issue.
+func (c *ReactionActions) HandleReactionAdded(ev *slackevents.ReactionAddedEvent) error {
+	action := c.action(ev.Item.Channel, ev.Reaction)
+	if len(action) == 0 || ev.Item.Type != "message" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	message, err := unfurl.GetMessage(ctx, c.SlackClient, ev.Item.Channel, ev.Item.Timestamp)
+	if err != nil {
+		return err
+	}
+	thread := message.ThreadTimestamp
+	if len(thread) == 0 {
+		thread = message.Timestamp
+	}
+
+	verb, arg, _ := strings.Cut(action, ":")
+	if verb == "create" {
+		err = c.create(ctx, ev.User, ev.Item.Channel, thread, message, arg)
+	} else {
+		issues := unfurl.FindIssues(message.Text, c.Instances)
+		if len(issues) == 0 {
+			notify(ctx, c.SlackClient, ev.Item.Channel, thread, ev.User, fmt.Sprintf(":%s: did nothing, the message does not mention any Jira issue.", ev.Reaction))
+			return nil
+		}
+		for _, issue := range issues {
+			if err = c.update(ctx, ev.User, ev.Item.Channel, thread, issue, verb, arg); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		notify(ctx, c.SlackClient, ev.Item.Channel, thread, ev.User, Errorf(":%s: failed: %v", ev.Reaction, err).Text)
+	}
+	return err
+}
+
+// action returns the action of the emoji in the channel, channel specific actions take precedence.
+func (c *ReactionActions) action(channel, emoji string) string {
+	if action, ok := c.Actions[channel][emoji]; ok {
+		return action
+	}
+	return c.Actions["*"][emoji]
+}
+
+// update assigns or transitions the issue on behalf of the Slack user and confirms it in the thread.
+// Issues the visibility policy restricts in the channel are skipped, and the user's Jira account must have
+// the permission for the action, as it is done with Shodan account.
+func (c *ReactionActions) update(ctx context.Context, slackUserID, channel, thread string, issue unfurl.IssueKey, verb, status string) error {
+	permissions, ok := reactionPermissions[verb]
+	if !ok {
+		return fmt.Errorf("unknown action %q", verb)
+	}
+	if visible, err := c.Unfurler.Visible(ctx, channel, issue.Instance, issue.Key); err != nil || !visible {
+		return err
+	}
+	user, err := c.Identities.Authorize(ctx, issue.Instance, slackUserID, issue.Key, permissions...)
+	if errors.Is(err, identity.ErrForbidden) {
+		notify(ctx, c.SlackClient, channel, thread, slackUserID, Errorf("Your Jira account is not allowed to %s %s.", verb, issue.Key).Text)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("<%s|%s>", issue.Instance.BrowseURL(issue.Key), issue.Key)
+	var text string
+	switch verb {
+	case "assign":
+		if err := issue.Instance.Assign(ctx, issue.Key, identity.QueryID(user)); err != nil {
+			return fmt.Errorf("failed to assign %s: %v", issue.Key, err)
+		}
+		text = fmt.Sprintf(":eyes: %s is now assigned to <@%s>.", link, slackUserID)
+	case "transition":
+		newStatus, err := issue.Instance.TransitionTo(ctx, issue.Key, status)
+		if err != nil {
+			return err
+		}
+		text = fmt.Sprintf(":arrow_forward: <@%s> moved %s to *%s*.", slackUserID, link, render.Escape(newStatus))
+	}
+	c.Unfurler.Invalidate(issue.Instance, issue.Key)
+
+	_, _, err = c.SlackClient.PostMessageContext(ctx, channel, slack.MsgOptionTS(thread), slack.MsgOptionText(text, false))
+	return err
+}
+
+// create files the message as a new issue in the project ("<project>[:<issue type>]"), once per message.
+// The message is claimed (recorded without the key) before filing, so concurrent reactions don't file it twice.
+func (c *ReactionActions) create(ctx context.Context, slackUserID, channel, thread string, message *slack.Message, project string) (err error) {
+	createdKey := channel + "/" + message.Timestamp
+	created := &reactionIssue{}
+	claimed := false
+	if err := c.Store.Batch(func(tx store.Store) error {
+		if ok, err := tx.Get(reactionCreatedBucket, createdKey, created); err != nil || ok {
+			return err
+		}
+		claimed = true
+		return tx.Put(reactionCreatedBucket, createdKey, created)
+	}); err != nil {
+		return err
+	}
+	if !claimed {
+		if instance := c.Instances.ByName(created.Instance); instance != nil && len(created.Key) > 0 {
+			notify(ctx, c.SlackClient, channel, thread, slackUserID, fmt.Sprintf("This message was already filed as <%s|%s>.", instance.BrowseURL(created.Key), created.Key))
+		}
+		return nil
+	}
+	defer func() {
+		if err != nil {
+			// release the claim, so the message can be filed again
+			if err := c.Store.Delete(reactionCreatedBucket, createdKey); err != nil {
+				log.Printf("failed to release %s: %v", createdKey, err)
+			}
+		}
+	}()
+
+	projectKey, issueType, _ := strings.Cut(project, ":")
+	if len(issueType) == 0 {
+		issueType = defaultIssueType
+	}
+	instance := c.Instances.ForProject(projectKey)
+	if instance == nil {
+		instance = c.Instances.Default()
+	}
+
+	summary, _, _ := strings.Cut(strings.TrimSpace(message.Text), "\n")
+	if len(summary) == 0 {
+		summary = "Issue filed from Slack"
+	}
+	issue, err := createFromMessage(ctx, c.SlackClient, c.Identities, instance, &jira.IssueFields{
+		Project:     jira.Project{Key: projectKey},
+		Type:        jira.IssueType{Name: issueType},
+		Summary:     render.Truncate(summary, summaryMaxLength),
+		Description: message.Text,
+	}, slackUserID, channel, message.Timestamp)
+	if err != nil {
+		return err
+	}
+	if err := c.Store.Put(reactionCreatedBucket, createdKey, &reactionIssue{Instance: instance.Name, Key: issue.Key}); err != nil {
+		return err
+	}
+	return announceCreated(ctx, c.SlackClient, instance, issue, slackUserID, channel, thread)
+}
@@ -0,0 +1,196 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mfojtik/shodan/pkg/config"
+	"github.com/mfojtik/shodan/pkg/identity"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/policy"
+	"github.com/mfojtik/shodan/pkg/store"
+	"github.com/mfojtik/shodan/pkg/unfurl"
+	"github.com/slack-go/slack"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServices serves the Slack and Jira endpoints the commands use.
+// Slack users U<NAME> have email <name>@example.com, matching Jira user <name>.
+type fakeServices struct {
+	lock sync.Mutex
+	// permissions are the Jira users having the permission, by "<permission>/<issue key>"
+	permissions map[string][]string
+	// jiraRequests are "METHOD path body" of the Jira requests changing issues
+	jiraRequests []string
+	// posted are the texts of the Slack messages, ephemeral messages are prefixed with "ephemeral:"
+	posted []string
+
+	instance    *jiraclient.Instance
+	slackClient *slack.Client
+	unfurler    *unfurl.Unfurler
+	identities  *identity.Resolver
+}
+
+func newFakeServices(t *testing.T, permissions map[string][]string, rules ...*config.PolicyRule) *fakeServices {
+	t.Helper()
+	f := &fakeServices{permissions: permissions}
+	jiraServer := httptest.NewServer(http.HandlerFunc(f.serveJira))
+	t.Cleanup(jiraServer.Close)
+	slackServer := httptest.NewServer(http.HandlerFunc(f.serveSlack))
+	t.Cleanup(slackServer.Close)
+
+	var err error
+	if f.instance, err = jiraclient.NewInstance("jira", "Jira", jiraServer.URL, "token"); err != nil {
+		t.Fatal(err)
+	}
+	f.slackClient = slack.New("xoxb-test", slack.OptionAPIURL(slackServer.URL+"/"))
+	f.identities = identity.NewResolver(f.slackClient, store.NewMemory())
+	f.unfurler = unfurl.New(jiraclient.Instances{f.instance}, f.slackClient, policy.New(rules), f.identities,
+		&config.UnfurlConfig{Workers: 1, Deadline: time.Second}, &config.CacheConfig{})
+	return f
+}
+
+func (f *fakeServices) serveJira(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/json")
+	path := strings.TrimPrefix(r.URL.Path, "/rest/api/2/")
+	switch {
+	case path == "user/search":
+		name, _, _ := strings.Cut(r.URL.Query().Get("username"), "@")
+		fmt.Fprintf(w, `[{"name": %q, "emailAddress": "%s@example.com", "active": true}]`, name, name)
+	case path == "user/permission/search":
+		q := r.URL.Query()
+		f.lock.Lock()
+		allowed := f.permissions[q.Get("permissions")+"/"+q.Get("issueKey")]
+		f.lock.Unlock()
+		var users []string
+		for _, name := range allowed {
+			if name == q.Get("username") {
+				users = append(users, fmt.Sprintf(`{"name": %q}`, name))
+			}
+		}
+		fmt.Fprintf(w, "[%s]", strings.Join(users, ","))
+	case r.Method == http.MethodGet && strings.HasSuffix(path, "/transitions"):
+		w.Write([]byte(`{"transitions": [{"id": "21", "name": "Close", "to": {"name": "Closed"}}]}`))
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "issue/"):
+		key := strings.TrimPrefix(path, "issue/")
+		project, _, _ := strings.Cut(key, "-")
+		fmt.Fprintf(w, `{"key": %q, "fields": {"summary": "Issue %s", "project": {"key": %q}, "status": {"name": "New"}, "issuetype": {"name": "Bug"}}}`, key, key, project)
+	default:
+		f.lock.Lock()
+		f.jiraRequests = append(f.jiraRequests, strings.TrimSpace(r.Method+" "+path+" "+string(body)))
+		f.lock.Unlock()
+		switch {
+		case strings.HasSuffix(path, "/comment"):
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": "10000"}`))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+func (f *fakeServices) serveSlack(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/users.info":
+		id := r.FormValue("user")
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "user": slack.User{
+			ID:      id,
+			Profile: slack.UserProfile{Email: strings.ToLower(strings.TrimPrefix(id, "U")) + "@example.com"},
+		}})
+	case "/chat.postMessage", "/chat.postEphemeral":
+		text := r.FormValue("text")
+		if r.URL.Path == "/chat.postEphemeral" {
+			text = "ephemeral:" + text
+		}
+		f.lock.Lock()
+		f.posted = append(f.posted, text)
+		f.lock.Unlock()
+		w.Write([]byte(`{"ok": true, "channel": "C1", "ts": "2.2", "message_ts": "2.2"}`))
+	case "/chat.update":
+		w.Write([]byte(`{"ok": true, "channel": "C1", "ts": "1.1"}`))
+	default:
+		w.Write([]byte(`{"ok": false, "error": "unknown_method"}`))
+	}
+}
+
+func TestReactionUpdatePermissions(t *testing.T) {
+	tests := []struct {
+		name         string
+		verb, key    string
+		permissions  map[string][]string
+		expectJira   []string
+		expectPosted string
+	}{
+		{
+			name:         "transition allowed",
+			verb:         "transition",
+			key:          "API-1",
+			permissions:  map[string][]string{"TRANSITION_ISSUES/API-1": {"alice"}},
+			expectJira:   []string{`POST issue/API-1/transitions {"update":{},"transition":{"id":"21"},"fields":{}}`},
+			expectPosted: "<@UALICE> moved",
+		},
+		{
+			name:         "transition forbidden",
+			verb:         "transition",
+			key:          "API-1",
+			permissions:  map[string][]string{"TRANSITION_ISSUES/API-1": {"bob"}},
+			expectPosted: "ephemeral::warning: Your Jira account is not allowed to transition API-1.",
+		},
+		{
+			name:         "assign allowed",
+			verb:         "assign",
+			key:          "API-1",
+			permissions:  map[string][]string{"ASSIGN_ISSUES/API-1": {"alice"}, "ASSIGNABLE_USER/API-1": {"alice"}},
+			expectJira:   []string{`PUT issue/API-1/assignee {"name":"alice"}`},
+			expectPosted: "is now assigned to <@UALICE>",
+		},
+		{
+			name:         "assign to user who is not assignable",
+			verb:         "assign",
+			key:          "API-1",
+			permissions:  map[string][]string{"ASSIGN_ISSUES/API-1": {"alice"}},
+			expectPosted: "ephemeral::warning: Your Jira account is not allowed to assign API-1.",
+		},
+		{
+			name:        "restricted issue is skipped silently",
+			verb:        "transition",
+			key:         "SEC-1",
+			permissions: map[string][]string{"TRANSITION_ISSUES/SEC-1": {"alice"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newFakeServices(t, test.permissions, &config.PolicyRule{Projects: []string{"SEC"}, Action: "redact"})
+			reactions := &ReactionActions{
+				Instances:   jiraclient.Instances{f.instance},
+				Unfurler:    f.unfurler,
+				Identities:  f.identities,
+				SlackClient: f.slackClient,
+			}
+			issue := unfurl.IssueKey{Instance: f.instance, Key: test.key}
+			if err := reactions.update(context.Background(), "UALICE", "C1", "1.1", issue, test.verb, "Closed"); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(f.jiraRequests, "\n") != strings.Join(test.expectJira, "\n") {
+				t.Errorf("expected Jira requests %q, got %q", test.expectJira, f.jiraRequests)
+			}
+			if len(test.expectPosted) == 0 {
+				if len(f.posted) > 0 {
+					t.Errorf("expected nothing posted, got %q", f.posted)
+				}
+				return
+			}
+			if len(f.posted) != 1 || !strings.Contains(f.posted[0], test.expectPosted) {
+				t.Errorf("expected posted %q, got %q", test.expectPosted, f.posted)
+			}
+		})
+	}
+}
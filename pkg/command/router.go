@@ -0,0 +1,386 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/slack-go/slack"
+	"log"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Command is a single /shodan subcommand.
+type Command interface {
+	// Name is the subcommand name, eg. "issue" for "/shodan issue API-1299".
+	Name() string
+	// Usage is the synopsis of the arguments, eg. "<KEY>".
+	Usage() string
+	// Help is one line description of what the command does.
+	Help() string
+	// Run executes the command. Errors are reported back to the user as ephemeral messages.
+	Run(ctx context.Context, req *Request) (*Response, error)
+}
+
+// RawArgsCommand is a command interpreting RawArgs itself (eg. JQL or free text).
+// Its Args are split on whitespace only, so apostrophes (eg. "can't login") don't break the command.
+type RawArgsCommand interface {
+	Command
+	UsesRawArgs()
+}
+
+// Request is a parsed invocation of a subcommand.
+type Request struct {
+	UserID    string
+	UserName  string
+	ChannelID string
+	TriggerID string
+	// Args are the arguments following the subcommand name.
+	Args []string
+	// RawArgs is the unparsed text following the subcommand name, with quotes preserved (eg. for JQL).
+	RawArgs string
+}
+
+// Response is the message sent back to Slack.
+type Response struct {
+	Text   string
+	Blocks []slack.Block
+	// InChannel makes the response visible to everyone in the channel, responses are ephemeral by default.
+	InChannel bool
+	// ReplaceOriginal replaces the message the interaction came from (eg. when paging through results).
+	ReplaceOriginal bool
+}
+
+// UsageError is returned by commands when they are called with invalid arguments.
+type UsageError struct {
+	Message string
+}
+
+func (e *UsageError) Error() string {
+	return e.Message
+}
+
+// Usagef returns UsageError with formatted message.
+func Usagef(format string, args ...interface{}) error {
+	return &UsageError{Message: fmt.Sprintf(format, args...)}
+}
+
+// ActionHandler handles interactions (button clicks, menu selections) with messages posted by commands.
+type ActionHandler interface {
+	// ActionIDs are the Block Kit action IDs handled by this handler.
+	ActionIDs() []string
+	// HandleAction handles the action. The response replaces the original message when ReplaceOriginal is set.
+	HandleAction(ctx context.Context, action *Action) (*Response, error)
+}
+
+// Action is a block action triggered by a user.
+type Action struct {
+	ActionID string
+	// BlockID is the ID of the block the action is in
+	BlockID string
+	// Value is the button value or the value of the selected option
+	Value string
+
+	UserID    string
+	ChannelID string
+	TriggerID string
+	// MessageTimeStamp is the timestamp of the message the action came from
+	MessageTimeStamp string
+	// ThreadTimeStamp is the timestamp of the thread the message is in
+	ThreadTimeStamp string
+	// View is the modal the action came from, nil for actions in messages
+	View *slack.View
+}
+
+// ViewHandler handles submissions of modals opened by commands or actions.
+type ViewHandler interface {
+	// CallbackIDs are the callback IDs of the handled modals.
+	CallbackIDs() []string
+	// HandleViewSubmission handles the submitted modal. The modal is closed right away,
+	// so the handler is responsible for reporting any errors to the user.
+	HandleViewSubmission(ctx context.Context, submission *ViewSubmission) error
+}
+
+// ViewValidator is a ViewHandler checking the submitted modal before it is closed.
+type ViewValidator interface {
+	ViewHandler
+	// ValidateViewSubmission returns error messages by input block ID, the modal then stays open showing them.
+	// It runs before the submission is acknowledged, so it must not wait for Jira.
+	ValidateViewSubmission(submission *ViewSubmission) map[string]string
+}
+
+// ViewSubmission is a modal submitted by a user.
+type ViewSubmission struct {
+	CallbackID string
+	// PrivateMetadata is the state the modal was opened with
+	PrivateMetadata string
+	// Values are the submitted inputs by block ID and action ID
+	Values map[string]map[string]slack.BlockAction
+
+	UserID   string
+	UserName string
+}
+
+// ShortcutHandler handles message shortcuts.
+type ShortcutHandler interface {
+	// ShortcutIDs are the callback IDs of the handled shortcuts, as configured in the Slack app.
+	ShortcutIDs() []string
+	// HandleShortcut handles the shortcut, reporting any errors to the user.
+	HandleShortcut(ctx context.Context, shortcut *Shortcut) error
+}
+
+// Shortcut is a message shortcut triggered by a user.
+type Shortcut struct {
+	CallbackID string
+	UserID     string
+	ChannelID  string
+	TriggerID  string
+	// MessageText and MessageTimeStamp describe the message the shortcut was triggered on
+	MessageText      string
+	MessageTimeStamp string
+	// ThreadTimeStamp is the timestamp of the thread the message is in
+	ThreadTimeStamp string
+}
+
+// Router dispatches slash commands to the registered subcommands.
+type Router struct {
+	// name of the slash command, eg. "/shodan"
+	name      string
+	commands  map[string]Command
+	actions   map[string]ActionHandler
+	views     map[string]ViewHandler
+	shortcuts map[string]ShortcutHandler
+}
+
+func NewRouter(name string, commands ...Command) *Router {
+	r := &Router{name: name, commands: map[string]Command{}, actions: map[string]ActionHandler{}, views: map[string]ViewHandler{}, shortcuts: map[string]ShortcutHandler{}}
+	r.Register(&helpCommand{router: r})
+	for _, c := range commands {
+		r.Register(c)
+	}
+	return r
+}
+
+// Register adds the subcommand, replacing any command with the same name.
+// When the command also implements ActionHandler or ViewHandler, its actions and modals are registered as well.
+func (r *Router) Register(c Command) {
+	r.commands[c.Name()] = c
+	if handler, ok := c.(ActionHandler); ok {
+		r.RegisterActions(handler)
+	}
+	if handler, ok := c.(ViewHandler); ok {
+		r.RegisterViews(handler)
+	}
+}
+
+// RegisterActions routes the handler action IDs to the handler.
+func (r *Router) RegisterActions(handler ActionHandler) {
+	for _, id := range handler.ActionIDs() {
+		r.actions[id] = handler
+	}
+}
+
+// RegisterViews routes submissions of the handler modals to the handler.
+func (r *Router) RegisterViews(handler ViewHandler) {
+	for _, id := range handler.CallbackIDs() {
+		r.views[id] = handler
+	}
+}
+
+// RegisterShortcuts routes the handler shortcuts to the handler.
+func (r *Router) RegisterShortcuts(handler ShortcutHandler) {
+	for _, id := range handler.ShortcutIDs() {
+		r.shortcuts[id] = handler
+	}
+}
+
+// Commands returns registered commands sorted by name.
+func (r *Router) Commands() []Command {
+	var result []Command
+	for _, c := range r.commands {
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name() < result[j].Name() })
+	return result
+}
+
+// Handle parses the slash command and runs the subcommand. It always returns a response to send back.
+// The subcommand is the first word, its arguments are parsed only when the subcommand does not read RawArgs itself.
+func (r *Router) Handle(ctx context.Context, cmd slack.SlashCommand) *Response {
+	name := "help"
+	if fields := strings.Fields(cmd.Text); len(fields) > 0 {
+		name = fields[0]
+	}
+	c, ok := r.commands[strings.ToLower(name)]
+	if !ok {
+		return Errorf("Unknown command %q. Run `%s help` to see what I can do.", name, r.name)
+	}
+
+	raw := rawArgs(cmd.Text)
+	args := strings.Fields(raw)
+	if _, ok := c.(RawArgsCommand); !ok {
+		var err error
+		if args, err = ParseArgs(raw); err != nil {
+			return Errorf("%v\nUsage: `%s`", err, r.usage(c))
+		}
+	}
+
+	resp, err := c.Run(ctx, &Request{
+		UserID:    cmd.UserID,
+		UserName:  cmd.UserName,
+		ChannelID: cmd.ChannelID,
+		TriggerID: cmd.TriggerID,
+		Args:      args,
+		RawArgs:   raw,
+	})
+	var usageErr *UsageError
+	switch {
+	case errors.As(err, &usageErr):
+		return Errorf("%s\nUsage: `%s`", usageErr.Message, r.usage(c))
+	case err != nil:
+		log.Printf("command %q failed: %v", cmd.Text, err)
+		return Errorf("%s failed: %v", c.Name(), err)
+	case resp == nil:
+		return &Response{Text: "Done."}
+	}
+	return resp
+}
+
+// HandleAction runs the handler registered for the block action.
+// It returns nil when there is no handler or the handler has nothing to respond with.
+func (r *Router) HandleAction(ctx context.Context, callback *slack.InteractionCallback, blockAction *slack.BlockAction) *Response {
+	handler, ok := r.actions[blockAction.ActionID]
+	if !ok {
+		log.Printf("no handler for action %q", blockAction.ActionID)
+		return nil
+	}
+
+	action := &Action{
+		ActionID:         blockAction.ActionID,
+		BlockID:          blockAction.BlockID,
+		Value:            blockAction.Value,
+		UserID:           callback.User.ID,
+		ChannelID:        callback.Channel.ID,
+		TriggerID:        callback.TriggerID,
+		MessageTimeStamp: callback.Container.MessageTs,
+		ThreadTimeStamp:  callback.Container.ThreadTs,
+	}
+	if len(action.Value) == 0 {
+		action.Value = blockAction.SelectedOption.Value
+	}
+	if len(action.ChannelID) == 0 {
+		action.ChannelID = callback.Container.ChannelID
+	}
+	if len(callback.View.ID) > 0 {
+		action.View = &callback.View
+	}
+
+	resp, err := handler.HandleAction(ctx, action)
+	if err != nil {
+		log.Printf("action %q failed: %v", action.ActionID, err)
+		return Errorf("%v", err)
+	}
+	return resp
+}
+
+// HandleViewSubmission runs the handler registered for the submitted modal.
+func (r *Router) HandleViewSubmission(ctx context.Context, callback *slack.InteractionCallback) error {
+	handler, ok := r.views[callback.View.CallbackID]
+	if !ok {
+		return fmt.Errorf("no handler for view %q", callback.View.CallbackID)
+	}
+	return handler.HandleViewSubmission(ctx, viewSubmission(callback))
+}
+
+// ValidateViewSubmission returns the errors to show in the submitted modal, by input block ID.
+// Submissions of modals without validation are always valid.
+func (r *Router) ValidateViewSubmission(callback *slack.InteractionCallback) map[string]string {
+	validator, ok := r.views[callback.View.CallbackID].(ViewValidator)
+	if !ok {
+		return nil
+	}
+	return validator.ValidateViewSubmission(viewSubmission(callback))
+}
+
+func viewSubmission(callback *slack.InteractionCallback) *ViewSubmission {
+	var values map[string]map[string]slack.BlockAction
+	if callback.View.State != nil {
+		values = callback.View.State.Values
+	}
+	return &ViewSubmission{
+		CallbackID:      callback.View.CallbackID,
+		PrivateMetadata: callback.View.PrivateMetadata,
+		Values:          values,
+		UserID:          callback.User.ID,
+		UserName:        callback.User.Name,
+	}
+}
+
+// HandleShortcut runs the handler registered for the message shortcut.
+func (r *Router) HandleShortcut(ctx context.Context, callback *slack.InteractionCallback) error {
+	handler, ok := r.shortcuts[callback.CallbackID]
+	if !ok {
+		return fmt.Errorf("no handler for shortcut %q", callback.CallbackID)
+	}
+	shortcut := &Shortcut{
+		CallbackID:       callback.CallbackID,
+		UserID:           callback.User.ID,
+		ChannelID:        callback.Channel.ID,
+		TriggerID:        callback.TriggerID,
+		MessageText:      callback.Message.Text,
+		MessageTimeStamp: callback.MessageTs,
+		ThreadTimeStamp:  callback.Message.ThreadTimestamp,
+	}
+	if len(shortcut.MessageTimeStamp) == 0 {
+		shortcut.MessageTimeStamp = callback.Message.Timestamp
+	}
+	return handler.HandleShortcut(ctx, shortcut)
+}
+
+// rawArgs returns the command text without the leading subcommand name.
+func rawArgs(text string) string {
+	text = strings.TrimSpace(smartQuotes.Replace(text))
+	i := strings.IndexFunc(text, unicode.IsSpace)
+	if i < 0 {
+		return ""
+	}
+	return strings.TrimSpace(text[i:])
+}
+
+func (r *Router) usage(c Command) string {
+	return strings.TrimSpace(fmt.Sprintf("%s %s %s", r.name, c.Name(), c.Usage()))
+}
+
+// Errorf returns ephemeral error response.
+func Errorf(format string, args ...interface{}) *Response {
+	return &Response{Text: ":warning: " + fmt.Sprintf(format, args...)}
+}
+
+// notify posts ephemeral message to the user in the channel, or in the thread when threadTimeStamp is set.
+// It is used to report results of interactions that have no response URL (eg. modals).
+func notify(ctx context.Context, slackClient *slack.Client, channelID, threadTimeStamp, userID, text string) {
+	options := []slack.MsgOption{slack.MsgOptionText(text, false)}
+	if len(threadTimeStamp) > 0 {
+		options = append(options, slack.MsgOptionTS(threadTimeStamp))
+	}
+	if _, err := slackClient.PostEphemeralContext(ctx, channelID, userID, options...); err != nil {
+		log.Printf("failed to notify %s: %v", userID, err)
+	}
+}
+
+// WebhookMessage converts the response to message posted to the slash command response URL.
+func (r *Response) WebhookMessage() *slack.WebhookMessage {
+	msg := &slack.WebhookMessage{
+		Text:            r.Text,
+		ResponseType:    slack.ResponseTypeEphemeral,
+		ReplaceOriginal: r.ReplaceOriginal,
+	}
+	if r.InChannel {
+		msg.ResponseType = slack.ResponseTypeInChannel
+	}
+	if len(r.Blocks) > 0 {
+		msg.Blocks = &slack.Blocks{BlockSet: r.Blocks}
+	}
+	return msg
+}
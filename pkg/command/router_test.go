@@ -0,0 +1,193 @@
+package command
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"reflect"
+	"testing"
+)
+
+// recordingCommand remembers the request it was run with.
+type recordingCommand struct {
+	name string
+	req  *Request
+}
+
+func (c *recordingCommand) Name() string  { return c.name }
+func (c *recordingCommand) Usage() string { return "<args>" }
+func (c *recordingCommand) Help() string  { return "Records the request." }
+func (c *recordingCommand) Run(_ context.Context, req *Request) (*Response, error) {
+	c.req = req
+	return &Response{Text: "ok"}, nil
+}
+
+// rawRecordingCommand reads RawArgs itself, like search.
+type rawRecordingCommand struct {
+	recordingCommand
+}
+
+func (c *rawRecordingCommand) UsesRawArgs() {}
+
+func TestHandleRawArgsWithApostrophes(t *testing.T) {
+	tests := []struct {
+		text    string
+		rawArgs string
+		args    []string
+	}{
+		{text: "search can't login", rawArgs: "can't login", args: []string{"can't", "login"}},
+		{text: "search can’t login", rawArgs: "can't login", args: []string{"can't", "login"}},
+		{text: `search summary ~ "don't"`, rawArgs: `summary ~ "don't"`, args: []string{"summary", "~", `"don't"`}},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			search := &rawRecordingCommand{recordingCommand{name: "search"}}
+			resp := NewRouter("/shodan", search).Handle(context.Background(), slack.SlashCommand{Text: test.text})
+			if resp.Text != "ok" {
+				t.Fatalf("unexpected response %q", resp.Text)
+			}
+			if search.req.RawArgs != test.rawArgs {
+				t.Errorf("expected raw args %q, got %q", test.rawArgs, search.req.RawArgs)
+			}
+			if !reflect.DeepEqual(search.req.Args, test.args) {
+				t.Errorf("expected args %q, got %q", test.args, search.req.Args)
+			}
+		})
+	}
+}
+
+// usageCommand always fails with usage error.
+type usageCommand struct{}
+
+func (c *usageCommand) Name() string  { return "broken" }
+func (c *usageCommand) Usage() string { return "<KEY>" }
+func (c *usageCommand) Help() string  { return "Always fails." }
+func (c *usageCommand) Run(context.Context, *Request) (*Response, error) {
+	return nil, Usagef("Issue key is required.")
+}
+
+func TestHandleDispatch(t *testing.T) {
+	issue := &recordingCommand{name: "issue"}
+	router := NewRouter("/shodan", issue)
+	resp := router.Handle(context.Background(), slack.SlashCommand{
+		Text:      `  ISSUE API-1 "two words"  `,
+		UserID:    "U1",
+		UserName:  "alice",
+		ChannelID: "C1",
+		TriggerID: "T1",
+	})
+	if resp.Text != "ok" {
+		t.Fatalf("unexpected response %q", resp.Text)
+	}
+	expected := &Request{
+		UserID:    "U1",
+		UserName:  "alice",
+		ChannelID: "C1",
+		TriggerID: "T1",
+		Args:      []string{"API-1", "two words"},
+		RawArgs:   `API-1 "two words"`,
+	}
+	if !reflect.DeepEqual(issue.req, expected) {
+		t.Errorf("expected request %+v, got %+v", expected, issue.req)
+	}
+}
+
+func TestHandleErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{
+			name:     "unknown command",
+			text:     "frobnicate API-1",
+			expected: ":warning: Unknown command \"frobnicate\". Run `/shodan help` to see what I can do.",
+		},
+		{
+			name:     "usage error",
+			text:     "broken",
+			expected: ":warning: Issue key is required.\nUsage: `/shodan broken <KEY>`",
+		},
+		{
+			name:     "apostrophe in parsed command",
+			text:     "issue can't",
+			expected: ":warning: unterminated quote in command arguments\nUsage: `/shodan issue <args>`",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := NewRouter("/shodan", &recordingCommand{name: "issue"}, &usageCommand{})
+			if resp := router.Handle(context.Background(), slack.SlashCommand{Text: test.text}); resp.Text != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, resp.Text)
+			}
+		})
+	}
+}
+
+func TestHandleHelp(t *testing.T) {
+	router := NewRouter("/shodan", &recordingCommand{name: "issue"}, &usageCommand{})
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{
+			text: "",
+			expected: "*Available commands:*\n" +
+				"• `/shodan broken <KEY>` – Always fails.\n" +
+				"• `/shodan help [command]` – Show available commands or help for a single command.\n" +
+				"• `/shodan issue <args>` – Records the request.",
+		},
+		{
+			text:     "help issue",
+			expected: "`/shodan issue <args>`\nRecords the request.",
+		},
+		{
+			text:     "help nope",
+			expected: ":warning: Unknown command \"nope\".\nUsage: `/shodan help [command]`",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			if resp := router.Handle(context.Background(), slack.SlashCommand{Text: test.text}); resp.Text != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, resp.Text)
+			}
+		})
+	}
+}
+
+// recordingAction remembers the action it handled.
+type recordingAction struct {
+	action *Action
+}
+
+func (a *recordingAction) ActionIDs() []string { return []string{"do_it"} }
+func (a *recordingAction) HandleAction(_ context.Context, action *Action) (*Response, error) {
+	a.action = action
+	return &Response{Text: "done"}, nil
+}
+
+func TestHandleAction(t *testing.T) {
+	handler := &recordingAction{}
+	router := NewRouter("/shodan")
+	router.RegisterActions(handler)
+
+	callback := &slack.InteractionCallback{
+		User:      slack.User{ID: "U1"},
+		Container: slack.Container{ChannelID: "C1", MessageTs: "1.2", ThreadTs: "1.0"},
+	}
+	resp := router.HandleAction(context.Background(), callback, &slack.BlockAction{
+		ActionID:       "do_it",
+		BlockID:        "block",
+		SelectedOption: slack.OptionBlockObject{Value: "selected"},
+	})
+	if resp == nil || resp.Text != "done" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	expected := &Action{ActionID: "do_it", BlockID: "block", Value: "selected", UserID: "U1", ChannelID: "C1", MessageTimeStamp: "1.2", ThreadTimeStamp: "1.0"}
+	if !reflect.DeepEqual(handler.action, expected) {
+		t.Errorf("expected action %+v, got %+v", expected, handler.action)
+	}
+
+	if resp := router.HandleAction(context.Background(), callback, &slack.BlockAction{ActionID: "unknown"}); resp != nil {
+		t.Errorf("expected no response for unknown action, got %+v", resp)
+	}
+}
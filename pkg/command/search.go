@@ -0,0 +1,119 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/render"
+	"github.com/mfojtik/shodan/pkg/unfurl"
+	"github.com/slack-go/slack"
+	"regexp"
+	"strings"
+)
+
+const (
+	searchPageSize = 10
+
+	searchPreviousAction = "search_previous"
+	searchNextAction     = "search_next"
+)
+
+// jqlPattern recognizes queries that are JQL rather than free text.
+var jqlPattern = regexp.MustCompile(`(?i)(!?=|!?~|[<>]|\border\s+by\b|\bis\s+(not\s+)?empty\b|\b(not\s+)?in\s*\()`)
+
+// SearchCommand lists issues matching JQL query or free text.
+type SearchCommand struct {
+	Instances jiraclient.Instances
+	Unfurler  *unfurl.Unfurler
+}
+
+// searchPage is the state of the paginated search results, stored in the pager buttons.
+type searchPage struct {
+	Instance string `json:"i"`
+	JQL      string `json:"q"`
+	StartAt  int    `json:"s"`
+}
+
+func (c *SearchCommand) Name() string  { return "search" }
+func (c *SearchCommand) Usage() string { return "<JQL>|<text>" }
+func (c *SearchCommand) Help() string {
+	return "List issues matching the JQL query, or issues in configured projects containing the text."
+}
+
+// UsesRawArgs tells the router not to parse quotes, the query is JQL or free text.
+func (c *SearchCommand) UsesRawArgs() {}
+
+func (c *SearchCommand) Run(ctx context.Context, req *Request) (*Response, error) {
+	query := req.RawArgs
+	if len(query) == 0 {
+		return nil, Usagef("JQL query or text to search for is required.")
+	}
+	instance := c.Instances.Default()
+	return c.page(ctx, req.ChannelID, instance, SearchJQL(query, instance.Projects), 0)
+}
+
+func (c *SearchCommand) ActionIDs() []string {
+	return []string{searchPreviousAction, searchNextAction}
+}
+
+// HandleAction shows the previous or next page of results in place of the current one.
+func (c *SearchCommand) HandleAction(ctx context.Context, action *Action) (*Response, error) {
+	page := searchPage{}
+	if err := json.Unmarshal([]byte(action.Value), &page); err != nil {
+		return nil, fmt.Errorf("invalid search page %q: %v", action.Value, err)
+	}
+	instance := c.Instances.ByName(page.Instance)
+	if instance == nil {
+		return nil, fmt.Errorf("unknown Jira instance %q", page.Instance)
+	}
+	resp, err := c.page(ctx, action.ChannelID, instance, page.JQL, page.StartAt)
+	if err != nil {
+		return nil, err
+	}
+	resp.ReplaceOriginal = true
+	return resp, nil
+}
+
+func (c *SearchCommand) page(ctx context.Context, channel string, instance *jiraclient.Instance, jql string, startAt int) (*Response, error) {
+	lines, total, err := c.Unfurler.SearchLines(ctx, channel, instance, jql, startAt, searchPageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var pager []slack.BlockElement
+	if startAt > 0 {
+		pager = append(pager, pageButton(searchPreviousAction, "Previous", searchPage{Instance: instance.Name, JQL: jql, StartAt: max(startAt-searchPageSize, 0)}))
+	}
+	if startAt+searchPageSize < total {
+		pager = append(pager, pageButton(searchNextAction, "Next", searchPage{Instance: instance.Name, JQL: jql, StartAt: startAt + searchPageSize}))
+	}
+	return &Response{
+		Text:   jql,
+		Blocks: render.SearchPage(jql, lines, startAt, total, instance.SearchURL(jql), pager...),
+	}, nil
+}
+
+// SearchJQL returns the query when it is JQL, otherwise it turns the free text into JQL searching the text in the projects.
+func SearchJQL(query string, projects []string) string {
+	if jqlPattern.MatchString(query) {
+		return query
+	}
+	jql := fmt.Sprintf("text ~ %q", query)
+	if len(projects) > 0 {
+		jql += fmt.Sprintf(" AND project in (%s)", strings.Join(projects, ", "))
+	}
+	return jql + " ORDER BY updated DESC"
+}
+
+func pageButton(actionID, text string, page searchPage) *slack.ButtonBlockElement {
+	value, _ := json.Marshal(page)
+	return slack.NewButtonBlockElement(actionID, string(value), slack.NewTextBlockObject(slack.PlainTextType, text, false, false))
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,100 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/render"
+	"github.com/mfojtik/shodan/pkg/subscription"
+	"strings"
+)
+
+// SubscribeCommand subscribes the channel to notifications about changes of Jira issues.
+type SubscribeCommand struct {
+	Instances     jiraclient.Instances
+	Subscriptions *subscription.Store
+}
+
+func (c *SubscribeCommand) Name() string { return "subscribe" }
+func (c *SubscribeCommand) Usage() string {
+	return "[<JQL>|project <KEY>|issue <KEY>|remove <ID>]"
+}
+func (c *SubscribeCommand) Help() string {
+	return "List subscriptions of this channel, or post changes of issues matching the JQL query, issues in the project or the single issue to this channel."
+}
+
+// UsesRawArgs tells the router not to parse quotes, the subscription can be JQL query.
+func (c *SubscribeCommand) UsesRawArgs() {}
+
+func (c *SubscribeCommand) Run(ctx context.Context, req *Request) (*Response, error) {
+	if len(req.Args) == 0 {
+		return c.list(req.ChannelID)
+	}
+	kind, query := strings.ToLower(req.Args[0]), strings.TrimSpace(req.RawArgs)
+	if kind == string(subscription.JQL) {
+		_, query, _ = strings.Cut(query, " ")
+	}
+
+	sub := &subscription.Subscription{Channel: req.ChannelID, CreatedBy: req.UserID}
+	var instance *jiraclient.Instance
+	// keywords take a single argument, anything else is JQL query (including "project = API")
+	switch keyword := len(req.Args) == 2; {
+	case keyword && kind == "remove":
+		removed, err := c.Subscriptions.Remove(req.ChannelID, req.Args[1])
+		if err != nil {
+			return nil, err
+		}
+		if !removed {
+			return Errorf("This channel has no subscription %q.", req.Args[1]), nil
+		}
+		return &Response{Text: fmt.Sprintf(":no_bell: Subscription %s removed.", req.Args[1])}, nil
+	case keyword && kind == string(subscription.Project):
+		sub.Kind, sub.Value = subscription.Project, strings.ToUpper(req.Args[1])
+		if instance = c.Instances.ForProject(sub.Value); instance == nil {
+			instance = c.Instances.Default()
+		}
+		if _, _, err := instance.Client.Project.GetWithContext(ctx, sub.Value); err != nil {
+			return Errorf("There is no project %s in %s: %v", sub.Value, instance.DisplayName, err), nil
+		}
+	case keyword && kind == string(subscription.Issue):
+		sub.Kind, sub.Value = subscription.Issue, strings.ToUpper(req.Args[1])
+		instance = c.Instances.ForKey(sub.Value)
+		if _, _, err := instance.Client.Issue.GetWithContext(ctx, sub.Value, &jira.GetQueryOptions{Fields: "key"}); err != nil {
+			return Errorf("There is no issue %s in %s: %v", sub.Value, instance.DisplayName, err), nil
+		}
+	default:
+		if query = strings.TrimSpace(query); len(query) == 0 {
+			return nil, Usagef("JQL query is required.")
+		}
+		sub.Kind, sub.Value = subscription.JQL, query
+		instance = c.Instances.Default()
+		if _, _, err := instance.Client.Issue.SearchWithContext(ctx, sub.Value, &jira.SearchOptions{MaxResults: 1, Fields: []string{"key"}}); err != nil {
+			return Errorf("Invalid JQL query: %v", err), nil
+		}
+	}
+
+	sub.Instance = instance.Name
+	if err := c.Subscriptions.Add(sub); err != nil {
+		return nil, err
+	}
+	return &Response{
+		Text:      fmt.Sprintf(":bell: <@%s> subscribed this channel to changes of %s (subscription %s).", req.UserID, render.Escape(sub.Describe()), sub.ID),
+		InChannel: true,
+	}, nil
+}
+
+func (c *SubscribeCommand) list(channel string) (*Response, error) {
+	subs, err := c.Subscriptions.List(channel)
+	if err != nil {
+		return nil, err
+	}
+	if len(subs) == 0 {
+		return &Response{Text: "This channel has no subscriptions."}, nil
+	}
+	lines := []string{"Subscriptions of this channel:"}
+	for _, sub := range subs {
+		lines = append(lines, fmt.Sprintf("• `%s` %s, by <@%s>", sub.ID, render.Escape(sub.Describe()), sub.CreatedBy))
+	}
+	return &Response{Text: strings.Join(lines, "\n")}, nil
+}
@@ -0,0 +1,66 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/threadsync"
+	"strings"
+)
+
+// SyncCommand lists and stops Slack threads mirrored to Jira issues in the channel.
+// Syncs are started by mentioning Shodan in the thread, because slash commands don't know the thread they came from.
+type SyncCommand struct {
+	Instances jiraclient.Instances
+	Syncer    *threadsync.Syncer
+}
+
+func (c *SyncCommand) Name() string  { return "sync" }
+func (c *SyncCommand) Usage() string { return "[stop <KEY>]" }
+func (c *SyncCommand) Help() string {
+	return "List threads in this channel mirrored as Jira comments, or stop mirroring them. Mention me with \"sync <KEY>\" in a thread to start."
+}
+
+func (c *SyncCommand) Run(ctx context.Context, req *Request) (*Response, error) {
+	syncs, err := c.Syncer.Syncs(req.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(req.Args) == 0:
+		if len(syncs) == 0 {
+			return &Response{Text: "No threads in this channel are synced to Jira. Mention me with `sync <KEY>` in a thread to start."}, nil
+		}
+		lines := []string{"Threads in this channel synced to Jira:"}
+		for _, s := range syncs {
+			lines = append(lines, fmt.Sprintf("• %s since %s, started by <@%s>", c.issueLink(s), s.StartedAt.Format("2006-01-02"), s.StartedBy))
+		}
+		return &Response{Text: strings.Join(lines, "\n")}, nil
+	case len(req.Args) == 2 && strings.EqualFold(req.Args[0], "stop"):
+		key := strings.ToUpper(req.Args[1])
+		stopped := 0
+		for _, s := range syncs {
+			if s.Key != key {
+				continue
+			}
+			if _, err := c.Syncer.Stop(s.Channel, s.Thread); err != nil {
+				return nil, err
+			}
+			stopped++
+		}
+		if stopped == 0 {
+			return Errorf("No thread in this channel is synced to %s.", key), nil
+		}
+		return &Response{Text: fmt.Sprintf(":black_square_for_stop: Stopped mirroring %d thread(s) to %s.", stopped, key)}, nil
+	default:
+		return nil, Usagef("Run without arguments to list synced threads, or with \"stop <KEY>\" to stop them.")
+	}
+}
+
+func (c *SyncCommand) issueLink(s *threadsync.Sync) string {
+	if instance := c.Instances.ByName(s.Instance); instance != nil {
+		return fmt.Sprintf("<%s|%s>", instance.BrowseURL(s.Key), s.Key)
+	}
+	return s.Key
+}
@@ -0,0 +1,49 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/render"
+	"github.com/mfojtik/shodan/pkg/triage"
+	"github.com/mfojtik/shodan/pkg/unfurl"
+	"github.com/slack-go/slack"
+	"time"
+)
+
+// TriageActions handles the snooze menu of issues posted by the triage rules.
+type TriageActions struct {
+	Instances   jiraclient.Instances
+	Triager     *triage.Triager
+	SlackClient *slack.Client
+}
+
+func (c *TriageActions) ActionIDs() []string {
+	return []string{render.SnoozeActionID}
+}
+
+// HandleAction snoozes the issue and confirms it in the thread, so the rest of the triage rotation knows.
+func (c *TriageActions) HandleAction(ctx context.Context, action *Action) (*Response, error) {
+	ref, err := unfurl.ParseIssueRef(action.BlockID)
+	if err != nil {
+		return nil, err
+	}
+	instance := c.Instances.ByName(ref.Instance)
+	if instance == nil {
+		return nil, fmt.Errorf("unknown Jira instance %q", ref.Instance)
+	}
+	duration, err := time.ParseDuration(action.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snooze duration %q", action.Value)
+	}
+	until, err := c.Triager.Snooze(instance, ref.Key, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	text := fmt.Sprintf(":zzz: <@%s> snoozed <%s|%s> until %s.", action.UserID, instance.BrowseURL(ref.Key), ref.Key, until.Format("Mon Jan 2"))
+	if _, _, err := c.SlackClient.PostMessageContext(ctx, action.ChannelID, slack.MsgOptionTS(action.MessageTimeStamp), slack.MsgOptionText(text, false)); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
@@ -1,9 +1,14 @@
 package config
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type SlackConfig struct {
@@ -11,9 +16,103 @@ type SlackConfig struct {
 	BotToken string
 }
 
+type JiraInstanceConfig struct {
+	Name        string
+	DisplayName string
+	URL         string
+	Token       string
+	// Projects are the project keys (eg. "API") recognized as bare issue keys in messages.
+	Projects []string
+}
+
+type CacheConfig struct {
+	// Size is the maximum number of cached issues
+	Size int
+	// TTL is how long fetched issues are cached
+	TTL time.Duration
+	// NegativeTTL is how long we remember issues that do not exist
+	NegativeTTL time.Duration
+}
+
+type UnfurlConfig struct {
+	// Workers is the maximum number of concurrent Jira fetches when unfurling a message
+	Workers int
+	// Deadline bounds the time to unfurl all links in a message
+	Deadline time.Duration
+}
+
+// PolicyRule decides whether issues can be unfurled in a channel. Empty lists match anything.
+type PolicyRule struct {
+	Channels []string `json:"channels"`
+	Projects []string `json:"projects"`
+	Labels   []string `json:"labels"`
+	// SecurityLevels matches issues with any of the security levels, "*" matches any security level set.
+	SecurityLevels []string `json:"securityLevels"`
+	// Action is one of "allow", "redact" or "skip"
+	Action string `json:"action"`
+}
+
+// RemoteLinkConfig configures linking Slack threads back to the Jira issues discussed in them.
+type RemoteLinkConfig struct {
+	// Channels where every unfurled issue is linked to the thread
+	Channels []string
+	// Reaction is the emoji name (without colons) linking the issues mentioned in the message it is added to, in any channel
+	Reaction string
+}
+
+// TriageRule finds issues needing attention of the triage rotation.
+type TriageRule struct {
+	Name string `json:"name"`
+	// JQL matches the issues needing attention, eg. "priority = Blocker AND assignee IS EMPTY AND created <= -1d"
+	JQL string `json:"jql"`
+	// Instance is the name of the Jira instance, the default instance when empty
+	Instance string `json:"instance"`
+	// Channel overrides the triage channel for the rule
+	Channel string `json:"channel"`
+	// NotifyAssignees sends the issues also to their assignees as direct messages
+	NotifyAssignees bool `json:"notifyAssignees"`
+}
+
+// TriageConfig configures periodic evaluation of the triage rules.
+type TriageConfig struct {
+	// Channel is where the issues found by the rules are posted
+	Channel string
+	// Interval is how often the rules are evaluated
+	Interval time.Duration
+	// Remind is how long until an issue still matching the rule is posted again
+	Remind time.Duration
+	Rules  []*TriageRule
+}
+
 type Environment struct {
-	Debug bool
-	Slack *SlackConfig
+	Debug  bool
+	Slack  *SlackConfig
+	Jira   []*JiraInstanceConfig
+	Cache  *CacheConfig
+	Unfurl *UnfurlConfig
+
+	// PolicyRules decide what issues can be unfurled in what channels. First matching rule wins.
+	PolicyRules []*PolicyRule
+
+	// StateFile is where Shodan persists its state (eg. account mappings), ":memory:" keeps the state in memory only.
+	StateFile string
+
+	// IssueKeyChannels are the channels opted-in for unfurling bare issue keys mentioned in messages.
+	// Channels can opt in or out with "/shodan issue-keys".
+	IssueKeyChannels []string
+
+	RemoteLinks *RemoteLinkConfig
+
+	// ReactionActions map emoji names (without colons) to Jira actions, per channel ID. Channel "*" applies to all channels.
+	// Actions are "assign", "transition:<transition or status>" and "create:<project>[:<issue type>]".
+	ReactionActions map[string]map[string]string
+
+	// WebhookSecret authenticates Jira webhooks, the webhook endpoint is disabled when empty.
+	WebhookSecret string
+	// SubscriptionPollInterval is how often subscriptions are polled for changed issues when webhooks are disabled, zero disables polling.
+	SubscriptionPollInterval time.Duration
+
+	Triage *TriageConfig
 }
 
 func Read() (*Environment, error) {
@@ -30,6 +129,55 @@ func Read() (*Environment, error) {
 		return nil, err
 	}
 
+	config.Jira, err = readJiraConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	config.Cache, err = readCacheConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	config.Unfurl, err = readUnfurlConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	config.PolicyRules, err = readPolicyRules()
+	if err != nil {
+		return nil, err
+	}
+
+	// the default is on the persistent volume mounted in fly.toml, so the state survives deploys
+	config.StateFile = os.Getenv("STATE_FILE")
+	if config.StateFile == "" {
+		config.StateFile = "/data/shodan-state.json"
+	}
+
+	config.IssueKeyChannels = readList("ISSUE_KEY_CHANNELS")
+
+	config.ReactionActions, err = readReactionActions()
+	if err != nil {
+		return nil, err
+	}
+
+	config.RemoteLinks = &RemoteLinkConfig{
+		Channels: readList("REMOTE_LINK_CHANNELS"),
+		Reaction: strings.Trim(strings.TrimSpace(os.Getenv("REMOTE_LINK_REACTION")), ":"),
+	}
+
+	config.WebhookSecret = strings.TrimSpace(os.Getenv("JIRA_WEBHOOK_SECRET"))
+	config.SubscriptionPollInterval, err = readDuration("SUBSCRIPTION_POLL_INTERVAL", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Triage, err = readTriageConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
 
@@ -56,3 +204,221 @@ func readSlackConfig() (*SlackConfig, error) {
 
 	return config, nil
 }
+
+// readJiraConfig reads the list of Jira instances from JIRA_INSTANCES, which is a comma separated list of names.
+// Every instance is then configured via JIRA_<NAME>_URL, JIRA_<NAME>_TOKEN and optional JIRA_<NAME>_DISPLAY_NAME.
+// When JIRA_INSTANCES is not set, a single issues.redhat.com instance using JIRA_TOKEN is configured.
+func readJiraConfig() ([]*JiraInstanceConfig, error) {
+	names := os.Getenv("JIRA_INSTANCES")
+	if len(strings.TrimSpace(names)) == 0 {
+		return []*JiraInstanceConfig{{
+			Name:        "redhat",
+			DisplayName: "Red Hat Jira",
+			URL:         "https://issues.redhat.com/",
+			Token:       os.Getenv("JIRA_TOKEN"),
+			Projects:    readList("JIRA_PROJECTS"),
+		}}, nil
+	}
+
+	var instances []*JiraInstanceConfig
+	seen := map[string]bool{}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("jira instance %q is listed more than once in JIRA_INSTANCES", name)
+		}
+		seen[name] = true
+
+		prefix := "JIRA_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		instance := &JiraInstanceConfig{
+			Name:        name,
+			DisplayName: os.Getenv(prefix + "DISPLAY_NAME"),
+			URL:         os.Getenv(prefix + "URL"),
+			Token:       os.Getenv(prefix + "TOKEN"),
+			Projects:    readList(prefix + "PROJECTS"),
+		}
+		if instance.URL == "" {
+			return nil, fmt.Errorf("%sURL must be set", prefix)
+		}
+		if u, err := url.Parse(instance.URL); err != nil || u.Host == "" {
+			return nil, fmt.Errorf("%sURL must be a valid absolute URL", prefix)
+		}
+		if instance.Token == "" {
+			return nil, fmt.Errorf("%sTOKEN must be set", prefix)
+		}
+		if instance.DisplayName == "" {
+			instance.DisplayName = name
+		}
+		instances = append(instances, instance)
+	}
+	if len(instances) == 0 {
+		return nil, errors.New("JIRA_INSTANCES must list at least one instance")
+	}
+
+	return instances, nil
+}
+
+// readCacheConfig reads the Jira issue cache settings from JIRA_CACHE_SIZE, JIRA_CACHE_TTL and JIRA_CACHE_NEGATIVE_TTL.
+func readCacheConfig() (*CacheConfig, error) {
+	config := &CacheConfig{
+		Size:        1000,
+		TTL:         5 * time.Minute,
+		NegativeTTL: time.Minute,
+	}
+
+	var err error
+	if config.Size, err = readInt("JIRA_CACHE_SIZE", config.Size); err != nil {
+		return nil, err
+	}
+	if config.TTL, err = readDuration("JIRA_CACHE_TTL", config.TTL); err != nil {
+		return nil, err
+	}
+	if config.NegativeTTL, err = readDuration("JIRA_CACHE_NEGATIVE_TTL", config.NegativeTTL); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// readUnfurlConfig reads the unfurl concurrency settings from UNFURL_WORKERS and UNFURL_DEADLINE.
+func readUnfurlConfig() (*UnfurlConfig, error) {
+	config := &UnfurlConfig{
+		Workers:  4,
+		Deadline: 15 * time.Second,
+	}
+
+	var err error
+	if config.Workers, err = readInt("UNFURL_WORKERS", config.Workers); err != nil {
+		return nil, err
+	}
+	if config.Workers == 0 {
+		return nil, errors.New("UNFURL_WORKERS must be at least 1")
+	}
+	if config.Deadline, err = readDuration("UNFURL_DEADLINE", config.Deadline); err != nil {
+		return nil, err
+	}
+	if config.Deadline == 0 {
+		return nil, errors.New("UNFURL_DEADLINE must be greater than zero")
+	}
+	return config, nil
+}
+
+// readPolicyRules reads the unfurl visibility rules as JSON list from UNFURL_POLICY.
+func readPolicyRules() ([]*PolicyRule, error) {
+	value := strings.TrimSpace(os.Getenv("UNFURL_POLICY"))
+	if value == "" {
+		return nil, nil
+	}
+	var rules []*PolicyRule
+	if err := json.Unmarshal([]byte(value), &rules); err != nil {
+		return nil, fmt.Errorf("UNFURL_POLICY must be a JSON list of rules: %v", err)
+	}
+	for i, rule := range rules {
+		switch rule.Action {
+		case "allow", "redact", "skip":
+		default:
+			return nil, fmt.Errorf("UNFURL_POLICY rule #%d: action must be one of \"allow\", \"redact\" or \"skip\", got %q", i+1, rule.Action)
+		}
+	}
+	return rules, nil
+}
+
+// readTriageConfig reads the triage channel, intervals and the TRIAGE_RULES JSON list of rules.
+func readTriageConfig() (*TriageConfig, error) {
+	cfg := &TriageConfig{Channel: strings.TrimSpace(os.Getenv("TRIAGE_CHANNEL"))}
+	var err error
+	if cfg.Interval, err = readDuration("TRIAGE_INTERVAL", time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.Remind, err = readDuration("TRIAGE_REMIND", 24*time.Hour); err != nil {
+		return nil, err
+	}
+	value := strings.TrimSpace(os.Getenv("TRIAGE_RULES"))
+	if value == "" {
+		return cfg, nil
+	}
+	if err := json.Unmarshal([]byte(value), &cfg.Rules); err != nil {
+		return nil, fmt.Errorf("TRIAGE_RULES must be a JSON list of rules: %v", err)
+	}
+	for i, rule := range cfg.Rules {
+		switch {
+		case len(rule.Name) == 0 || len(rule.JQL) == 0:
+			return nil, fmt.Errorf("TRIAGE_RULES rule #%d: name and jql are required", i+1)
+		case len(rule.Channel) == 0 && len(cfg.Channel) == 0:
+			return nil, fmt.Errorf("TRIAGE_RULES rule %q: channel is required when TRIAGE_CHANNEL is not set", rule.Name)
+		}
+	}
+	if cfg.Interval == 0 {
+		return nil, errors.New("TRIAGE_INTERVAL must be positive when TRIAGE_RULES are set")
+	}
+	return cfg, nil
+}
+
+// readReactionActions reads the emoji to action mapping per channel as JSON object from REACTION_ACTIONS,
+// eg. {"*": {"eyes": "assign"}, "C0123456": {"jira": "create:API:Bug", "white_check_mark": "transition:Done"}}.
+func readReactionActions() (map[string]map[string]string, error) {
+	value := strings.TrimSpace(os.Getenv("REACTION_ACTIONS"))
+	if value == "" {
+		return nil, nil
+	}
+	var actions map[string]map[string]string
+	if err := json.Unmarshal([]byte(value), &actions); err != nil {
+		return nil, fmt.Errorf("REACTION_ACTIONS must be a JSON object of channels and their emoji actions: %v", err)
+	}
+	for channel, emojis := range actions {
+		normalized := map[string]string{}
+		for emoji, action := range emojis {
+			verb, arg, _ := strings.Cut(action, ":")
+			switch {
+			case verb == "assign" && arg == "":
+			case verb == "transition" && arg != "":
+			case verb == "create" && arg != "":
+			default:
+				return nil, fmt.Errorf("REACTION_ACTIONS %s %s: action must be \"assign\", \"transition:<status>\" or \"create:<project>[:<issue type>]\", got %q", channel, emoji, action)
+			}
+			// reactions come without colons, but people write emoji with them
+			normalized[strings.Trim(emoji, ":")] = action
+		}
+		actions[channel] = normalized
+	}
+	return actions, nil
+}
+
+// readInt reads non-negative integer from the environment variable, returning defaultValue when the variable is not set.
+func readInt(name string, defaultValue int) (int, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return defaultValue, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative number", name)
+	}
+	return i, nil
+}
+
+// readDuration reads duration (eg. "5m") from the environment variable, returning defaultValue when the variable is not set.
+func readDuration(name string, defaultValue time.Duration) (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative duration (eg. \"5m\")", name)
+	}
+	return d, nil
+}
+
+// readList reads comma separated list of values from the environment variable, ignoring empty items.
+func readList(name string) []string {
+	var result []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			result = append(result, item)
+		}
+	}
+	return result
+}
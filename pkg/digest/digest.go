@@ -0,0 +1,301 @@
+package digest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/render"
+	"github.com/mfojtik/shodan/pkg/store"
+	"github.com/mfojtik/shodan/pkg/subscription"
+	"github.com/mfojtik/shodan/pkg/unfurl"
+	"github.com/slack-go/slack"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	// time zones are loaded from the binary, the container may come without tzdata
+	_ "time/tzdata"
+)
+
+const (
+	// bucket stores the digests keyed by their ID.
+	bucket = "digests"
+	// metadataType marks the posted digests, so a run posted by another Shodan process (eg. during deploy) is not repeated.
+	metadataType = "shodan_digest"
+	// sectionLimit is the number of issues listed in each digest section.
+	sectionLimit = 5
+	// checkInterval is how often the scheduler looks for due digests.
+	checkInterval = time.Minute
+	// requestTimeout bounds a single search.
+	requestTimeout = 30 * time.Second
+)
+
+// Digest is a summary of Jira activity posted to the channel on schedule.
+type Digest struct {
+	ID       string `json:"id"`
+	Instance string `json:"instance"`
+	Channel  string `json:"channel"`
+	// Schedule is the cron expression, evaluated in the TimeZone
+	Schedule  string    `json:"schedule"`
+	TimeZone  string    `json:"timeZone"`
+	JQL       string    `json:"jql"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	// LastRun is the scheduled time of the last posted digest, the next digest covers the period since then
+	LastRun time.Time `json:"lastRun,omitempty"`
+	NextRun time.Time `json:"nextRun"`
+}
+
+// Scheduler posts the digests when they are due.
+// Every run is claimed in the store before the digest is posted, so restarts never post it twice.
+type Scheduler struct {
+	instances   jiraclient.Instances
+	slackClient *slack.Client
+	unfurler    *unfurl.Unfurler
+	store       store.Store
+}
+
+func NewScheduler(instances jiraclient.Instances, slackClient *slack.Client, unfurler *unfurl.Unfurler, s store.Store) *Scheduler {
+	return &Scheduler{
+		instances:   instances,
+		slackClient: slackClient,
+		unfurler:    unfurler,
+		store:       s,
+	}
+}
+
+// Add validates the digest schedule and time zone and saves the digest, assigning it a new ID.
+func (s *Scheduler) Add(d *Digest) error {
+	loc, err := time.LoadLocation(d.TimeZone)
+	if err != nil {
+		return fmt.Errorf("unknown time zone %q", d.TimeZone)
+	}
+	schedule, err := ParseSchedule(d.Schedule)
+	if err != nil {
+		return err
+	}
+	d.NextRun = schedule.Next(time.Now().In(loc))
+	if d.NextRun.IsZero() {
+		return fmt.Errorf("schedule %q never runs", d.Schedule)
+	}
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	d.ID = hex.EncodeToString(id)
+	d.CreatedAt = time.Now()
+	return s.store.Put(bucket, d.ID, d)
+}
+
+// Remove deletes the digest of the channel. It returns false when the channel has no such digest.
+func (s *Scheduler) Remove(channel, id string) (bool, error) {
+	removed := false
+	err := s.store.Batch(func(tx store.Store) error {
+		d := &Digest{}
+		if ok, err := tx.Get(bucket, id, d); err != nil || !ok || d.Channel != channel {
+			return err
+		}
+		removed = true
+		return tx.Delete(bucket, id)
+	})
+	return removed, err
+}
+
+// Get returns the digest of the channel, or nil when there is no such digest.
+func (s *Scheduler) Get(channel, id string) (*Digest, error) {
+	d := &Digest{}
+	if ok, err := s.store.Get(bucket, id, d); err != nil || !ok || d.Channel != channel {
+		return nil, err
+	}
+	return d, nil
+}
+
+// List returns digests of the channel (all digests when the channel is empty), oldest first.
+func (s *Scheduler) List(channel string) ([]*Digest, error) {
+	var digests []*Digest
+	err := s.store.ForEach(bucket, func(_ string, value json.RawMessage) error {
+		d := &Digest{}
+		if err := json.Unmarshal(value, d); err != nil {
+			return err
+		}
+		if channel == "" || d.Channel == channel {
+			digests = append(digests, d)
+		}
+		return nil
+	})
+	sort.Slice(digests, func(i, j int) bool { return digests[i].CreatedAt.Before(digests[j].CreatedAt) })
+	return digests, err
+}
+
+// Run posts the due digests every minute until the context is done.
+// Runs missed while Shodan was down are posted once, covering the whole period since the last posted digest.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		digests, err := s.List("")
+		if err != nil {
+			log.Printf("failed to list digests: %v", err)
+		}
+		for _, d := range digests {
+			if time.Now().Before(d.NextRun) {
+				continue
+			}
+			if err := s.run(ctx, d); err != nil {
+				log.Printf("failed to post digest %s to %s: %v", d.ID, d.Channel, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run claims the scheduled run by moving the digest to the next run and posts the digest.
+// When posting fails, the digest is moved back to the scheduled run, so the run is retried on the next check.
+// Digests posted by another Shodan process sharing the channel (eg. during deploy) are found by the message metadata.
+func (s *Scheduler) run(ctx context.Context, d *Digest) (err error) {
+	loc, err := time.LoadLocation(d.TimeZone)
+	if err != nil {
+		return err
+	}
+	schedule, err := ParseSchedule(d.Schedule)
+	if err != nil {
+		return err
+	}
+	scheduled := d.NextRun
+	from := d.LastRun
+	if from.IsZero() {
+		// the first digest covers one period of the schedule
+		from = scheduled.Add(-schedule.Next(scheduled.In(loc)).Sub(scheduled))
+	}
+	previous := *d
+	d.LastRun, d.NextRun = scheduled, schedule.Next(time.Now().In(loc))
+
+	if ok, err := s.swap(d, scheduled); err != nil || !ok {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if _, releaseErr := s.swap(&previous, d.NextRun); releaseErr != nil {
+			log.Printf("failed to release run of digest %s, it is skipped: %v", d.ID, releaseErr)
+		}
+	}()
+
+	if posted, err := s.posted(ctx, d, scheduled); err != nil || posted {
+		return err
+	}
+	return s.Post(ctx, d, from, time.Now(), slack.MsgOptionMetadata(slack.SlackMetadata{
+		EventType:    metadataType,
+		EventPayload: map[string]interface{}{"digest": d.ID, "run": strconv.FormatInt(scheduled.Unix(), 10)},
+	}))
+}
+
+// swap saves the digest, unless its stored next run is not the expected one (ie. the run was claimed or released
+// by another process) or the digest was removed. The stored next run is compared and set in a single store batch,
+// so every scheduled run is claimed exactly once.
+func (s *Scheduler) swap(d *Digest, expected time.Time) (bool, error) {
+	swapped := false
+	err := s.store.Batch(func(tx store.Store) error {
+		stored := &Digest{}
+		if ok, err := tx.Get(bucket, d.ID, stored); err != nil || !ok || !stored.NextRun.Equal(expected) {
+			return err
+		}
+		swapped = true
+		return tx.Put(bucket, d.ID, d)
+	})
+	return swapped, err
+}
+
+// posted returns true when the scheduled run of the digest was already posted to the channel.
+func (s *Scheduler) posted(ctx context.Context, d *Digest, scheduled time.Time) (bool, error) {
+	history, err := s.slackClient.GetConversationHistoryContext(ctx, &slack.GetConversationHistoryParameters{
+		ChannelID:          d.Channel,
+		Oldest:             strconv.FormatInt(scheduled.Unix(), 10),
+		Limit:              100,
+		IncludeAllMetadata: true,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check digests posted to %s: %v", d.Channel, err)
+	}
+	run := strconv.FormatInt(scheduled.Unix(), 10)
+	for _, m := range history.Messages {
+		if m.Metadata.EventType == metadataType && m.Metadata.EventPayload["digest"] == d.ID && m.Metadata.EventPayload["run"] == run {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Post posts the digest of the activity in the period to the digest channel.
+func (s *Scheduler) Post(ctx context.Context, d *Digest, from, to time.Time, options ...slack.MsgOption) error {
+	instance := s.instances.ByName(d.Instance)
+	if instance == nil {
+		return fmt.Errorf("unknown jira instance %q", d.Instance)
+	}
+	// relative dates avoid guessing the time zone Jira interprets absolute dates in
+	minutes := int(to.Sub(from)/time.Minute) + 1
+	scope := subscription.WithoutOrder(d.JQL)
+	queries := []struct{ title, jql string }{
+		{"Created", fmt.Sprintf("(%s) AND created >= -%dm ORDER BY priority DESC, created DESC", scope, minutes)},
+		{"Resolved", fmt.Sprintf("(%s) AND resolved >= -%dm ORDER BY priority DESC, resolved DESC", scope, minutes)},
+		{"Blocked", fmt.Sprintf("(%s) AND status CHANGED TO Blocked AFTER -%dm ORDER BY priority DESC", scope, minutes)},
+		{"Top priority unassigned", fmt.Sprintf("(%s) AND assignee IS EMPTY AND resolution IS EMPTY ORDER BY priority DESC, created ASC", scope)},
+	}
+	var sections []render.ActivitySection
+	for _, q := range queries {
+		section, err := s.section(ctx, d.Channel, instance, q.title, q.jql)
+		if err != nil {
+			// eg. workflows without "Blocked" status, the rest of the digest is still useful
+			log.Printf("digest %s: %v", d.ID, err)
+			continue
+		}
+		sections = append(sections, section)
+	}
+	if len(sections) == 0 {
+		return fmt.Errorf("all digest searches failed")
+	}
+
+	loc, err := time.LoadLocation(d.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	period := fmt.Sprintf("%s – %s", from.In(loc).Format("Mon Jan 2 15:04"), to.In(loc).Format("Mon Jan 2 15:04 MST"))
+	blocks := render.ActivityDigest(d.JQL, period, sections)
+	options = append(options, slack.MsgOptionText(fmt.Sprintf("Jira digest for %s", d.JQL), false), slack.MsgOptionBlocks(blocks...))
+	_, _, err = s.slackClient.PostMessageContext(ctx, d.Channel, options...)
+	return err
+}
+
+func (s *Scheduler) section(ctx context.Context, channel string, instance *jiraclient.Instance, title, jql string) (render.ActivitySection, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	issues, resp, err := instance.Client.Issue.SearchWithContext(ctx, jql, &jira.SearchOptions{
+		MaxResults: sectionLimit,
+		Fields:     []string{"summary", "status", "assignee", "project", "labels", "security"},
+	})
+	if err != nil {
+		return render.ActivitySection{}, fmt.Errorf("failed to search %q: %v", jql, jira.NewJiraError(resp, err))
+	}
+	section := render.ActivitySection{Title: title, Total: len(issues), URL: instance.SearchURL(jql)}
+	if resp != nil && resp.Total > section.Total {
+		section.Total = resp.Total
+	}
+	for i := range issues {
+		if line, ok := s.unfurler.IssueLine(channel, instance, &issues[i]); ok {
+			section.Lines = append(section.Lines, line)
+		} else {
+			section.Total--
+		}
+	}
+	return section, nil
+}
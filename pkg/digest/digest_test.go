@@ -0,0 +1,93 @@
+package digest
+
+import (
+	"context"
+	"github.com/mfojtik/shodan/pkg/store"
+	"github.com/slack-go/slack"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClaim(t *testing.T) {
+	s := NewScheduler(nil, nil, nil, store.NewMemory())
+	if err := s.Add(&Digest{Channel: "C1", Schedule: "0 9 * * *", TimeZone: "Europe/Prague", JQL: "project = API"}); err != nil {
+		t.Fatal(err)
+	}
+	digests, err := s.List("C1")
+	if err != nil || len(digests) != 1 {
+		t.Fatalf("expected single digest, got %v %v", digests, err)
+	}
+	scheduled := digests[0].NextRun
+
+	// concurrent schedulers see the same due run, only one of them claims it
+	var (
+		wg      sync.WaitGroup
+		claimed int32
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d := *digests[0]
+			d.LastRun, d.NextRun = scheduled, scheduled.Add(24*time.Hour)
+			ok, err := s.swap(&d, scheduled)
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				atomic.AddInt32(&claimed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if claimed != 1 {
+		t.Errorf("expected the run claimed once, got %d", claimed)
+	}
+	if d, err := s.Get("C1", digests[0].ID); err != nil || !d.NextRun.Equal(scheduled.Add(24*time.Hour)) {
+		t.Errorf("expected the digest moved to the next run, got %+v %v", d, err)
+	}
+
+	if ok, err := s.Remove("C2", digests[0].ID); err != nil || ok {
+		t.Errorf("expected digest of other channel not removed, got %v %v", ok, err)
+	}
+	if ok, err := s.Remove("C1", digests[0].ID); err != nil || !ok {
+		t.Fatalf("expected digest removed, got %v %v", ok, err)
+	}
+	d := *digests[0]
+	d.NextRun = scheduled.Add(48 * time.Hour)
+	if ok, err := s.swap(&d, scheduled.Add(24*time.Hour)); err != nil || ok {
+		t.Errorf("expected removed digest not claimed, got %v %v", ok, err)
+	}
+	if digests, _ := s.List(""); len(digests) != 0 {
+		t.Errorf("expected removed digest not brought back, got %v", digests)
+	}
+}
+
+func TestRunReleasesFailedRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok": false, "error": "ratelimited"}`))
+	}))
+	defer server.Close()
+	s := NewScheduler(nil, slack.New("xoxb-test", slack.OptionAPIURL(server.URL+"/")), nil, store.NewMemory())
+	if err := s.Add(&Digest{Channel: "C1", Schedule: "0 9 * * *", TimeZone: "Europe/Prague", JQL: "project = API"}); err != nil {
+		t.Fatal(err)
+	}
+	digests, _ := s.List("C1")
+	scheduled := digests[0].NextRun
+
+	if err := s.run(context.Background(), digests[0]); err == nil {
+		t.Fatal("expected the run to fail")
+	}
+	d, err := s.Get("C1", digests[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.NextRun.Equal(scheduled) || !d.LastRun.IsZero() {
+		t.Errorf("expected the digest moved back to the failed run %s, got next run %s, last run %s", scheduled, d.NextRun, d.LastRun)
+	}
+}
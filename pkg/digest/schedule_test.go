@@ -0,0 +1,88 @@
+package digest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, spec := range []string{
+		"0 9 * *",
+		"0 9 * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"0 9 0 * *",
+		"0 9 * 13 *",
+		"0 9 * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"0 9 * * funday",
+		"@yearly",
+	} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("expected %q to be invalid", spec)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	prague, err := time.LoadLocation("Europe/Prague")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		spec     string
+		from     string
+		expected string
+	}{
+		{name: "step", spec: "*/15 * * * *", from: "2022-10-05T10:07:00Z", expected: "2022-10-05T10:15:00Z"},
+		{name: "next is strictly after", spec: "*/15 * * * *", from: "2022-10-05T10:15:00Z", expected: "2022-10-05T10:30:00Z"},
+		{name: "range with step", spec: "0 9-17/4 * * *", from: "2022-10-05T10:00:00Z", expected: "2022-10-05T13:00:00Z"},
+		{name: "list", spec: "0 9 1,15 * *", from: "2022-10-02T00:00:00Z", expected: "2022-10-15T09:00:00Z"},
+		{name: "next month", spec: "0 9 1 * *", from: "2022-10-02T00:00:00Z", expected: "2022-11-01T09:00:00Z"},
+		{name: "next year", spec: "0 0 1 1 *", from: "2022-10-02T00:00:00Z", expected: "2023-01-01T00:00:00Z"},
+		{name: "weekday names", spec: "0 9 * * mon-fri", from: "2022-10-07T10:00:00Z", expected: "2022-10-10T09:00:00Z"},
+		{name: "weekday names are case insensitive", spec: "0 9 * * SAT", from: "2022-10-05T10:00:00Z", expected: "2022-10-08T09:00:00Z"},
+		{name: "sunday as 7", spec: "0 9 * * 7", from: "2022-10-05T10:00:00Z", expected: "2022-10-09T09:00:00Z"},
+		{name: "sunday as 0", spec: "0 9 * * 0", from: "2022-10-05T10:00:00Z", expected: "2022-10-09T09:00:00Z"},
+		{name: "shortcut", spec: "@weekly", from: "2022-10-04T10:00:00Z", expected: "2022-10-10T09:00:00Z"},
+		{name: "day of month or day of week, weekday first", spec: "0 9 13 * fri", from: "2022-10-01T00:00:00Z", expected: "2022-10-07T09:00:00Z"},
+		{name: "day of month or day of week, day first", spec: "0 9 13 * fri", from: "2022-10-08T00:00:00Z", expected: "2022-10-13T09:00:00Z"},
+		{name: "any day of month and day of week", spec: "0 9 * 10 mon", from: "2022-10-31T10:00:00Z", expected: "2023-10-02T09:00:00Z"},
+		{name: "day of month and any day of week", spec: "0 9 31 * *", from: "2022-10-31T10:00:00Z", expected: "2022-12-31T09:00:00Z"},
+		{name: "never", spec: "0 9 30 2 *", from: "2022-10-05T10:00:00Z", expected: "0001-01-01T00:00:00Z"},
+
+		{name: "keeps wall clock across DST start", spec: "0 9 * * *", from: "2022-03-26T10:00:00+01:00", expected: "2022-03-27T09:00:00+02:00"},
+		{name: "keeps wall clock across DST end", spec: "0 9 * * *", from: "2022-10-29T10:00:00+02:00", expected: "2022-10-30T09:00:00+01:00"},
+		{name: "time skipped by DST start does not run", spec: "30 2 * * *", from: "2022-03-26T03:00:00+01:00", expected: "2022-03-28T02:30:00+02:00"},
+		{name: "time repeated by DST end runs first", spec: "30 2 * * *", from: "2022-10-30T00:00:00+02:00", expected: "2022-10-30T02:30:00+02:00"},
+		{name: "time repeated by DST end runs once", spec: "30 2 * * *", from: "2022-10-30T02:30:00+02:00", expected: "2022-10-31T02:30:00+01:00"},
+		{name: "hourly skips repeated hour", spec: "0 * * * *", from: "2022-10-30T02:00:00+02:00", expected: "2022-10-30T03:00:00+01:00"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := ParseSchedule(test.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			from, err := time.Parse(time.RFC3339, test.from)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := time.Parse(time.RFC3339, test.expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			loc := time.UTC
+			if _, offset := from.Zone(); offset != 0 {
+				loc = prague
+			}
+			next := schedule.Next(from.In(loc))
+			if !next.Equal(expected) || (!next.IsZero() && next.Location() != loc) {
+				t.Errorf("expected %s, got %s", expected, next)
+			}
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/cache"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/store"
+	"github.com/slack-go/slack"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// overridesBucket stores manual Slack to Jira account mappings, keyed by "<instance>/<slack user ID>".
+	overridesBucket = "identity-overrides"
+	// linkedBucket is the reverse of overridesBucket, keyed by "<instance>/<jira username>".
+	linkedBucket = "identity-linked"
+
+	// mappingCacheSize is the maximum number of cached mappings in each direction.
+	mappingCacheSize = 1000
+	// mappingTTL is how long resolved mappings are cached, people rarely change their emails.
+	mappingTTL = time.Hour
+	// unmappedTTL is how long users without mapping are cached, so they are not looked up on every unfurl.
+	unmappedTTL = 10 * time.Minute
+	// lookupTimeout bounds a single lookup in Slack or Jira.
+	lookupTimeout = 5 * time.Second
+)
+
+// ErrNotMapped is returned when the Slack user can't be mapped to a Jira account (or the other way around).
+var ErrNotMapped = errors.New("slack user is not mapped to a jira account")
+
+// ErrNotAllowed is returned when the Slack user is not allowed to change links of Jira accounts.
+var ErrNotAllowed = errors.New("not allowed to link the jira account")
+
+// ErrForbidden is returned when the Jira account of the Slack user lacks a permission for the issue.
+var ErrForbidden = errors.New("jira account lacks permission")
+
+// ErrAlreadyLinked is returned when the Jira account is already linked to another Slack user.
+var ErrAlreadyLinked = errors.New("jira account is already linked to another slack user")
+
+// Resolver maps Slack users to Jira accounts and back.
+// Manual overrides take precedence, otherwise the accounts are matched by email.
+type Resolver struct {
+	slackClient *slack.Client
+	store       store.Store
+
+	// jiraUsers caches Jira accounts by "<instance>/<slack user ID>"
+	jiraUsers *cache.LRU[*jira.User]
+	// slackUsers caches Slack user IDs by "<instance>/<jira username>"
+	slackUsers *cache.LRU[string]
+}
+
+func NewResolver(slackClient *slack.Client, s store.Store) *Resolver {
+	isNotMapped := func(err error) bool { return errors.Is(err, ErrNotMapped) }
+	return &Resolver{
+		slackClient: slackClient,
+		store:       s,
+		jiraUsers:   cache.New[*jira.User](mappingCacheSize, mappingTTL, unmappedTTL, isNotMapped),
+		slackUsers:  cache.New[string](mappingCacheSize, mappingTTL, unmappedTTL, isNotMapped),
+	}
+}
+
+// JiraUser returns the Jira account of the Slack user in the instance.
+func (r *Resolver) JiraUser(ctx context.Context, instance *jiraclient.Instance, slackUserID string) (*jira.User, error) {
+	return r.jiraUsers.Get(userKey(instance, slackUserID), func() (*jira.User, error) {
+		ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+		defer cancel()
+
+		if username, ok, err := r.Override(instance, slackUserID); err != nil {
+			return nil, err
+		} else if ok {
+			return &jira.User{Name: username}, nil
+		}
+
+		slackUser, err := r.slackClient.GetUserInfoContext(ctx, slackUserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get slack user %s: %v", slackUserID, err)
+		}
+		if len(slackUser.Profile.Email) == 0 {
+			return nil, fmt.Errorf("%w: slack user %s has no email", ErrNotMapped, slackUserID)
+		}
+		user, err := findByEmail(ctx, instance, slackUser.Profile.Email)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, fmt.Errorf("%w: no jira account with email %s", ErrNotMapped, slackUser.Profile.Email)
+		}
+		return user, nil
+	})
+}
+
+// SlackUserID returns the ID of the Slack user owning the Jira account.
+// Accounts linked by override are resolved without asking Slack, others are matched by the Jira account email.
+func (r *Resolver) SlackUserID(ctx context.Context, instance *jiraclient.Instance, user *jira.User) (string, error) {
+	return r.slackUsers.Get(userKey(instance, QueryID(user)), func() (string, error) {
+		ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+		defer cancel()
+
+		slackUserID := ""
+		if ok, err := r.store.Get(linkedBucket, userKey(instance, QueryID(user)), &slackUserID); err != nil {
+			return "", err
+		} else if ok {
+			return slackUserID, nil
+		}
+
+		email := user.EmailAddress
+		if len(email) == 0 {
+			// users embedded in issues might come without email (eg. in [~username] mentions)
+			query := url.Values{"username": {user.Name}}
+			if len(user.Name) == 0 {
+				query = url.Values{"accountId": {user.AccountID}}
+			}
+			fullUser, err := getUser(ctx, instance, QueryID(user), query)
+			if err != nil {
+				return "", err
+			}
+			email = fullUser.EmailAddress
+		}
+		if len(email) == 0 {
+			return "", fmt.Errorf("%w: jira user %s has no visible email", ErrNotMapped, QueryID(user))
+		}
+		slackUser, err := r.slackClient.GetUserByEmailContext(ctx, email)
+		if err != nil {
+			var slackErr slack.SlackErrorResponse
+			if errors.As(err, &slackErr) && slackErr.Err == "users_not_found" {
+				return "", fmt.Errorf("%w: no slack user with email %s", ErrNotMapped, email)
+			}
+			return "", fmt.Errorf("failed to get slack user by email %s: %v", email, err)
+		}
+		return slackUser.ID, nil
+	})
+}
+
+// Authorize returns the Jira account of the Slack user when it has all the permissions (eg. "ASSIGN_ISSUES") for the issue.
+// Shodan acts in Jira with its own account, so actions done on behalf of Slack users must be authorized first.
+// It returns error wrapping ErrForbidden when a permission is missing, or ErrNotMapped when the user has no Jira account.
+func (r *Resolver) Authorize(ctx context.Context, instance *jiraclient.Instance, slackUserID, key string, permissions ...string) (*jira.User, error) {
+	user, err := r.JiraUser(ctx, instance, slackUserID)
+	if err != nil {
+		return nil, err
+	}
+	for _, permission := range permissions {
+		allowed, err := instance.UserHasPermission(ctx, key, user, permission)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check %s permission of %s for %s: %v", permission, QueryID(user), key, err)
+		}
+		if !allowed {
+			return nil, fmt.Errorf("%w: jira user %s has no %s permission for %s", ErrForbidden, QueryID(user), permission, key)
+		}
+	}
+	return user, nil
+}
+
+// Mention returns function rendering Jira users of the instance as Slack mentions.
+// It returns empty string for users without Slack account, so the caller can fall back to their name.
+func (r *Resolver) Mention(ctx context.Context, instance *jiraclient.Instance) func(user *jira.User) string {
+	return func(user *jira.User) string {
+		if user == nil || len(QueryID(user)) == 0 {
+			return ""
+		}
+		slackUserID, err := r.SlackUserID(ctx, instance, user)
+		if err != nil {
+			if !errors.Is(err, ErrNotMapped) {
+				log.Printf("failed to map jira user %s to slack: %v", QueryID(user), err)
+			}
+			return ""
+		}
+		return fmt.Sprintf("<@%s>", slackUserID)
+	}
+}
+
+// Attribution returns how the Slack user is referenced in Jira text, eg. in comments Shodan posts on their behalf:
+// as Jira user mention when the user is mapped, by their Slack name otherwise.
+func (r *Resolver) Attribution(ctx context.Context, instance *jiraclient.Instance, slackUserID string) string {
+	if user, err := r.JiraUser(ctx, instance, slackUserID); err == nil {
+		return fmt.Sprintf("[~%s]", QueryID(user))
+	}
+	if slackUser, err := r.slackClient.GetUserInfoContext(ctx, slackUserID); err == nil && len(slackUser.RealName) > 0 {
+		return slackUser.RealName
+	}
+	return slackUserID
+}
+
+// Override returns the Jira username the Slack user was manually linked to.
+func (r *Resolver) Override(instance *jiraclient.Instance, slackUserID string) (string, bool, error) {
+	username := ""
+	ok, err := r.store.Get(overridesBucket, userKey(instance, slackUserID), &username)
+	return username, ok, err
+}
+
+// SetOverride links the Slack user to the Jira account, regardless of their email. Accounts with matching emails
+// are linked automatically, overrides are for the rest and only workspace admins can set them, as the override
+// lets the Slack user act as the Jira account. It fails with error wrapping ErrNotAllowed when the actor
+// (the Slack user running the command) is not an admin, or ErrAlreadyLinked when the account is linked to another Slack user.
+func (r *Resolver) SetOverride(ctx context.Context, instance *jiraclient.Instance, actorID, slackUserID string, user *jira.User) error {
+	if err := r.requireAdmin(ctx, actorID); err != nil {
+		return err
+	}
+	previous := ""
+	err := r.store.Batch(func(tx store.Store) error {
+		linkedTo := ""
+		if ok, err := tx.Get(linkedBucket, userKey(instance, user.Name), &linkedTo); err != nil {
+			return err
+		} else if ok && linkedTo != slackUserID {
+			return fmt.Errorf("%w: %s is linked to %s", ErrAlreadyLinked, user.Name, linkedTo)
+		}
+		var err error
+		if previous, err = removeOverride(tx, instance, slackUserID); err != nil {
+			return err
+		}
+		if err := tx.Put(overridesBucket, userKey(instance, slackUserID), user.Name); err != nil {
+			return err
+		}
+		return tx.Put(linkedBucket, userKey(instance, user.Name), slackUserID)
+	})
+	if err != nil {
+		return err
+	}
+	r.jiraUsers.Invalidate(userKey(instance, slackUserID))
+	if len(previous) > 0 {
+		r.slackUsers.Invalidate(userKey(instance, previous))
+	}
+	r.slackUsers.Invalidate(userKey(instance, user.Name))
+	return nil
+}
+
+// requireAdmin returns error wrapping ErrNotAllowed unless the Slack user is a workspace admin or owner.
+func (r *Resolver) requireAdmin(ctx context.Context, slackUserID string) error {
+	user, err := r.slackUser(ctx, slackUserID)
+	if err != nil {
+		return err
+	}
+	if !user.IsAdmin && !user.IsOwner {
+		return fmt.Errorf("%w: only workspace admins can link accounts", ErrNotAllowed)
+	}
+	return nil
+}
+
+// RemoveOverride drops the manual mapping, so the Slack user is mapped by email again.
+// Users can drop their own mapping, only workspace admins can drop mappings of others (error wraps ErrNotAllowed).
+func (r *Resolver) RemoveOverride(ctx context.Context, instance *jiraclient.Instance, actorID, slackUserID string) error {
+	if actorID != slackUserID {
+		if err := r.requireAdmin(ctx, actorID); err != nil {
+			return err
+		}
+	}
+	username := ""
+	err := r.store.Batch(func(tx store.Store) error {
+		var err error
+		username, err = removeOverride(tx, instance, slackUserID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	r.jiraUsers.Invalidate(userKey(instance, slackUserID))
+	if len(username) > 0 {
+		r.slackUsers.Invalidate(userKey(instance, username))
+	}
+	return nil
+}
+
+// slackUser fetches the Slack user, uncached, so changes of their admin role and email apply right away.
+func (r *Resolver) slackUser(ctx context.Context, slackUserID string) (*slack.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+	user, err := r.slackClient.GetUserInfoContext(ctx, slackUserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get slack user %s: %v", slackUserID, err)
+	}
+	return user, nil
+}
+
+// removeOverride deletes the Slack user override and its reverse link, it returns the Jira username it was linked to.
+func removeOverride(tx store.Store, instance *jiraclient.Instance, slackUserID string) (string, error) {
+	username := ""
+	if ok, err := tx.Get(overridesBucket, userKey(instance, slackUserID), &username); err != nil || !ok {
+		return "", err
+	}
+	if err := tx.Delete(overridesBucket, userKey(instance, slackUserID)); err != nil {
+		return "", err
+	}
+	linkedTo := ""
+	if ok, err := tx.Get(linkedBucket, userKey(instance, username), &linkedTo); err != nil {
+		return "", err
+	} else if ok && linkedTo != slackUserID {
+		// the account was linked to someone else since, their link stays
+		return username, nil
+	}
+	return username, tx.Delete(linkedBucket, userKey(instance, username))
+}
+
+// FindUser returns the Jira user by username. It returns error wrapping ErrNotMapped when there is no such user.
+func FindUser(ctx context.Context, instance *jiraclient.Instance, username string) (*jira.User, error) {
+	return getUser(ctx, instance, username, url.Values{"username": {username}})
+}
+
+// getUser fetches the full Jira user, the query selects the user either by "username" or "accountId".
+func getUser(ctx context.Context, instance *jiraclient.Instance, id string, query url.Values) (*jira.User, error) {
+	req, err := instance.Client.NewRequestWithContext(ctx, "GET", "rest/api/2/user?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	user := &jira.User{}
+	if resp, err := instance.Client.Do(req, user); err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: no jira user %s", ErrNotMapped, id)
+		}
+		return nil, fmt.Errorf("failed to get jira user %s: %v", id, jira.NewJiraError(resp, err))
+	}
+	return user, nil
+}
+
+// findByEmail returns the active Jira user with exactly matching email, or nil when there is none.
+// Jira Server searches by "username" (matching also emails), Jira Cloud by "query", so both are sent.
+func findByEmail(ctx context.Context, instance *jiraclient.Instance, email string) (*jira.User, error) {
+	query := url.Values{"username": {email}, "query": {email}}
+	req, err := instance.Client.NewRequestWithContext(ctx, "GET", "rest/api/2/user/search?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var users []jira.User
+	if resp, err := instance.Client.Do(req, &users); err != nil {
+		return nil, fmt.Errorf("failed to search jira users: %v", jira.NewJiraError(resp, err))
+	}
+	for i := range users {
+		if strings.EqualFold(users[i].EmailAddress, email) && users[i].Active {
+			return &users[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// QueryID returns the identifier used for the user in JQL (username on Jira Server, account ID on Jira Cloud).
+func QueryID(user *jira.User) string {
+	if len(user.Name) > 0 {
+		return user.Name
+	}
+	return user.AccountID
+}
+
+func userKey(instance *jiraclient.Instance, user string) string {
+	return instance.Name + "/" + user
+}
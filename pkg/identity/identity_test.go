@@ -0,0 +1,168 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/store"
+	"github.com/slack-go/slack"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestResolver(t *testing.T) (*Resolver, *jiraclient.Instance) {
+	slackUsers := map[string]slack.User{
+		"UADMIN": {ID: "UADMIN", IsAdmin: true, Profile: slack.UserProfile{Email: "admin@example.com"}},
+		"UOWNER": {ID: "UOWNER", IsOwner: true, Profile: slack.UserProfile{Email: "owner@example.com"}},
+		"UALICE": {ID: "UALICE", Profile: slack.UserProfile{Email: "alice@example.com"}},
+		"UBOB":   {ID: "UBOB", Profile: slack.UserProfile{Email: "bob@example.com"}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/users.lookupByEmail" {
+			for _, user := range slackUsers {
+				if user.Profile.Email == r.FormValue("email") {
+					json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "user": user})
+					return
+				}
+			}
+			w.Write([]byte(`{"ok": false, "error": "users_not_found"}`))
+			return
+		}
+		user, ok := slackUsers[r.FormValue("user")]
+		if r.URL.Path != "/users.info" || !ok {
+			w.Write([]byte(`{"ok": false, "error": "user_not_found"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "user": user})
+	}))
+	t.Cleanup(server.Close)
+
+	instance, err := jiraclient.NewInstance("jira", "Jira", "https://jira.example.com", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewResolver(slack.New("xoxb-test", slack.OptionAPIURL(server.URL+"/")), store.NewMemory()), instance
+}
+
+func TestSetOverride(t *testing.T) {
+	alice := &jira.User{Name: "alice", EmailAddress: "alice@example.com", Active: true}
+	aliceOther := &jira.User{Name: "asmith", EmailAddress: "asmith@example.org", Active: true}
+
+	tests := []struct {
+		name        string
+		links       [][2]string
+		actor, user string
+		jiraUser    *jira.User
+		expectErr   error
+	}{
+		{name: "own account with matching email", actor: "UALICE", user: "UALICE", jiraUser: alice, expectErr: ErrNotAllowed},
+		{name: "own account with other email", actor: "UALICE", user: "UALICE", jiraUser: aliceOther, expectErr: ErrNotAllowed},
+		{name: "other user", actor: "UBOB", user: "UALICE", jiraUser: alice, expectErr: ErrNotAllowed},
+		{name: "admin links themselves", actor: "UADMIN", user: "UADMIN", jiraUser: aliceOther},
+		{name: "admin links other user", actor: "UADMIN", user: "UALICE", jiraUser: aliceOther},
+		{name: "owner links other user", actor: "UOWNER", user: "UALICE", jiraUser: aliceOther},
+		{name: "account linked to another user", links: [][2]string{{"UADMIN", "UBOB"}}, actor: "UADMIN", user: "UALICE", jiraUser: alice, expectErr: ErrAlreadyLinked},
+		{name: "relink the same account", links: [][2]string{{"UADMIN", "UALICE"}}, actor: "UADMIN", user: "UALICE", jiraUser: alice},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			r, instance := newTestResolver(t)
+			for _, link := range test.links {
+				if err := r.SetOverride(ctx, instance, link[0], link[1], alice); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := r.SetOverride(ctx, instance, test.actor, test.user, test.jiraUser)
+			if test.expectErr != nil {
+				if !errors.Is(err, test.expectErr) {
+					t.Fatalf("expected %v, got %v", test.expectErr, err)
+				}
+				if _, ok, _ := r.Override(instance, test.user); ok {
+					t.Errorf("expected %s not to be linked", test.user)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if username, _, _ := r.Override(instance, test.user); username != test.jiraUser.Name {
+				t.Errorf("expected %s linked to %s, got %q", test.user, test.jiraUser.Name, username)
+			}
+			if slackUserID, err := r.SlackUserID(ctx, instance, test.jiraUser); err != nil || slackUserID != test.user {
+				t.Errorf("expected %s to resolve to %s, got %q (%v)", test.jiraUser.Name, test.user, slackUserID, err)
+			}
+		})
+	}
+}
+
+func TestSetOverrideReplacesPreviousLink(t *testing.T) {
+	ctx := context.Background()
+	r, instance := newTestResolver(t)
+	old := &jira.User{Name: "alice-old"}
+	alice := &jira.User{Name: "alice"}
+	if err := r.SetOverride(ctx, instance, "UADMIN", "UALICE", old); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetOverride(ctx, instance, "UADMIN", "UALICE", alice); err != nil {
+		t.Fatal(err)
+	}
+	// the old account is free to be linked by someone else
+	if err := r.SetOverride(ctx, instance, "UADMIN", "UBOB", old); err != nil {
+		t.Fatalf("expected the old account to be unlinked: %v", err)
+	}
+}
+
+func TestRemoveOverride(t *testing.T) {
+	ctx := context.Background()
+	alice := &jira.User{Name: "alice", EmailAddress: "alice@example.com", Active: true}
+
+	tests := []struct {
+		name        string
+		actor       string
+		expectErr   error
+		expectReset bool
+	}{
+		{name: "own link", actor: "UALICE", expectReset: true},
+		{name: "admin resets other user", actor: "UADMIN", expectReset: true},
+		{name: "other user", actor: "UBOB", expectErr: ErrNotAllowed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, instance := newTestResolver(t)
+			if err := r.SetOverride(ctx, instance, "UADMIN", "UALICE", alice); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.RemoveOverride(ctx, instance, test.actor, "UALICE"); !errors.Is(err, test.expectErr) {
+				t.Fatalf("expected %v, got %v", test.expectErr, err)
+			}
+			if _, ok, _ := r.Override(instance, "UALICE"); ok == test.expectReset {
+				t.Errorf("expected link removed %v, got %v", test.expectReset, !ok)
+			}
+			// the account is free again only when the link was removed
+			err := r.SetOverride(ctx, instance, "UADMIN", "UBOB", alice)
+			if test.expectReset && err != nil {
+				t.Errorf("expected the account to be unlinked: %v", err)
+			}
+			if !test.expectReset && !errors.Is(err, ErrAlreadyLinked) {
+				t.Errorf("expected the account to stay linked, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSlackUserIDByEmail(t *testing.T) {
+	r, instance := newTestResolver(t)
+	ctx := context.Background()
+	if id, err := r.SlackUserID(ctx, instance, &jira.User{Name: "bob", EmailAddress: "bob@example.com"}); err != nil || id != "UBOB" {
+		t.Errorf("expected bob mapped to UBOB, got %q %v", id, err)
+	}
+	if _, err := r.SlackUserID(ctx, instance, &jira.User{Name: "carol", EmailAddress: "carol@example.com"}); !errors.Is(err, ErrNotMapped) {
+		t.Errorf("expected user without Slack account not mapped, got %v", err)
+	}
+}
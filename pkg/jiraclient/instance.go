@@ -0,0 +1,161 @@
+package jiraclient
+
+import (
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/config"
+	"net/url"
+	"strings"
+)
+
+// Instance is a single Jira server Shodan talks to.
+type Instance struct {
+	Name        string
+	DisplayName string
+	BaseURL     *url.URL
+	Client      *jira.Client
+	// Projects are the project keys recognized as bare issue keys in messages.
+	Projects []string
+}
+
+// NewInstance returns a Jira instance authenticated with the given personal access token.
+// The baseURL can point to any server speaking Jira REST API (eg. httptest server in tests).
+func NewInstance(name, displayName, baseURL, token string) (*Instance, error) {
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jira url %q: %v", baseURL, err)
+	}
+	tp := jira.PATAuthTransport{Token: token}
+	client, err := jira.NewClient(tp.Client(), u.String())
+	if err != nil {
+		return nil, err
+	}
+	return &Instance{
+		Name:        name,
+		DisplayName: displayName,
+		BaseURL:     u,
+		Client:      client,
+	}, nil
+}
+
+// BrowseURL returns the URL of the issue in Jira web UI.
+func (i *Instance) BrowseURL(key string) string {
+	return i.BaseURL.String() + "browse/" + key
+}
+
+// CommentURL returns the permalink of the issue comment in Jira web UI.
+func (i *Instance) CommentURL(key, commentID string) string {
+	return fmt.Sprintf("%s?focusedCommentId=%s#comment-%s", i.BrowseURL(key), commentID, commentID)
+}
+
+// SearchURL returns the URL of the JQL search in Jira web UI.
+func (i *Instance) SearchURL(jql string) string {
+	return i.BaseURL.String() + "issues/?jql=" + url.QueryEscape(jql)
+}
+
+// FilterURL returns the URL of the saved filter in Jira web UI.
+func (i *Instance) FilterURL(filterID int) string {
+	return fmt.Sprintf("%sissues/?filter=%d", i.BaseURL.String(), filterID)
+}
+
+// BoardURL returns the URL of the agile board in Jira web UI.
+func (i *Instance) BoardURL(boardID int) string {
+	return fmt.Sprintf("%ssecure/RapidBoard.jspa?rapidView=%d", i.BaseURL.String(), boardID)
+}
+
+// RelativePath returns the path of u relative to the instance base URL or false if u does not belong to this instance.
+func (i *Instance) RelativePath(u *url.URL) (string, bool) {
+	if !strings.EqualFold(u.Hostname(), i.BaseURL.Hostname()) {
+		return "", false
+	}
+	if i.BaseURL.Port() != "" && u.Port() != i.BaseURL.Port() {
+		return "", false
+	}
+	path := u.Path
+	if !strings.HasSuffix(path, "/") && path+"/" == i.BaseURL.Path {
+		path += "/"
+	}
+	if !strings.HasPrefix(path, i.BaseURL.Path) {
+		return "", false
+	}
+	return strings.TrimPrefix(path, i.BaseURL.Path), true
+}
+
+// Instances is the list of all configured Jira instances.
+type Instances []*Instance
+
+// NewInstances builds Jira instances from configuration.
+func NewInstances(cfg []*config.JiraInstanceConfig) (Instances, error) {
+	var result Instances
+	for _, c := range cfg {
+		instance, err := NewInstance(c.Name, c.DisplayName, c.URL, c.Token)
+		if err != nil {
+			return nil, fmt.Errorf("jira instance %q: %v", c.Name, err)
+		}
+		instance.Projects = c.Projects
+		result = append(result, instance)
+	}
+	return result, nil
+}
+
+// ForURL returns the instance the URL points to and the path relative to its base URL.
+// When multiple instances match, the one with the longest base path wins.
+func (in Instances) ForURL(u *url.URL) (*Instance, string) {
+	var (
+		match        *Instance
+		relativePath string
+	)
+	for _, i := range in {
+		path, ok := i.RelativePath(u)
+		if !ok {
+			continue
+		}
+		if match == nil || len(i.BaseURL.Path) > len(match.BaseURL.Path) {
+			match, relativePath = i, path
+		}
+	}
+	return match, relativePath
+}
+
+// ByName returns the instance with the given name or nil.
+func (in Instances) ByName(name string) *Instance {
+	for _, i := range in {
+		if i.Name == name {
+			return i
+		}
+	}
+	return nil
+}
+
+// ForProject returns the instance that owns the given project key or nil.
+func (in Instances) ForProject(project string) *Instance {
+	for _, i := range in {
+		for _, p := range i.Projects {
+			if strings.EqualFold(p, project) {
+				return i
+			}
+		}
+	}
+	return nil
+}
+
+// ForKey returns the instance that owns the project of the issue key, falling back to the default instance.
+func (in Instances) ForKey(key string) *Instance {
+	if project := strings.SplitN(key, "-", 2)[0]; len(project) > 0 {
+		if instance := in.ForProject(project); instance != nil {
+			return instance
+		}
+	}
+	return in.Default()
+}
+
+// Default returns the first configured instance, used when the user does not say which instance they mean.
+func (in Instances) Default() *Instance {
+	if len(in) == 0 {
+		return nil
+	}
+	return in[0]
+}
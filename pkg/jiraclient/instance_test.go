@@ -0,0 +1,226 @@
+package jiraclient
+
+import (
+	"context"
+	"encoding/json"
+	jira "github.com/andygrunwald/go-jira"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testToken = "pat-token"
+
+// fakeJira serves the issue, search and transition endpoints of single API-1 issue.
+type fakeJira struct {
+	lock sync.Mutex
+	// requests are "METHOD path body" of the served requests
+	requests []string
+}
+
+func (f *fakeJira) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	f.lock.Lock()
+	f.requests = append(f.requests, strings.TrimSpace(r.Method+" "+r.URL.Path+" "+string(body)))
+	f.lock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"errorMessages": ["You are not authenticated."]}`))
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/jira/rest/api/2/issue/API-1":
+		w.Write([]byte(`{"key": "API-1", "fields": {"summary": "Login fails", "status": {"name": "New"}}}`))
+	case r.URL.Path == "/jira/rest/api/2/search":
+		if r.URL.Query().Get("jql") != "project = API" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errorMessages": ["Error in the JQL Query"]}`))
+			return
+		}
+		w.Write([]byte(`{"total": 1, "issues": [{"key": "API-1", "fields": {"summary": "Login fails"}}]}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/jira/rest/api/2/issue/API-1/transitions":
+		w.Write([]byte(`{"transitions": [{"id": "11", "name": "Start Progress", "to": {"name": "In Progress"}}, {"id": "21", "name": "Close", "to": {"name": "Closed"}}]}`))
+	case r.Method == http.MethodPost && r.URL.Path == "/jira/rest/api/2/issue/API-1/transitions":
+		w.WriteHeader(http.StatusNoContent)
+	case r.URL.Path == "/jira/rest/api/2/user/permission/search":
+		// only bob can transition API-1, the search matches user names by prefix
+		q := r.URL.Query()
+		if q.Get("issueKey") == "API-1" && q.Get("permissions") == "TRANSITION_ISSUES" && strings.HasPrefix("bobby", q.Get("username")) {
+			w.Write([]byte(`[{"name": "bobby"}, {"name": "bob"}]`))
+			return
+		}
+		w.Write([]byte(`[]`))
+	case r.Method == http.MethodPut && r.URL.Path == "/jira/rest/api/2/issue/API-1/assignee":
+		var assignee map[string]*string
+		json.Unmarshal(body, &assignee)
+		if name := assignee["name"]; name != nil && *name == "nobody" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors": {"assignee": "User 'nobody' does not exist."}}`))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/jira/rest/api/2/issue/"):
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errorMessages": ["Issue Does Not Exist"]}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestInstance(t *testing.T, token string) (*Instance, *fakeJira) {
+	t.Helper()
+	fake := &fakeJira{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	instance, err := NewInstance("test", "Test Jira", server.URL+"/jira", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return instance, fake
+}
+
+func TestInstanceRequests(t *testing.T) {
+	instance, _ := newTestInstance(t, testToken)
+	ctx := context.Background()
+
+	issue, _, err := instance.Client.Issue.GetWithContext(ctx, "API-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issue.Key != "API-1" || issue.Fields.Summary != "Login fails" {
+		t.Errorf("unexpected issue %+v", issue)
+	}
+
+	issues, _, err := instance.Client.Issue.SearchWithContext(ctx, "project = API", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 1 || issues[0].Key != "API-1" {
+		t.Errorf("unexpected search result %+v", issues)
+	}
+}
+
+func TestInstanceErrors(t *testing.T) {
+	ctx := context.Background()
+
+	unauthorized, _ := newTestInstance(t, "wrong")
+	_, resp, err := unauthorized.Client.Issue.GetWithContext(ctx, "API-1", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized error, got %v", err)
+	}
+
+	instance, _ := newTestInstance(t, testToken)
+	_, resp, err = instance.Client.Issue.GetWithContext(ctx, "API-2", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected not found error, got %v", err)
+	}
+
+	_, _, err = instance.Client.Issue.SearchWithContext(ctx, "project = ", nil)
+	if err == nil || !strings.Contains(err.Error(), "Error in the JQL Query") {
+		t.Errorf("expected JQL error, got %v", err)
+	}
+
+	if err := instance.Assign(ctx, "API-1", "nobody"); err == nil || !strings.Contains(err.Error(), "User 'nobody' does not exist.") {
+		t.Errorf("expected assignee error with Jira message, got %v", err)
+	}
+}
+
+func TestAssign(t *testing.T) {
+	instance, fake := newTestInstance(t, testToken)
+	for _, username := range []string{"bob", ""} {
+		if err := instance.Assign(context.Background(), "API-1", username); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []string{
+		`PUT /jira/rest/api/2/issue/API-1/assignee {"name":"bob"}`,
+		`PUT /jira/rest/api/2/issue/API-1/assignee {"name":null}`,
+	}
+	if strings.Join(fake.requests, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected requests:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(fake.requests, "\n"))
+	}
+}
+
+func TestTransitionTo(t *testing.T) {
+	tests := []struct {
+		name       string
+		transition string
+		status     string
+		err        bool
+	}{
+		{name: "by transition", transition: "start progress", status: "In Progress"},
+		{name: "by status", transition: "closed", status: "Closed"},
+		{name: "unknown", transition: "Verified", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			instance, _ := newTestInstance(t, testToken)
+			status, err := instance.TransitionTo(context.Background(), "API-1", test.transition)
+			if (err != nil) != test.err {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if status != test.status {
+				t.Errorf("expected status %q, got %q", test.status, status)
+			}
+		})
+	}
+}
+
+func TestUserHasPermission(t *testing.T) {
+	instance, _ := newTestInstance(t, testToken)
+	for username, expected := range map[string]bool{"bob": true, "bo": false, "alice": false} {
+		allowed, err := instance.UserHasPermission(context.Background(), "API-1", &jira.User{Name: username}, "TRANSITION_ISSUES")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != expected {
+			t.Errorf("expected %s allowed %v, got %v", username, expected, allowed)
+		}
+	}
+}
+
+func TestInstancesForURL(t *testing.T) {
+	var instances Instances
+	for _, u := range []string{"https://issues.example.com", "https://internal.example.com/jira", "https://internal.example.com/jira/staging"} {
+		instance, err := NewInstance(u, u, u, "token")
+		if err != nil {
+			t.Fatal(err)
+		}
+		instances = append(instances, instance)
+	}
+
+	tests := []struct {
+		url      string
+		instance string
+		path     string
+	}{
+		{url: "https://issues.example.com/browse/API-1", instance: "https://issues.example.com", path: "browse/API-1"},
+		{url: "https://ISSUES.example.com/browse/API-1", instance: "https://issues.example.com", path: "browse/API-1"},
+		{url: "https://internal.example.com/jira/browse/API-1", instance: "https://internal.example.com/jira", path: "browse/API-1"},
+		{url: "https://internal.example.com/jira/staging/browse/API-1", instance: "https://internal.example.com/jira/staging", path: "browse/API-1"},
+		{url: "https://internal.example.com/other/browse/API-1"},
+		{url: "https://unknown.example.com/browse/API-1"},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			u, err := url.Parse(test.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			instance, path := instances.ForURL(u)
+			name := ""
+			if instance != nil {
+				name = instance.Name
+			}
+			if name != test.instance || path != test.path {
+				t.Errorf("expected %q %q, got %q %q", test.instance, test.path, name, path)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package jiraclient
+
+import (
+	"context"
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"net/url"
+	"strings"
+)
+
+// Assign sets the issue assignee to the Jira user, empty username unassigns the issue.
+// jira.User can't be used for unassigning, because it omits empty name and Jira requires explicit null.
+func (i *Instance) Assign(ctx context.Context, key, username string) error {
+	body := map[string]interface{}{"name": nil}
+	if len(username) > 0 {
+		body["name"] = username
+	}
+	req, err := i.Client.NewRequestWithContext(ctx, "PUT", fmt.Sprintf("rest/api/2/issue/%s/assignee", key), body)
+	if err != nil {
+		return err
+	}
+	if resp, err := i.Client.Do(req, nil); err != nil {
+		return jira.NewJiraError(resp, err)
+	}
+	return nil
+}
+
+// TransitionTo moves the issue through the workflow transition with the given name, or the transition leading to
+// the status with the given name. It returns the name of the new status.
+func (i *Instance) TransitionTo(ctx context.Context, key, name string) (string, error) {
+	transitions, _, err := i.Client.Issue.GetTransitionsWithContext(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to get transitions of %s: %v", key, err)
+	}
+	for _, t := range transitions {
+		if !strings.EqualFold(t.Name, name) && !strings.EqualFold(t.To.Name, name) {
+			continue
+		}
+		if _, err := i.Client.Issue.DoTransitionWithContext(ctx, key, t.ID); err != nil {
+			return "", fmt.Errorf("failed to transition %s: %v", key, err)
+		}
+		return t.To.Name, nil
+	}
+	return "", fmt.Errorf("%s can't be moved to %q from its current status", key, name)
+}
+
+// UserHasPermission returns true when the Jira user has the project permission (eg. "TRANSITION_ISSUES") for the issue.
+// Shodan acts with its own account, so this is how actions are checked against the permissions of the Slack user.
+func (i *Instance) UserHasPermission(ctx context.Context, key string, user *jira.User, permission string) (bool, error) {
+	query := url.Values{"permissions": {permission}, "issueKey": {key}}
+	if len(user.Name) > 0 {
+		query.Set("username", user.Name)
+	} else {
+		query.Set("accountId", user.AccountID)
+	}
+	req, err := i.Client.NewRequestWithContext(ctx, "GET", "rest/api/2/user/permission/search?"+query.Encode(), nil)
+	if err != nil {
+		return false, err
+	}
+	var users []jira.User
+	if resp, err := i.Client.Do(req, &users); err != nil {
+		return false, jira.NewJiraError(resp, err)
+	}
+	for _, u := range users {
+		if (len(user.Name) > 0 && strings.EqualFold(u.Name, user.Name)) || (len(user.AccountID) > 0 && u.AccountID == user.AccountID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,239 @@
+package markup
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	codeBlockPattern  = regexp.MustCompile(`(?s)\{(code|noformat)(?::[^}]*)?\}(.*?)\{(?:code|noformat)\}`)
+	quoteBlockPattern = regexp.MustCompile(`(?s)\{quote\}(.*?)\{quote\}`)
+	ignoredTagPattern = regexp.MustCompile(`\{(?:color|panel|anchor)(?::[^}]*)?\}`)
+
+	headingPattern = regexp.MustCompile(`^h[1-6]\.\s+(.*)$`)
+	quotePattern   = regexp.MustCompile(`^bq\.\s+(.*)$`)
+	listPattern    = regexp.MustCompile(`^([*#-]+)\s+(.*)$`)
+	rulePattern    = regexp.MustCompile(`^-{4,}\s*$`)
+
+	userMentionPattern = regexp.MustCompile(`\[~(?:accountid:)?([^\]\n]+)\]`)
+	linkPattern        = regexp.MustCompile(`\[([^|\]\n]+)\|([^\]\n]+)\]`)
+	bareLinkPattern    = regexp.MustCompile(`\[((?:https?|mailto|ftp)[^|\]\n]+)\]`)
+	monospacePattern   = regexp.MustCompile(`\{\{(.+?)\}\}`)
+	strikePattern      = regexp.MustCompile(`(^|[\s(])-([^\s-](?:[^-\n]*[^\s-])?)-($|[\s).,;:!?])`)
+	underlinePattern   = regexp.MustCompile(`(^|[\s(])\+([^\s+](?:[^+\n]*[^\s+])?)\+($|[\s).,;:!?])`)
+	citationPattern    = regexp.MustCompile(`\?\?(.+?)\?\?`)
+	superscriptPattern = regexp.MustCompile(`\^([^\s^]+?)\^`)
+	subscriptPattern   = regexp.MustCompile(`(\S)~([^\s~]+?)~`)
+	imagePattern       = regexp.MustCompile(`!([^\s!|]+\.[^\s!|]+)(?:\|[^!\n]*)?!`)
+)
+
+// Converter converts Jira wiki markup to Slack mrkdwn.
+type Converter struct {
+	// UserMention renders the Jira user mention ([~username]). When not set, mentions are rendered as "@username".
+	UserMention func(username string) string
+}
+
+// ToSlack converts Jira wiki markup to Slack mrkdwn using the default converter.
+func ToSlack(text string) string {
+	return (&Converter{}).ToSlack(text)
+}
+
+// ToSlack converts Jira wiki markup to Slack mrkdwn.
+//
+// Supported are headings, bold, italic, strikethrough, monospace, code and noformat blocks, quotes, links, images,
+// user mentions, bullet and numbered lists and tables (flattened to one line per row).
+// Markup Slack has no equivalent for (colors, panels, underline, ...) is dropped, keeping the text.
+func (c *Converter) ToSlack(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	// code blocks are converted first and kept verbatim, everything else is converted only outside of them
+	var result strings.Builder
+	for {
+		loc := codeBlockPattern.FindStringSubmatchIndex(text)
+		if loc == nil {
+			result.WriteString(c.convertBlocks(text))
+			break
+		}
+		result.WriteString(c.convertBlocks(text[:loc[0]]))
+		result.WriteString("\n```\n" + escape(strings.Trim(text[loc[4]:loc[5]], "\n")) + "\n```\n")
+		text = text[loc[1]:]
+	}
+	return strings.TrimSpace(collapseEmptyLines(result.String()))
+}
+
+// convertBlocks converts the text that does not contain any code blocks.
+func (c *Converter) convertBlocks(text string) string {
+	text = ignoredTagPattern.ReplaceAllString(text, "")
+	text = quoteBlockPattern.ReplaceAllStringFunc(text, func(quote string) string {
+		inner := strings.Trim(quoteBlockPattern.FindStringSubmatch(quote)[1], "\n")
+		lines := strings.Split(inner, "\n")
+		for i := range lines {
+			lines[i] = "bq. " + lines[i]
+		}
+		return "\n" + strings.Join(lines, "\n") + "\n"
+	})
+
+	var (
+		lines []string
+		// numbers tracks the counter of numbered lists for each nesting level
+		numbers []int
+	)
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if !listPattern.MatchString(trimmed) || rulePattern.MatchString(trimmed) {
+			numbers = nil
+		}
+
+		switch {
+		case rulePattern.MatchString(trimmed):
+			lines = append(lines, "──────────")
+		case headingPattern.MatchString(trimmed):
+			heading := strings.TrimSpace(c.convertInline(headingPattern.FindStringSubmatch(trimmed)[1]))
+			lines = append(lines, "*"+strings.Trim(heading, "*")+"*")
+		case quotePattern.MatchString(trimmed):
+			// quote marker must not be escaped
+			lines = append(lines, "> "+c.convertInline(quotePattern.FindStringSubmatch(trimmed)[1]))
+		case isTableRow(trimmed):
+			lines = append(lines, c.convertTableRow(trimmed))
+		case listPattern.MatchString(trimmed) && isList(trimmed):
+			match := listPattern.FindStringSubmatch(trimmed)
+			var marker string
+			marker, numbers = listMarker(match[1], numbers)
+			lines = append(lines, strings.Repeat("    ", len(match[1])-1)+marker+" "+c.convertInline(match[2]))
+		default:
+			lines = append(lines, c.convertInline(line))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// convertInline converts markup used within single line of text.
+func (c *Converter) convertInline(text string) string {
+	text = escape(text)
+
+	// monospace content is kept verbatim, so it is swapped for placeholders while the rest of the line is converted
+	var monospaced []string
+	text = monospacePattern.ReplaceAllStringFunc(text, func(s string) string {
+		monospaced = append(monospaced, "`"+monospacePattern.FindStringSubmatch(s)[1]+"`")
+		return fmt.Sprintf("\x00%d\x00", len(monospaced)-1)
+	})
+
+	text = userMentionPattern.ReplaceAllStringFunc(text, func(s string) string {
+		username := userMentionPattern.FindStringSubmatch(s)[1]
+		if c.UserMention != nil {
+			return c.UserMention(username)
+		}
+		return "@" + username
+	})
+	text = imagePattern.ReplaceAllStringFunc(text, func(s string) string {
+		source := imagePattern.FindStringSubmatch(s)[1]
+		if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+			return "<" + source + "|:frame_with_picture: image>"
+		}
+		// attachments can't be linked without knowing the issue, so just the file name is shown
+		return ":frame_with_picture: " + source
+	})
+	text = linkPattern.ReplaceAllString(text, "<$2|$1>")
+	text = bareLinkPattern.ReplaceAllString(text, "<$1>")
+	// sub/superscript must go before strikethrough, as both "~" forms would be ambiguous afterwards
+	text = superscriptPattern.ReplaceAllString(text, "$1")
+	text = subscriptPattern.ReplaceAllString(text, "$1$2")
+	text = strikePattern.ReplaceAllString(text, "$1~$2~$3")
+	text = underlinePattern.ReplaceAllString(text, "$1$2$3")
+	text = citationPattern.ReplaceAllString(text, "_— ${1}_")
+	text = strings.ReplaceAll(text, `\\`, "\n")
+
+	for i, m := range monospaced {
+		text = strings.Replace(text, fmt.Sprintf("\x00%d\x00", i), m, 1)
+	}
+	return text
+}
+
+// isList distinguishes list items from bold text at the beginning of the line ("*bold* text").
+func isList(line string) bool {
+	match := listPattern.FindStringSubmatch(line)
+	if match[1][0] == '-' && len(match[1]) > 1 {
+		return false
+	}
+	return true
+}
+
+// listMarker returns the marker for list item at the nesting level given by the Jira list prefix ("*", "##", "*#").
+func listMarker(prefix string, numbers []int) (string, []int) {
+	level := len(prefix)
+	if len(numbers) > level {
+		numbers = numbers[:level]
+	}
+	for len(numbers) < level {
+		numbers = append(numbers, 0)
+	}
+
+	switch prefix[level-1] {
+	case '#':
+		numbers[level-1]++
+		return fmt.Sprintf("%d.", numbers[level-1]), numbers
+	default:
+		numbers[level-1] = 0
+		if level%2 == 0 {
+			return "◦", numbers
+		}
+		return "•", numbers
+	}
+}
+
+func isTableRow(line string) bool {
+	return strings.HasPrefix(line, "|") && strings.HasSuffix(line, "|") && len(line) > 1
+}
+
+// convertTableRow flattens the table row into "cell | cell", header cells (||header||) are rendered bold.
+func (c *Converter) convertTableRow(line string) string {
+	header := strings.HasPrefix(line, "||")
+
+	var cells []string
+	for _, cell := range splitCells(line) {
+		if cell = strings.TrimSpace(cell); len(cell) == 0 {
+			continue
+		}
+		cell = c.convertInline(cell)
+		if header {
+			cell = "*" + strings.Trim(cell, "*") + "*"
+		}
+		cells = append(cells, cell)
+	}
+	return strings.Join(cells, " | ")
+}
+
+// splitCells splits the table row on "|", except for the ones inside links ([text|url]).
+func splitCells(line string) []string {
+	var (
+		cells []string
+		cell  strings.Builder
+		depth int
+	)
+	for _, r := range line {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']' && depth > 0:
+			depth--
+		case r == '|' && depth == 0:
+			cells = append(cells, cell.String())
+			cell.Reset()
+			continue
+		}
+		cell.WriteRune(r)
+	}
+	return append(cells, cell.String())
+}
+
+func collapseEmptyLines(text string) string {
+	for strings.Contains(text, "\n\n\n") {
+		text = strings.ReplaceAll(text, "\n\n\n", "\n\n")
+	}
+	return text
+}
+
+func escape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
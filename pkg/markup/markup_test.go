@@ -0,0 +1,240 @@
+package markup
+
+import (
+	"testing"
+)
+
+func TestToSlack(t *testing.T) {
+	tests := []struct {
+		name     string
+		markup   string
+		expected string
+	}{
+		{
+			name:     "heading",
+			markup:   "h1. Overview\ntext",
+			expected: "*Overview*\ntext",
+		},
+		{
+			name:     "bold heading",
+			markup:   "h3. *Steps*",
+			expected: "*Steps*",
+		},
+		{
+			name:     "bold and italic",
+			markup:   "*bold* and _italic_",
+			expected: "*bold* and _italic_",
+		},
+		{
+			name:     "bold at line start is not a list",
+			markup:   "*bold* text",
+			expected: "*bold* text",
+		},
+		{
+			name:     "strikethrough",
+			markup:   "this is -deleted- text",
+			expected: "this is ~deleted~ text",
+		},
+		{
+			name:     "hyphenated words are not strikethrough",
+			markup:   "a well-known non-issue",
+			expected: "a well-known non-issue",
+		},
+		{
+			name:     "monospace",
+			markup:   "run {{make -j 4}} now",
+			expected: "run `make -j 4` now",
+		},
+		{
+			name:     "monospace keeps markup",
+			markup:   "{{*not bold* -x-}}",
+			expected: "`*not bold* -x-`",
+		},
+		{
+			name:     "code block",
+			markup:   "before\n{code:go}\nif a < b {\n\t*x* = -1-\n}\n{code}\nafter",
+			expected: "before\n\n```\nif a &lt; b {\n\t*x* = -1-\n}\n```\n\nafter",
+		},
+		{
+			name:     "noformat block",
+			markup:   "{noformat}\n[~alice] {{x}}\n{noformat}",
+			expected: "```\n[~alice] {{x}}\n```",
+		},
+		{
+			name:     "quote",
+			markup:   "bq. quoted *text*",
+			expected: "> quoted *text*",
+		},
+		{
+			name:     "quote block",
+			markup:   "{quote}\nfirst\nsecond\n{quote}",
+			expected: "> first\n> second",
+		},
+		{
+			name:     "link",
+			markup:   "see [the docs|https://example.com/docs]",
+			expected: "see <https://example.com/docs|the docs>",
+		},
+		{
+			name:     "bare link",
+			markup:   "see [https://example.com]",
+			expected: "see <https://example.com>",
+		},
+		{
+			name:     "remote image",
+			markup:   "!https://example.com/a.png|thumbnail!",
+			expected: "<https://example.com/a.png|:frame_with_picture: image>",
+		},
+		{
+			name:     "attached image",
+			markup:   "!screenshot.png!",
+			expected: ":frame_with_picture: screenshot.png",
+		},
+		{
+			name:     "mention",
+			markup:   "thanks [~alice] and [~accountid:5b10ac8d82e05b22cc7d4ef5]",
+			expected: "thanks @alice and @5b10ac8d82e05b22cc7d4ef5",
+		},
+		{
+			name:     "escaping",
+			markup:   "a < b && c > d",
+			expected: "a &lt; b &amp;&amp; c &gt; d",
+		},
+		{
+			name:     "nested list",
+			markup:   "* one\n** nested\n*** deeper\n* two",
+			expected: "• one\n    ◦ nested\n        • deeper\n• two",
+		},
+		{
+			name:     "numbered list",
+			markup:   "# first\n# second\n## sub\n## sub\n# third",
+			expected: "1. first\n2. second\n    1. sub\n    2. sub\n3. third",
+		},
+		{
+			name:     "numbering restarts after text",
+			markup:   "# first\ntext\n# again",
+			expected: "1. first\ntext\n1. again",
+		},
+		{
+			name:     "dash list",
+			markup:   "- one\n- two",
+			expected: "• one\n• two",
+		},
+		{
+			name:     "horizontal rule",
+			markup:   "above\n----\nbelow",
+			expected: "above\n──────────\nbelow",
+		},
+		{
+			name:     "table",
+			markup:   "||Name||Link||\n|docs|[home|https://example.com]|",
+			expected: "*Name* | *Link*\ndocs | <https://example.com|home>",
+		},
+		{
+			name:     "dropped markup",
+			markup:   "{color:red}+red+{color} text",
+			expected: "red text",
+		},
+		{
+			name:     "line break",
+			markup:   `one\\two`,
+			expected: "one\ntwo",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := ToSlack(test.markup); result != test.expected {
+				t.Errorf("expected:\n%q\ngot:\n%q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestUserMention(t *testing.T) {
+	converter := &Converter{UserMention: func(username string) string { return "<@U" + username + ">" }}
+	if result := converter.ToSlack("ping [~alice]"); result != "ping <@Ualice>" {
+		t.Errorf("unexpected result %q", result)
+	}
+}
+
+func TestFromSlack(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{
+			name:     "plain text",
+			text:     "Login fails",
+			expected: "Login fails",
+		},
+		{
+			name:     "bold and italic",
+			text:     "*bold* and _italic_",
+			expected: "*bold* and _italic_",
+		},
+		{
+			name:     "strikethrough",
+			text:     "this is ~deleted~ text",
+			expected: "this is -deleted- text",
+		},
+		{
+			name:     "jira markup is escaped",
+			text:     "[WIP] fix {code} in a|b and C:\\temp",
+			expected: "\\[WIP\\] fix \\{code\\} in a\\|b and C:\\\\temp",
+		},
+		{
+			name:     "slack escapes",
+			text:     "a &lt; b &amp;&amp; c &gt; d",
+			expected: "a < b && c > d",
+		},
+		{
+			name:     "inline code",
+			text:     "run `make [all]` now",
+			expected: "run {{make [all]}} now",
+		},
+		{
+			name:     "code block",
+			text:     "before\n```\nif a &lt; b {\n  *x* = [1]\n}\n```\nafter",
+			expected: "before\n\n{noformat}\nif a < b {\n  *x* = [1]\n}\n{noformat}\n\nafter",
+		},
+		{
+			name:     "link",
+			text:     "see <https://example.com/a?b=1&amp;c=2|the [docs]>",
+			expected: "see [the (docs)|https://example.com/a?b=1&c=2]",
+		},
+		{
+			name:     "bare link",
+			text:     "see <https://example.com> and <https://example.com|https://example.com>",
+			expected: "see [https://example.com] and [https://example.com]",
+		},
+		{
+			name:     "mention",
+			text:     "thanks <@U123> and <@U456|bob>",
+			expected: "thanks [~alice] and @U456",
+		},
+		{
+			name:     "quote",
+			text:     "&gt; quoted\n> typed quote\nnot quoted &gt; here",
+			expected: "bq. quoted\nbq. typed quote\nnot quoted > here",
+		},
+		{
+			name:     "bullets",
+			text:     "• one\n    ◦ nested",
+			expected: "* one\n** nested",
+		},
+	}
+	mention := func(id string) string {
+		if id == "U123" {
+			return "[~alice]"
+		}
+		return ""
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := FromSlack(test.text, mention); result != test.expected {
+				t.Errorf("expected:\n%q\ngot:\n%q", test.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package markup
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	slackCodeBlockPattern = regexp.MustCompile("(?s)```(.*?)```")
+	// slackTokenPattern matches inline code, user mentions and links, which are converted as a whole
+	slackTokenPattern  = regexp.MustCompile("`[^`\n]+`|<@[A-Z0-9]+(?:\\|[^>]*)?>|<(?:https?|mailto):[^>]+>")
+	slackMentionID     = regexp.MustCompile(`^<@([A-Z0-9]+)`)
+	slackStrikePattern = regexp.MustCompile(`(^|[\s(])~([^\s~](?:[^~\n]*[^\s~])?)~($|[\s).,;:!?])`)
+	slackQuotePattern  = regexp.MustCompile(`(?m)^(?:&gt;|>)\s?`)
+	slackBulletPattern = regexp.MustCompile(`(?m)^\s*[•◦]\s+`)
+
+	jiraEscaper = strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, "{", `\{`, "}", `\}`, "|", `\|`)
+)
+
+// FromSlack converts Slack mrkdwn (as found in messages) to Jira wiki markup.
+// Characters Jira would read as markup ("[", "{", ...) are escaped. User mentions are rendered by mention,
+// when it is nil or returns empty string they are kept as "@<user ID>".
+func FromSlack(text string, mention func(slackUserID string) string) string {
+	// code blocks are kept verbatim, everything else is converted only outside of them
+	var result strings.Builder
+	for {
+		loc := slackCodeBlockPattern.FindStringSubmatchIndex(text)
+		if loc == nil {
+			result.WriteString(fromSlackText(text, mention))
+			break
+		}
+		result.WriteString(fromSlackText(text[:loc[0]], mention))
+		result.WriteString("\n{noformat}\n" + unescapeSlack(strings.Trim(text[loc[2]:loc[3]], "\n")) + "\n{noformat}\n")
+		text = text[loc[1]:]
+	}
+	return strings.TrimSpace(collapseEmptyLines(result.String()))
+}
+
+// fromSlackText converts the text that does not contain any code blocks.
+func fromSlackText(text string, mention func(slackUserID string) string) string {
+	// tokens are swapped for placeholders, so their content is not escaped with the rest of the text
+	var tokens []string
+	text = slackTokenPattern.ReplaceAllStringFunc(text, func(s string) string {
+		tokens = append(tokens, convertSlackToken(s, mention))
+		return fmt.Sprintf("\x00%d\x00", len(tokens)-1)
+	})
+
+	text = slackQuotePattern.ReplaceAllString(text, "bq. ")
+	text = slackBulletPattern.ReplaceAllStringFunc(text, func(s string) string {
+		if strings.Contains(s, "◦") {
+			return "** "
+		}
+		return "* "
+	})
+	text = jiraEscaper.Replace(unescapeSlack(text))
+	text = slackStrikePattern.ReplaceAllString(text, "${1}-${2}-${3}")
+
+	for i, token := range tokens {
+		text = strings.Replace(text, fmt.Sprintf("\x00%d\x00", i), token, 1)
+	}
+	return text
+}
+
+// convertSlackToken converts inline code ("`code`"), user mention ("<@U123>") or link ("<url|text>") to Jira markup.
+func convertSlackToken(token string, mention func(slackUserID string) string) string {
+	switch {
+	case strings.HasPrefix(token, "`"):
+		return "{{" + unescapeSlack(strings.Trim(token, "`")) + "}}"
+	case strings.HasPrefix(token, "<@"):
+		id := slackMentionID.FindStringSubmatch(token)[1]
+		if mention != nil {
+			if s := mention(id); len(s) > 0 {
+				return s
+			}
+		}
+		return "@" + id
+	}
+	url, label, ok := strings.Cut(strings.Trim(token, "<>"), "|")
+	url = unescapeSlack(url)
+	if !ok || len(label) == 0 || label == url {
+		return "[" + url + "]"
+	}
+	return "[" + strings.NewReplacer("[", "(", "]", ")", "|", "/").Replace(unescapeSlack(label)) + "|" + url + "]"
+}
+
+// unescapeSlack turns the characters Slack escapes in messages back.
+func unescapeSlack(text string) string {
+	return strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&").Replace(text)
+}
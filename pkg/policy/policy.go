@@ -0,0 +1,102 @@
+package policy
+
+import (
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/config"
+	"strings"
+)
+
+// Action is what happens with the unfurl of an issue in a channel.
+type Action string
+
+const (
+	// Allow unfurls the issue with all details.
+	Allow Action = "allow"
+	// Redact unfurls the issue only as "restricted issue" without any details.
+	Redact Action = "redact"
+	// Skip does not unfurl the issue at all.
+	Skip Action = "skip"
+)
+
+// restrictedRule is always evaluated after the configured rules, so security-level issues are never unfurled
+// with details unless some rule explicitly allows it.
+var restrictedRule = &config.PolicyRule{SecurityLevels: []string{"*"}, Action: string(Redact)}
+
+// Policy decides whether an issue can be unfurled in a channel.
+type Policy struct {
+	rules []*config.PolicyRule
+}
+
+func New(rules []*config.PolicyRule) *Policy {
+	return &Policy{rules: append(append([]*config.PolicyRule{}, rules...), restrictedRule)}
+}
+
+// Evaluate returns the action of the first rule matching the channel and issue.
+// Issues not matched by any rule are allowed.
+func (p *Policy) Evaluate(channel string, issue *jira.Issue) Action {
+	for _, rule := range p.rules {
+		if matches(rule, channel, issue) {
+			return Action(rule.Action)
+		}
+	}
+	return Allow
+}
+
+func matches(rule *config.PolicyRule, channel string, issue *jira.Issue) bool {
+	if len(rule.Channels) > 0 && !contains(rule.Channels, channel) {
+		return false
+	}
+	if issue.Fields == nil {
+		// without fields we can't tell anything about the issue, only channel rules apply
+		return len(rule.Projects) == 0 && len(rule.Labels) == 0 && len(rule.SecurityLevels) == 0
+	}
+	if len(rule.Projects) > 0 && !contains(rule.Projects, issue.Fields.Project.Key) {
+		return false
+	}
+	if len(rule.Labels) > 0 && !containsAny(rule.Labels, issue.Fields.Labels) {
+		return false
+	}
+	if len(rule.SecurityLevels) > 0 {
+		level := SecurityLevel(issue)
+		if level == "" || !(contains(rule.SecurityLevels, "*") || contains(rule.SecurityLevels, level)) {
+			return false
+		}
+	}
+	return true
+}
+
+// SecurityLevel returns the name of the issue security level or empty string when the issue is not restricted.
+// go-jira does not know the security field, so it is read from the unknown fields.
+func SecurityLevel(issue *jira.Issue) string {
+	if issue.Fields == nil || issue.Fields.Unknowns == nil {
+		return ""
+	}
+	security, ok := issue.Fields.Unknowns["security"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	name, _ := security["name"].(string)
+	if name == "" {
+		// the level is set, but we don't know its name
+		name, _ = security["id"].(string)
+	}
+	return name
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(list []string, values []string) bool {
+	for _, v := range values {
+		if contains(list, v) {
+			return true
+		}
+	}
+	return false
+}
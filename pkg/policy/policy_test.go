@@ -0,0 +1,69 @@
+package policy
+
+import (
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/config"
+	"testing"
+)
+
+func issue(project string, labels []string, security map[string]interface{}) *jira.Issue {
+	fields := &jira.IssueFields{Project: jira.Project{Key: project}, Labels: labels}
+	if security != nil {
+		fields.Unknowns = map[string]interface{}{"security": security}
+	}
+	return &jira.Issue{Key: project + "-1", Fields: fields}
+}
+
+func TestEvaluate(t *testing.T) {
+	rules := []*config.PolicyRule{
+		// security team sees everything in its channel
+		{Channels: []string{"CSEC"}, Action: "allow"},
+		// embargoed issues are not unfurled in the public channel at all
+		{Channels: []string{"CPUBLIC"}, Labels: []string{"embargo"}, Action: "skip"},
+		{Projects: []string{"SECRET"}, Action: "skip"},
+		{Projects: []string{"INTERNAL"}, Channels: []string{"CPUBLIC"}, Action: "redact"},
+		{SecurityLevels: []string{"Partner"}, Channels: []string{"CPARTNER"}, Action: "allow"},
+	}
+	embargo := map[string]interface{}{"name": "Embargoed"}
+
+	tests := []struct {
+		name     string
+		channel  string
+		issue    *jira.Issue
+		expected Action
+	}{
+		{name: "unmatched issue is allowed", channel: "CPUBLIC", issue: issue("API", nil, nil), expected: Allow},
+		{name: "denied project", channel: "CPUBLIC", issue: issue("SECRET", nil, nil), expected: Skip},
+		{name: "denied project case insensitive", channel: "COTHER", issue: issue("secret", nil, nil), expected: Skip},
+		{name: "project redacted in single channel", channel: "CPUBLIC", issue: issue("INTERNAL", nil, nil), expected: Redact},
+		{name: "project allowed in other channels", channel: "COTHER", issue: issue("INTERNAL", nil, nil), expected: Allow},
+		{name: "label in channel", channel: "CPUBLIC", issue: issue("API", []string{"ui", "Embargo"}, nil), expected: Skip},
+		{name: "label in other channel", channel: "COTHER", issue: issue("API", []string{"embargo"}, nil), expected: Allow},
+		{name: "security level defaults to redact", channel: "CPUBLIC", issue: issue("API", nil, embargo), expected: Redact},
+		{name: "security level by id defaults to redact", channel: "CPUBLIC", issue: issue("API", nil, map[string]interface{}{"id": "10100"}), expected: Redact},
+		{name: "security level allowed by channel override", channel: "CSEC", issue: issue("API", nil, embargo), expected: Allow},
+		{name: "channel override wins over project", channel: "CSEC", issue: issue("SECRET", nil, nil), expected: Allow},
+		{name: "named security level allowed", channel: "CPARTNER", issue: issue("API", nil, map[string]interface{}{"name": "partner"}), expected: Allow},
+		{name: "other security level in partner channel", channel: "CPARTNER", issue: issue("API", nil, embargo), expected: Redact},
+		{name: "issue without fields", channel: "CPUBLIC", issue: &jira.Issue{Key: "API-1"}, expected: Allow},
+		{name: "issue without fields in override channel", channel: "CSEC", issue: &jira.Issue{Key: "API-1"}, expected: Allow},
+	}
+	policy := New(rules)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if action := policy.Evaluate(test.channel, test.issue); action != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, action)
+			}
+		})
+	}
+}
+
+func TestEvaluateWithoutRules(t *testing.T) {
+	policy := New(nil)
+	if action := policy.Evaluate("C1", issue("API", nil, nil)); action != Allow {
+		t.Errorf("expected public issue allowed, got %s", action)
+	}
+	if action := policy.Evaluate("C1", issue("API", nil, map[string]interface{}{"name": "Red Hat Employee"})); action != Redact {
+		t.Errorf("expected restricted issue redacted, got %s", action)
+	}
+}
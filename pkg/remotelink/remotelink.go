@@ -0,0 +1,176 @@
+package remotelink
+
+import (
+	"context"
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/config"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/policy"
+	"github.com/mfojtik/shodan/pkg/store"
+	"github.com/mfojtik/shodan/pkg/unfurl"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// linkedBucket records threads already linked to issues, keyed by "<instance>/<key>/<channel>/<thread>".
+	linkedBucket = "remote-links"
+	// linkedMemory is how long linked threads are remembered, older threads are deduplicated by Jira itself.
+	linkedMemory = 30 * 24 * time.Hour
+	// requestTimeout bounds linking a single thread.
+	requestTimeout = 30 * time.Second
+)
+
+// Linker adds Jira remote links pointing to the Slack threads where issues are discussed.
+type Linker struct {
+	instances   jiraclient.Instances
+	slackClient *slack.Client
+	policy      *policy.Policy
+	store       store.Store
+
+	channels map[string]bool
+	reaction string
+
+	// lock serializes the check and record of linked threads, so concurrent unfurls of the same issue link it once
+	lock sync.Mutex
+	// pruned is when old linked threads were forgotten last time
+	pruned time.Time
+}
+
+func New(instances jiraclient.Instances, slackClient *slack.Client, visibility *policy.Policy, s store.Store, cfg *config.RemoteLinkConfig) *Linker {
+	l := &Linker{
+		instances:   instances,
+		slackClient: slackClient,
+		policy:      visibility,
+		store:       s,
+		channels:    map[string]bool{},
+		reaction:    cfg.Reaction,
+	}
+	for _, c := range cfg.Channels {
+		l.channels[c] = true
+	}
+	return l
+}
+
+// HandleShared links the thread to the issue unfurled in one of the configured channels.
+func (l *Linker) HandleShared(ctx context.Context, shared *unfurl.Shared) {
+	if !l.channels[shared.Channel] {
+		return
+	}
+	if err := l.LinkThread(ctx, shared.Instance, shared.Key, shared.Channel, shared.ThreadTimeStamp); err != nil {
+		log.Printf("failed to link %s to slack thread: %v", shared.Key, err)
+	}
+}
+
+// HandleReactionAdded links all issues mentioned in the message to its thread, when the configured reaction was added.
+func (l *Linker) HandleReactionAdded(ev *slackevents.ReactionAddedEvent) error {
+	if len(l.reaction) == 0 || ev.Reaction != l.reaction || ev.Item.Type != "message" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	message, err := unfurl.GetMessage(ctx, l.slackClient, ev.Item.Channel, ev.Item.Timestamp)
+	if err != nil {
+		return err
+	}
+	threadTimeStamp := message.ThreadTimestamp
+	if len(threadTimeStamp) == 0 {
+		threadTimeStamp = message.Timestamp
+	}
+	for _, issue := range unfurl.FindIssues(message.Text, l.instances) {
+		if err := l.LinkThread(ctx, issue.Instance, issue.Key, ev.Item.Channel, threadTimeStamp); err != nil {
+			return fmt.Errorf("failed to link %s to slack thread: %v", issue.Key, err)
+		}
+	}
+	return nil
+}
+
+// LinkThread adds remote link to the Slack thread to the issue. Every thread is linked to the issue only once,
+// and the link global ID makes Jira update the existing link instead of adding a duplicate, should we forget about it.
+// Issues the visibility policy does not allow in the channel are not linked, as the link would tell Jira readers
+// the restricted issue is discussed there.
+func (l *Linker) LinkThread(ctx context.Context, instance *jiraclient.Instance, key, channel, threadTimeStamp string) error {
+	if _, err := strconv.ParseFloat(threadTimeStamp, 64); err != nil {
+		// links shared in the message composer don't have a message yet
+		return nil
+	}
+	linkedKey := fmt.Sprintf("%s/%s/%s/%s", instance.Name, key, channel, threadTimeStamp)
+	if ok, err := l.markLinked(linkedKey); err != nil || !ok {
+		return err
+	}
+	linked := false
+	defer func() {
+		if !linked {
+			l.forget(linkedKey)
+		}
+	}()
+
+	// only the fields the policy looks at are fetched
+	issue, _, err := instance.Client.Issue.GetWithContext(ctx, key, &jira.GetQueryOptions{Fields: "project,labels,security"})
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %v", key, err)
+	}
+	if l.policy.Evaluate(channel, issue) != policy.Allow {
+		return nil
+	}
+
+	permalink, err := l.slackClient.GetPermalinkContext(ctx, &slack.PermalinkParameters{Channel: channel, Ts: threadTimeStamp})
+	if err != nil {
+		return fmt.Errorf("failed to get permalink of %s/%s: %v", channel, threadTimeStamp, err)
+	}
+	// names of private channels (and channels we know nothing about) are not shown to Jira readers,
+	// who might not be in them
+	title := "Slack thread"
+	if info, err := l.slackClient.GetConversationInfoContext(ctx, channel, false); err == nil && !info.IsPrivate && !info.IsIM && !info.IsMpIM && len(info.Name) > 0 {
+		title = fmt.Sprintf("Slack thread in #%s", info.Name)
+	}
+
+	_, _, err = instance.Client.Issue.AddRemoteLinkWithContext(ctx, key, &jira.RemoteLink{
+		GlobalID:     fmt.Sprintf("slack-thread:%s/%s", channel, threadTimeStamp),
+		Application:  &jira.RemoteLinkApplication{Type: "com.slack", Name: "Slack"},
+		Relationship: "discussed in",
+		Object: &jira.RemoteLinkObject{
+			URL:   permalink,
+			Title: title,
+			Icon:  &jira.RemoteLinkIcon{Url16x16: "https://slack.com/favicon.ico", Title: "Slack"},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	linked = true
+	return nil
+}
+
+// markLinked records the thread as linked to the issue and returns false if it already was.
+// Records of threads linked more than linkedMemory ago are dropped once an hour, so the state does not grow forever.
+func (l *Linker) markLinked(linkedKey string) (bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.pruned) > time.Hour {
+		if err := store.DeleteOlder(l.store, linkedBucket, linkedMemory); err != nil {
+			log.Printf("failed to prune linked threads: %v", err)
+		}
+		l.pruned = now
+	}
+	var linkedAt time.Time
+	if ok, err := l.store.Get(linkedBucket, linkedKey, &linkedAt); err != nil || ok {
+		return false, err
+	}
+	return true, l.store.Put(linkedBucket, linkedKey, now)
+}
+
+// forget releases the thread not linked after all (eg. the issue is restricted), so it is checked again next time.
+func (l *Linker) forget(linkedKey string) {
+	if err := l.store.Delete(linkedBucket, linkedKey); err != nil {
+		log.Printf("failed to forget linked thread %s: %v", linkedKey, err)
+	}
+}
@@ -0,0 +1,135 @@
+package remotelink
+
+import (
+	"context"
+	"fmt"
+	"github.com/mfojtik/shodan/pkg/config"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/policy"
+	"github.com/mfojtik/shodan/pkg/store"
+	"github.com/mfojtik/shodan/pkg/unfurl"
+	"github.com/slack-go/slack"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeJira serves the issues and counts the remote links added to them, adding links fails while failing is set.
+type fakeJira struct {
+	lock    sync.Mutex
+	links   map[string]int
+	failing bool
+}
+
+func (f *fakeJira) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	path := strings.TrimPrefix(r.URL.Path, "/rest/api/2/issue/")
+	key := strings.TrimSuffix(path, "/remotelink")
+	project, _, _ := strings.Cut(key, "-")
+	if r.Method == http.MethodGet {
+		fmt.Fprintf(w, `{"key": %q, "fields": {"project": {"key": %q}}}`, key, project)
+		return
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.failing {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	f.links[key]++
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(`{"id": 10000}`))
+}
+
+func newTestLinker(t *testing.T, rules ...*config.PolicyRule) (*Linker, *fakeJira, *jiraclient.Instance) {
+	t.Helper()
+	jira := &fakeJira{links: map[string]int{}}
+	jiraServer := httptest.NewServer(jira)
+	t.Cleanup(jiraServer.Close)
+	slackServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/chat.getPermalink":
+			w.Write([]byte(`{"ok": true, "channel": "C1", "permalink": "https://example.slack.com/archives/C1/p1"}`))
+		case "/conversations.info":
+			w.Write([]byte(`{"ok": true, "channel": {"id": "C1", "name": "general"}}`))
+		default:
+			w.Write([]byte(`{"ok": false, "error": "unknown_method"}`))
+		}
+	}))
+	t.Cleanup(slackServer.Close)
+
+	instance, err := jiraclient.NewInstance("jira", "Jira", jiraServer.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	linker := New(jiraclient.Instances{instance}, slack.New("xoxb-test", slack.OptionAPIURL(slackServer.URL+"/")), policy.New(rules), store.NewMemory(),
+		&config.RemoteLinkConfig{Channels: []string{"C1"}})
+	return linker, jira, instance
+}
+
+func TestHandleSharedLinksOnce(t *testing.T) {
+	linker, jira, instance := newTestLinker(t)
+	shared := &unfurl.Shared{Instance: instance, Key: "API-1", Channel: "C1", MessageTimeStamp: "1.2", ThreadTimeStamp: "1.1"}
+
+	// the same message posted twice, concurrently and again later
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			linker.HandleShared(context.Background(), shared)
+		}()
+	}
+	wg.Wait()
+	linker.HandleShared(context.Background(), shared)
+	// other channels are not linked
+	linker.HandleShared(context.Background(), &unfurl.Shared{Instance: instance, Key: "API-2", Channel: "C2", ThreadTimeStamp: "1.1"})
+
+	if jira.links["API-1"] != 1 || len(jira.links) != 1 {
+		t.Errorf("expected single remote link of API-1, got %v", jira.links)
+	}
+}
+
+func TestLinkThread(t *testing.T) {
+	ctx := context.Background()
+	linker, jira, instance := newTestLinker(t, &config.PolicyRule{Projects: []string{"SEC"}, Action: "redact"})
+
+	// failed and restricted links are not recorded as linked
+	jira.failing = true
+	if err := linker.LinkThread(ctx, instance, "API-1", "C1", "1.1"); err == nil {
+		t.Fatal("expected failed link")
+	}
+	jira.failing = false
+	for i := 0; i < 2; i++ {
+		for _, key := range []string{"API-1", "SEC-1"} {
+			if err := linker.LinkThread(ctx, instance, key, "C1", "1.1"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if jira.links["API-1"] != 1 || jira.links["SEC-1"] != 0 {
+		t.Errorf("expected API-1 linked once after the failure and SEC-1 not linked, got %v", jira.links)
+	}
+
+	// records of old links are pruned by the hourly prune, the thread is linked again then
+	if err := linker.store.Put(linkedBucket, "jira/API-1/C1/1.1", time.Now().Add(-linkedMemory-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := linker.LinkThread(ctx, instance, "API-1", "C1", "1.1"); err != nil {
+		t.Fatal(err)
+	}
+	if jira.links["API-1"] != 1 {
+		t.Errorf("expected no prune within an hour since the last one, got %v", jira.links)
+	}
+	linker.pruned = time.Now().Add(-2 * time.Hour)
+	if err := linker.LinkThread(ctx, instance, "API-1", "C1", "1.1"); err != nil {
+		t.Fatal(err)
+	}
+	if jira.links["API-1"] != 2 {
+		t.Errorf("expected old record pruned and the thread linked again, got %v", jira.links)
+	}
+}
@@ -0,0 +1,37 @@
+package render
+
+import (
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/slack-go/slack"
+)
+
+// Action IDs of the issue card actions.
+const (
+	AssignToMeActionID = "issue_assign_me"
+	TransitionActionID = "issue_transition"
+	CommentActionID    = "issue_comment"
+)
+
+// MaxSelectOptions is the maximum number of options Slack allows in a select menu.
+const MaxSelectOptions = 100
+
+// IssueActions renders the card action buttons. The block ID identifies the issue for the action handler.
+// The transition select is left out when there are no transitions available.
+func IssueActions(blockID string, transitions []jira.Transition) slack.Block {
+	elements := []slack.BlockElement{
+		slack.NewButtonBlockElement(AssignToMeActionID, "", slack.NewTextBlockObject(slack.PlainTextType, "Assign to me", false, false)),
+	}
+	if len(transitions) > MaxSelectOptions {
+		transitions = transitions[:MaxSelectOptions]
+	}
+	if len(transitions) > 0 {
+		var options []*slack.OptionBlockObject
+		for _, t := range transitions {
+			options = append(options, slack.NewOptionBlockObject(t.ID, slack.NewTextBlockObject(slack.PlainTextType, t.Name, false, false), nil))
+		}
+		placeholder := slack.NewTextBlockObject(slack.PlainTextType, "Transition", false, false)
+		elements = append(elements, slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, placeholder, TransitionActionID, options...))
+	}
+	elements = append(elements, slack.NewButtonBlockElement(CommentActionID, "", slack.NewTextBlockObject(slack.PlainTextType, "Add comment", false, false)))
+	return slack.NewActionBlock(blockID, elements...)
+}
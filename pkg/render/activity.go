@@ -0,0 +1,35 @@
+package render
+
+import (
+	"fmt"
+	"github.com/slack-go/slack"
+	"strings"
+)
+
+// ActivitySection is a list of issues in the activity digest, eg. issues resolved in the period.
+type ActivitySection struct {
+	Title string
+	// Lines are the listed issues (see IssueLine), Total is the number of all issues in the section
+	Lines []string
+	Total int
+	URL   string
+}
+
+// ActivityDigest renders the summary of Jira activity in the period, one section per issue list.
+func ActivityDigest(title, period string, sections []ActivitySection) []slack.Block {
+	header := fmt.Sprintf(":newspaper: *%s* – %s", Escape(title), Escape(period))
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, header, false, false), nil, nil),
+	}
+	for _, section := range sections {
+		text := fmt.Sprintf("*%s* – <%s|%s>", Escape(section.Title), section.URL, pluralize(section.Total, "issue", "issues"))
+		if len(section.Lines) > 0 {
+			text += "\n" + strings.Join(section.Lines, "\n")
+		}
+		if section.Total > len(section.Lines) && len(section.Lines) > 0 {
+			text += fmt.Sprintf("\n<%s|and %d more>", section.URL, section.Total-len(section.Lines))
+		}
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil))
+	}
+	return blocks
+}
@@ -0,0 +1,33 @@
+package render
+
+import (
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/slack-go/slack"
+	"strings"
+	"time"
+)
+
+// CommentLimit is the maximum number of characters of the comment body shown in the unfurl.
+const CommentLimit = 1500
+
+// Comment renders the unfurl card for a comment permalink, with the parent issue header on top.
+func Comment(issue *jira.Issue, comment *jira.Comment, browseURL, commentURL string, opts Options) []slack.Block {
+	author := "Anonymous"
+	if len(userName(&comment.Author)) > 0 {
+		author = opts.user(&comment.Author)
+	}
+	byline := fmt.Sprintf(":speech_balloon: <%s|Comment> by *%s*", commentURL, author)
+	if created, err := time.Parse("2006-01-02T15:04:05.999-0700", comment.Created); err == nil {
+		byline += " · " + Date(created)
+	}
+
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, IssueHeader(issue, browseURL, opts), false, false), nil, nil),
+		slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, byline, false, false)),
+	}
+	if body := Truncate(opts.toSlack(strings.TrimSpace(comment.Body)), CommentLimit); len(body) > 0 {
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, body, false, false), nil, nil))
+	}
+	return blocks
+}
@@ -0,0 +1,25 @@
+package render
+
+import (
+	"fmt"
+	"github.com/slack-go/slack"
+	"strings"
+)
+
+// IssueGroup is a titled list of issue lines (see IssueLine).
+type IssueGroup struct {
+	Title string
+	Lines []string
+}
+
+// IssueGroups renders the header followed by one section per group.
+func IssueGroups(header string, groups []IssueGroup) []slack.Block {
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, header, false, false), nil, nil),
+	}
+	for _, g := range groups {
+		text := fmt.Sprintf("*%s* (%d)\n%s", Escape(g.Title), len(g.Lines), strings.Join(g.Lines, "\n"))
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil))
+	}
+	return blocks
+}
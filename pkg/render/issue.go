@@ -0,0 +1,135 @@
+package render
+
+import (
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/slack-go/slack"
+	"strings"
+	"time"
+)
+
+// DescriptionLimit is the maximum number of characters of the issue description shown in the unfurl.
+const DescriptionLimit = 300
+
+// IssueEmoji returns the Slack emoji used for the given issue type.
+func IssueEmoji(issueType string) string {
+	switch issueType {
+	case "Bug":
+		return ":bugzilla:"
+	case "Epic":
+		return ":epic-win:"
+	default:
+		return ":jira-dumpster-fire:"
+	}
+}
+
+// IssueHeader renders the "emoji #KEY summary – by reporter" line.
+func IssueHeader(issue *jira.Issue, browseURL string, opts Options) string {
+	text := fmt.Sprintf("%s <%s|#%s> %s", IssueEmoji(issue.Fields.Type.Name), browseURL, issue.Key, Escape(issue.Fields.Summary))
+	if issue.Fields.Reporter != nil {
+		text += " – by " + opts.user(issue.Fields.Reporter)
+	}
+	if len(opts.Source) > 0 {
+		text += fmt.Sprintf(" (%s)", Escape(opts.Source))
+	}
+	return text
+}
+
+// Issue renders the unfurl card for a single Jira issue.
+func Issue(issue *jira.Issue, browseURL string, opts Options) []slack.Block {
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, IssueHeader(issue, browseURL, opts), false, false), nil, nil),
+	}
+	if details := IssueDetails(issue, opts); len(details) > 0 {
+		blocks = append(blocks, slack.NewContextBlock("", details...))
+	}
+	if description := Truncate(opts.toSlack(issue.Fields.Description), DescriptionLimit); len(description) > 0 {
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, description, false, false), nil, nil))
+	}
+	return blocks
+}
+
+// Restricted renders the card for issue that can't be shown in the channel, without any of its details.
+func Restricted(key, browseURL string) []slack.Block {
+	return []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, RestrictedIssueLine(key, browseURL), false, false), nil, nil),
+	}
+}
+
+// IssueDetails returns context elements describing the issue state.
+// Fields that are not set on the issue are omitted.
+func IssueDetails(issue *jira.Issue, opts Options) []slack.MixedElement {
+	var elements []slack.MixedElement
+	add := func(name, value string) {
+		if len(value) == 0 {
+			return
+		}
+		elements = append(elements, slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*%s:* %s", name, value), false, false))
+	}
+
+	f := issue.Fields
+	if f.Status != nil {
+		add("Status", Escape(f.Status.Name))
+	}
+	if f.Assignee != nil {
+		add("Assignee", opts.user(f.Assignee))
+	} else {
+		add("Assignee", "_unassigned_")
+	}
+	if f.Priority != nil {
+		add("Priority", Escape(f.Priority.Name))
+	}
+
+	var components []string
+	for _, c := range f.Components {
+		components = append(components, c.Name)
+	}
+	add("Component", Escape(strings.Join(components, ", ")))
+
+	var versions []string
+	for _, v := range f.FixVersions {
+		versions = append(versions, v.Name)
+	}
+	add("Fix Version", Escape(strings.Join(versions, ", ")))
+	add("Labels", Escape(strings.Join(f.Labels, ", ")))
+
+	if updated := time.Time(f.Updated); !updated.IsZero() {
+		add("Updated", Date(updated))
+	}
+	return elements
+}
+
+// Date renders the time using Slack date formatting, so every reader sees it in their own time zone.
+func Date(t time.Time) string {
+	return fmt.Sprintf("<!date^%d^{date_short_pretty} {time}|%s>", t.Unix(), t.UTC().Format("2006-01-02 15:04 UTC"))
+}
+
+// Truncate shortens the text to at most limit characters, appending an ellipsis when it was shortened.
+// Links, mentions and dates ("<...>") and escaped characters ("&amp;") cut by the limit are dropped whole,
+// as Slack would render their broken remains as garbage.
+func Truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	cut := string(runes[:limit-1])
+	if i := strings.LastIndex(cut, "<"); i > strings.LastIndex(cut, ">") {
+		cut = cut[:i]
+	}
+	if i := strings.LastIndex(cut, "&"); i >= 0 && len(cut)-i < len("&amp;") && !strings.Contains(cut[i:], ";") {
+		cut = cut[:i]
+	}
+	return strings.TrimSpace(cut) + "…"
+}
+
+// Escape escapes the control characters Slack mrkdwn reserves.
+func Escape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+func userName(u *jira.User) string {
+	if len(u.DisplayName) > 0 {
+		return u.DisplayName
+	}
+	return u.Name
+}
@@ -0,0 +1,123 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/slack-go/slack"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+const browseURL = "https://jira.example.com/browse/API-1"
+
+func testIssue(fields *jira.IssueFields) *jira.Issue {
+	return &jira.Issue{Key: "API-1", Fields: fields}
+}
+
+func TestIssueGolden(t *testing.T) {
+	updated := time.Date(2022, 10, 5, 20, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		blocks []slack.Block
+	}{
+		{
+			name: "minimal",
+			blocks: Issue(testIssue(&jira.IssueFields{
+				Type:    jira.IssueType{Name: "Task"},
+				Summary: "Do the thing",
+			}), browseURL, Options{}),
+		},
+		{
+			name: "full",
+			blocks: Issue(testIssue(&jira.IssueFields{
+				Type:        jira.IssueType{Name: "Bug"},
+				Summary:     "Login fails for <script> & friends",
+				Reporter:    &jira.User{Name: "alice", DisplayName: "Alice"},
+				Assignee:    &jira.User{Name: "bob", DisplayName: "Bob"},
+				Status:      &jira.Status{Name: "In Progress"},
+				Priority:    &jira.Priority{Name: "Major"},
+				Components:  []*jira.Component{{Name: "auth"}, {Name: "ui"}},
+				FixVersions: []*jira.FixVersion{{Name: "4.12"}},
+				Labels:      []string{"regression", "customer"},
+				Updated:     jira.Time(updated),
+				Description: "h3. Steps\n# open [login|https://example.com/login]\n# type {{O'Brien}}",
+			}), browseURL, Options{
+				Source: "Red Hat Jira",
+				User: func(user *jira.User) string {
+					if user.Name == "bob" {
+						return "<@U2>"
+					}
+					return ""
+				},
+			}),
+		},
+		{
+			name:   "redacted",
+			blocks: Restricted("API-1", browseURL),
+		},
+		{
+			name: "long-description",
+			blocks: Issue(testIssue(&jira.IssueFields{
+				Type:        jira.IssueType{Name: "Epic"},
+				Summary:     "Rewrite everything",
+				Description: strings.Repeat("Lorem ipsum dolor sit amet. ", 10) + "See [the design document|https://example.com/design] for details. " + strings.Repeat("More. ", 20),
+			}), browseURL, Options{}),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := json.MarshalIndent(slack.Blocks{BlockSet: test.blocks}, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual = append(actual, '\n')
+			golden := filepath.Join("testdata", test.name+".golden.json")
+			if *update {
+				if err := ioutil.WriteFile(golden, actual, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(actual, expected) {
+				t.Errorf("blocks differ from %s (run with -update to refresh):\n%s", golden, actual)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		limit    int
+		expected string
+	}{
+		{name: "short", text: "short", limit: 10, expected: "short"},
+		{name: "exact", text: "0123456789", limit: 10, expected: "0123456789"},
+		{name: "cut", text: "0123456789 rest", limit: 10, expected: "012345678…"},
+		{name: "runes", text: "ěščřžýáíéů", limit: 5, expected: "ěščř…"},
+		{name: "trailing space", text: "word word word", limit: 6, expected: "word…"},
+		{name: "inside link", text: "see <https://example.com/long|the docs> now", limit: 20, expected: "see…"},
+		{name: "after link", text: "see <https://example.com|docs> and more text", limit: 35, expected: "see <https://example.com|docs> and…"},
+		{name: "inside mention", text: "ping <@U12345678>", limit: 10, expected: "ping…"},
+		{name: "inside entity", text: "a &amp; b", limit: 5, expected: "a…"},
+		{name: "after entity", text: "a &amp; b c", limit: 10, expected: "a &amp; b…"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := Truncate(test.text, test.limit); result != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package render
+
+import (
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/markup"
+)
+
+// Options customize how issue cards are rendered.
+type Options struct {
+	// Source is the display name of the Jira instance, it is omitted when empty.
+	Source string
+	// User renders Jira user, eg. as Slack mention. When not set or returns empty string, the user name is shown.
+	User func(user *jira.User) string
+	// Markup converts descriptions and comments. When not set, markup.ToSlack is used.
+	Markup *markup.Converter
+}
+
+func (o Options) user(u *jira.User) string {
+	if o.User != nil {
+		if mention := o.User(u); len(mention) > 0 {
+			return mention
+		}
+	}
+	return Escape(userName(u))
+}
+
+func (o Options) toSlack(text string) string {
+	if o.Markup != nil {
+		return o.Markup.ToSlack(text)
+	}
+	return markup.ToSlack(text)
+}
@@ -0,0 +1,101 @@
+package render
+
+import (
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/slack-go/slack"
+	"strings"
+	"time"
+)
+
+// progressBarWidth is the number of characters of the text progress bar.
+const progressBarWidth = 20
+
+// StatusCounts is the number of issues in each status category.
+type StatusCounts struct {
+	Done       int
+	InProgress int
+	ToDo       int
+}
+
+// Add counts the issue by its status category.
+func (c *StatusCounts) Add(issue *jira.Issue) {
+	category := ""
+	if issue.Fields != nil && issue.Fields.Status != nil {
+		category = issue.Fields.Status.StatusCategory.Key
+	}
+	switch category {
+	case jira.StatusCategoryComplete:
+		c.Done++
+	case jira.StatusCategoryInProgress:
+		c.InProgress++
+	default:
+		c.ToDo++
+	}
+}
+
+func (c StatusCounts) Total() int {
+	return c.Done + c.InProgress + c.ToDo
+}
+
+// String renders the counts as "3 done · 2 in progress · 5 to do".
+func (c StatusCounts) String() string {
+	return fmt.Sprintf("%d done · %d in progress · %d to do", c.Done, c.InProgress, c.ToDo)
+}
+
+// ProgressBar renders text progress bar of done issues, eg. "▓▓▓▓▓░░░░░ 50%".
+func ProgressBar(done, total int) string {
+	filled, percent := 0, 0
+	if total > 0 {
+		filled, percent = done*progressBarWidth/total, done*100/total
+	}
+	return fmt.Sprintf("`%s%s` %d%%", strings.Repeat("▓", filled), strings.Repeat("░", progressBarWidth-filled), percent)
+}
+
+// Progress renders the progress bar and status counts as a section block.
+func Progress(counts StatusCounts) slack.Block {
+	text := ProgressBar(counts.Done, counts.Total()) + "\n" + counts.String()
+	return slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil)
+}
+
+// Sprint renders the sprint card with its dates and progress.
+func Sprint(sprint *jira.Sprint, sprintURL string, counts StatusCounts, opts Options) []slack.Block {
+	header := fmt.Sprintf(":runner: <%s|%s>", sprintURL, Escape(sprint.Name))
+	if len(sprint.State) > 0 {
+		header += " · " + Escape(strings.ToUpper(sprint.State[:1])+sprint.State[1:])
+	}
+	if len(opts.Source) > 0 {
+		header += fmt.Sprintf(" (%s)", Escape(opts.Source))
+	}
+
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, header, false, false), nil, nil),
+	}
+
+	var dates []slack.MixedElement
+	for _, d := range []struct {
+		name string
+		date *time.Time
+	}{
+		{"Start", sprint.StartDate},
+		{"End", sprint.EndDate},
+		{"Completed", sprint.CompleteDate},
+	} {
+		if d.date != nil && !d.date.IsZero() {
+			dates = append(dates, slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*%s:* %s", d.name, Date(*d.date)), false, false))
+		}
+	}
+	if len(dates) > 0 {
+		blocks = append(blocks, slack.NewContextBlock("", dates...))
+	}
+	return append(blocks, Progress(counts))
+}
+
+// Epic renders the epic issue card extended with the progress of its child issues.
+func Epic(issue *jira.Issue, browseURL string, counts StatusCounts, opts Options) []slack.Block {
+	blocks := Issue(issue, browseURL, opts)
+	if counts.Total() == 0 {
+		return append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, "_No child issues._", false, false)))
+	}
+	return append(blocks, Progress(counts))
+}
@@ -0,0 +1,96 @@
+package render
+
+import (
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/slack-go/slack"
+	"strings"
+)
+
+// summaryLimit is the maximum length of issue summary in issue lists.
+const summaryLimit = 80
+
+// SearchResults renders a compact list of issues matching a filter or JQL query, one line per issue (see IssueLine).
+// The total is the number of all matching issues, which may be more than the issues listed.
+func SearchResults(title string, lines []string, total int, viewAllURL string) []slack.Block {
+	header := fmt.Sprintf(":mag: <%s|%s> – %s", viewAllURL, Escape(title), pluralize(total, "issue", "issues"))
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, header, false, false), nil, nil),
+	}
+	if len(lines) == 0 {
+		return blocks
+	}
+
+	blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, strings.Join(lines, "\n"), false, false), nil, nil))
+	if total > len(lines) {
+		more := fmt.Sprintf("Showing %d of %d. <%s|View all in Jira>", len(lines), total, viewAllURL)
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, more, false, false)))
+	}
+	return blocks
+}
+
+// Digest renders the list of issues matching the subscription query that changed since the last digest.
+// The total is the number of all changed issues, which may be more than the issues listed.
+func Digest(title string, lines []string, total int, viewAllURL string) []slack.Block {
+	header := fmt.Sprintf(":bell: %s changed in <%s|%s>", pluralize(total, "issue", "issues"), viewAllURL, Escape(title))
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, header, false, false), nil, nil),
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, strings.Join(lines, "\n"), false, false), nil, nil),
+	}
+	if total > len(lines) {
+		more := fmt.Sprintf("Showing %d of %d. <%s|View all in Jira>", len(lines), total, viewAllURL)
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, more, false, false)))
+	}
+	return blocks
+}
+
+// SearchPage renders one page of search results starting at startAt, followed by the pager actions (when any).
+func SearchPage(title string, lines []string, startAt, total int, viewAllURL string, pager ...slack.BlockElement) []slack.Block {
+	header := fmt.Sprintf(":mag: <%s|%s> – %s", viewAllURL, Escape(title), pluralize(total, "issue", "issues"))
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, header, false, false), nil, nil),
+	}
+	if len(lines) == 0 {
+		return blocks
+	}
+
+	showing := fmt.Sprintf("Showing %d–%d of %d. <%s|View all in Jira>", startAt+1, startAt+len(lines), total, viewAllURL)
+	blocks = append(blocks,
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, strings.Join(lines, "\n"), false, false), nil, nil),
+		slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, showing, false, false)),
+	)
+	if len(pager) > 0 {
+		blocks = append(blocks, slack.NewActionBlock("", pager...))
+	}
+	return blocks
+}
+
+// IssueLine renders single issue as "KEY summary · status · assignee".
+func IssueLine(issue *jira.Issue, browseURL string) string {
+	f := issue.Fields
+	if f == nil {
+		return fmt.Sprintf("<%s|%s>", browseURL, issue.Key)
+	}
+	line := fmt.Sprintf("<%s|%s> %s", browseURL, issue.Key, Escape(Truncate(f.Summary, summaryLimit)))
+	if f.Status != nil {
+		line += " · " + Escape(f.Status.Name)
+	}
+	if f.Assignee != nil {
+		line += " · " + Escape(userName(f.Assignee))
+	} else {
+		line += " · _unassigned_"
+	}
+	return line
+}
+
+// RestrictedIssueLine renders issue that can't be shown in the channel.
+func RestrictedIssueLine(key, browseURL string) string {
+	return fmt.Sprintf(":lock: <%s|%s> _restricted issue_", browseURL, key)
+}
+
+func pluralize(count int, singular, plural string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, singular)
+	}
+	return fmt.Sprintf("%d %s", count, plural)
+}
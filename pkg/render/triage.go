@@ -0,0 +1,53 @@
+package render
+
+import (
+	"fmt"
+	"github.com/slack-go/slack"
+)
+
+// SnoozeActionID is the action ID of the triage snooze menu, the option value is the snooze duration.
+const SnoozeActionID = "triage_snooze"
+
+// snoozeOptions are the durations offered in the snooze menu.
+var snoozeOptions = []struct{ label, duration string }{
+	{"Snooze for a day", "24h"},
+	{"Snooze for a week", "168h"},
+	{"Snooze for a month", "720h"},
+}
+
+// TriageFinding is an issue found by the triage rule.
+type TriageFinding struct {
+	// BlockID identifies the issue for the snooze action handler
+	BlockID string
+	// Line is the rendered issue (see IssueLine)
+	Line string
+}
+
+// TriageFindings renders the issues found by the triage rule, each with the snooze menu.
+// The total is the number of all found issues, which may be more than the issues listed.
+func TriageFindings(rule string, findings []TriageFinding, total int, viewAllURL string) []slack.Block {
+	verb := "need"
+	if total == 1 {
+		verb = "needs"
+	}
+	header := fmt.Sprintf(":rotating_light: *%s* – <%s|%s> %s attention", Escape(rule), viewAllURL, pluralize(total, "issue", "issues"), verb)
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, header, false, false), nil, nil),
+	}
+	var options []*slack.OptionBlockObject
+	for _, o := range snoozeOptions {
+		options = append(options, slack.NewOptionBlockObject(o.duration, slack.NewTextBlockObject(slack.PlainTextType, o.label, false, false), nil))
+	}
+	for _, f := range findings {
+		blocks = append(blocks, slack.NewSectionBlock(
+			slack.NewTextBlockObject(slack.MarkdownType, f.Line, false, false), nil,
+			slack.NewAccessory(slack.NewOverflowBlockElement(SnoozeActionID, options...)),
+			slack.SectionBlockOptionBlockID(f.BlockID),
+		))
+	}
+	if total > len(findings) {
+		more := fmt.Sprintf("Showing %d of %d. <%s|View all in Jira>", len(findings), total, viewAllURL)
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, more, false, false)))
+	}
+	return blocks
+}
@@ -0,0 +1,63 @@
+package render
+
+import (
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/slack-go/slack"
+	"strings"
+)
+
+// Update is a change of the issue notified to subscribed channels.
+type Update struct {
+	// Icon is the emoji shown in front of the update, eg. ":new:"
+	Icon string
+	// Actor is the user who made the change, the update is anonymous when nil
+	Actor *jira.User
+	// Action describes the change, eg. "created the issue"
+	Action string
+	// Changes are the changed fields
+	Changes []FieldChange
+	// Comment is the added comment, if any
+	Comment *jira.Comment
+}
+
+// FieldChange is a single field changed by the update.
+type FieldChange struct {
+	Field string
+	From  string
+	To    string
+}
+
+// IssueUpdate renders the notification about the issue update, with the issue header on top.
+func IssueUpdate(issue *jira.Issue, browseURL string, update *Update, opts Options) []slack.Block {
+	actor := "Someone"
+	if update.Actor != nil && len(userName(update.Actor)) > 0 {
+		actor = opts.user(update.Actor)
+	}
+	headline := fmt.Sprintf("%s *%s* %s", update.Icon, actor, update.Action)
+
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, IssueHeader(issue, browseURL, opts), false, false), nil, nil),
+		slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, headline, false, false)),
+	}
+	var lines []string
+	for _, c := range update.Changes {
+		switch {
+		case len(c.From) == 0:
+			lines = append(lines, fmt.Sprintf("• *%s:* %s", Escape(c.Field), Truncate(Escape(c.To), DescriptionLimit)))
+		case len(c.To) == 0:
+			lines = append(lines, fmt.Sprintf("• *%s:* ~%s~", Escape(c.Field), Truncate(Escape(c.From), DescriptionLimit)))
+		default:
+			lines = append(lines, fmt.Sprintf("• *%s:* %s → %s", Escape(c.Field), Truncate(Escape(c.From), DescriptionLimit), Truncate(Escape(c.To), DescriptionLimit)))
+		}
+	}
+	if len(lines) > 0 {
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, strings.Join(lines, "\n"), false, false), nil, nil))
+	}
+	if update.Comment != nil {
+		if body := Truncate(opts.toSlack(strings.TrimSpace(update.Comment.Body)), CommentLimit); len(body) > 0 {
+			blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, body, false, false), nil, nil))
+		}
+	}
+	return blocks
+}
@@ -0,0 +1,178 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// compactSize is the journal size that triggers rewriting the snapshot, unless the snapshot itself is larger.
+const compactSize = 1 << 20
+
+// File is a store persisted in a JSON snapshot file and a journal of the changes made since the snapshot.
+// Every batch of changes appends a single line to the journal, so the cost of a write does not grow with the state.
+// When the journal grows larger than the snapshot, the snapshot is rewritten and the journal truncated.
+// The files must not be shared by multiple processes, each keeps its own copy of the state in memory.
+type File struct {
+	*Memory
+	path string
+	// journal is the open journal file, journalSize its size
+	journal     *os.File
+	journalSize int64
+	// snapshotSize is the size of the last written snapshot
+	snapshotSize int64
+}
+
+// journalEntry is a change of a single key, entries without value are deletes.
+type journalEntry struct {
+	Bucket string          `json:"b"`
+	Key    string          `json:"k"`
+	Value  json.RawMessage `json:"v,omitempty"`
+}
+
+// OpenFile loads the store from the snapshot at path and its journal, starting empty when they don't exist yet.
+// Changes in the journal are applied to the snapshot right away, so every run starts with an empty journal.
+func OpenFile(path string) (*File, error) {
+	f := &File{Memory: NewMemory(), path: path}
+	f.Memory.persist = f.append
+	content, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(content, &f.Memory.data); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		f.snapshotSize = int64(len(content))
+	}
+	if err := f.replay(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if f.journal, err = os.OpenFile(f.journalPath(), os.O_RDWR|os.O_CREATE, 0600); err != nil {
+		return nil, err
+	}
+	if err := f.compact(); err != nil {
+		f.journal.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Close closes the journal, the store can't be changed after that.
+func (f *File) Close() error {
+	return f.journal.Close()
+}
+
+func (f *File) journalPath() string {
+	return f.path + ".journal"
+}
+
+// replay applies the journal to the loaded snapshot. A line that can't be parsed is the end of the journal,
+// it is only left behind by a crash in the middle of append and the batch it was writing never completed.
+func (f *File) replay() error {
+	content, err := ioutil.ReadFile(f.journalPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	tx := &batch{data: f.Memory.data, original: map[[2]string]json.RawMessage{}}
+	for scanner.Scan() {
+		var entries []journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entries); err != nil {
+			log.Printf("ignoring incomplete end of %s: %v", f.journalPath(), err)
+			break
+		}
+		for _, e := range entries {
+			tx.set(e.Bucket, e.Key, e.Value)
+		}
+	}
+	return scanner.Err()
+}
+
+// append writes the changed keys to the journal as a single line and syncs it.
+// A failed write is truncated away, so the journal never holds a partial batch followed by complete ones.
+func (f *File) append(data map[string]map[string]json.RawMessage, changed [][2]string) error {
+	entries := make([]journalEntry, 0, len(changed))
+	for _, k := range changed {
+		entries = append(entries, journalEntry{Bucket: k[0], Key: k[1], Value: data[k[0]][k[1]]})
+	}
+	line, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if _, err := f.journal.WriteAt(line, f.journalSize); err != nil {
+		f.journal.Truncate(f.journalSize)
+		return err
+	}
+	if err := f.journal.Sync(); err != nil {
+		f.journal.Truncate(f.journalSize)
+		return err
+	}
+	f.journalSize += int64(len(line))
+
+	if f.journalSize > compactSize && f.journalSize > f.snapshotSize {
+		// the changes are safe in the journal already, a failed compaction is retried with the next change
+		if err := f.compact(); err != nil {
+			log.Printf("failed to compact %s: %v", f.path, err)
+		}
+	}
+	return nil
+}
+
+// compact writes the snapshot and truncates the journal, unless the journal is empty already.
+func (f *File) compact() error {
+	if info, err := f.journal.Stat(); err != nil || info.Size() == 0 {
+		return err
+	}
+	if err := f.save(f.Memory.data); err != nil {
+		return err
+	}
+	if err := f.journal.Truncate(0); err != nil {
+		return err
+	}
+	f.journalSize = 0
+	return f.journal.Sync()
+}
+
+// save writes the snapshot to a temporary file first and renames it, so a crash never leaves a half-written file.
+// The temporary file is synced before the rename, otherwise a power loss could leave the renamed file empty.
+func (f *File) save(data map[string]map[string]json.RawMessage) error {
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.OpenFile(f.path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return err
+	}
+	f.snapshotSize = int64(len(content))
+	return nil
+}
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Memory is a store keeping the values in memory only, everything is lost on restart.
+type Memory struct {
+	lock sync.RWMutex
+	data map[string]map[string]json.RawMessage
+
+	// persist is called with the lock held after every batch of changes with the changed bucket/key pairs,
+	// File uses it to write the changes to disk. When it fails, the changes are rolled back,
+	// so the memory never gets ahead of the disk.
+	persist func(data map[string]map[string]json.RawMessage, changed [][2]string) error
+}
+
+func NewMemory() *Memory {
+	return &Memory{data: map[string]map[string]json.RawMessage{}}
+}
+
+func (m *Memory) Get(bucket, key string, v interface{}) (bool, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	raw, ok := m.data[bucket][key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+func (m *Memory) Put(bucket, key string, v interface{}) error {
+	return m.Batch(func(tx Store) error {
+		return tx.Put(bucket, key, v)
+	})
+}
+
+func (m *Memory) Delete(bucket, key string) error {
+	return m.Batch(func(tx Store) error {
+		return tx.Delete(bucket, key)
+	})
+}
+
+func (m *Memory) ForEach(bucket string, fn func(key string, value json.RawMessage) error) error {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	for k, v := range m.data[bucket] {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Batch(fn func(tx Store) error) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	tx := &batch{data: m.data, original: map[[2]string]json.RawMessage{}}
+	if err := fn(tx); err != nil {
+		tx.rollback()
+		return err
+	}
+	if len(tx.original) == 0 || m.persist == nil {
+		return nil
+	}
+	changed := make([][2]string, 0, len(tx.original))
+	for k := range tx.original {
+		changed = append(changed, k)
+	}
+	if err := m.persist(m.data, changed); err != nil {
+		tx.rollback()
+		return err
+	}
+	return nil
+}
+
+// batch changes the Memory data while Batch holds its lock, remembering the original values for rollback.
+type batch struct {
+	data map[string]map[string]json.RawMessage
+	// original are the values of changed bucket/key pairs before the batch, nil for keys that did not exist
+	original map[[2]string]json.RawMessage
+}
+
+func (b *batch) Get(bucket, key string, v interface{}) (bool, error) {
+	raw, ok := b.data[bucket][key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+func (b *batch) Put(bucket, key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	b.remember(bucket, key)
+	b.set(bucket, key, raw)
+	return nil
+}
+
+func (b *batch) Delete(bucket, key string) error {
+	if _, ok := b.data[bucket][key]; !ok {
+		return nil
+	}
+	b.remember(bucket, key)
+	b.set(bucket, key, nil)
+	return nil
+}
+
+func (b *batch) ForEach(bucket string, fn func(key string, value json.RawMessage) error) error {
+	for k, v := range b.data[bucket] {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Batch of a batch just joins it, the changes are applied (or rolled back) with the outer batch.
+func (b *batch) Batch(fn func(tx Store) error) error {
+	return fn(b)
+}
+
+func (b *batch) remember(bucket, key string) {
+	if _, ok := b.original[[2]string{bucket, key}]; ok {
+		return
+	}
+	b.original[[2]string{bucket, key}] = b.data[bucket][key]
+}
+
+// set stores the raw value, nil value deletes the key.
+func (b *batch) set(bucket, key string, raw json.RawMessage) {
+	if raw == nil {
+		delete(b.data[bucket], key)
+		if len(b.data[bucket]) == 0 {
+			delete(b.data, bucket)
+		}
+		return
+	}
+	if _, ok := b.data[bucket]; !ok {
+		b.data[bucket] = map[string]json.RawMessage{}
+	}
+	b.data[bucket][key] = raw
+}
+
+func (b *batch) rollback() {
+	for k, raw := range b.original {
+		b.set(k[0], k[1], raw)
+	}
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"fmt"
+	"log"
+)
+
+const (
+	// metaBucket holds data about the store itself.
+	metaBucket = "meta"
+	// versionKey is the schema version of the stored data.
+	versionKey = "schemaVersion"
+)
+
+// Migration changes the stored data from the previous schema version to Version.
+type Migration struct {
+	Version     int
+	Description string
+	Migrate     func(s Store) error
+}
+
+// Version returns the schema version of the stored data, zero for stores that were never migrated.
+func Version(s Store) (int, error) {
+	version := 0
+	_, err := s.Get(metaBucket, versionKey, &version)
+	return version, err
+}
+
+// Migrate runs the migrations newer than the stored schema version, in order of their versions.
+// Every migration is applied in a single batch together with its version, so a failed migration leaves no partial
+// changes behind and is retried on the next start.
+// Data written by a newer Shodan (eg. after rollback) is used as is, migrations only add to the schema.
+func Migrate(s Store, migrations []Migration) error {
+	version, err := Version(s)
+	if err != nil {
+		return fmt.Errorf("failed to read state schema version: %v", err)
+	}
+	latest := 0
+	for _, m := range migrations {
+		if m.Version <= latest {
+			return fmt.Errorf("migration %d (%s) is out of order", m.Version, m.Description)
+		}
+		latest = m.Version
+		if m.Version <= version {
+			continue
+		}
+		log.Printf("migrating state to schema version %d: %s", m.Version, m.Description)
+		err := s.Batch(func(tx Store) error {
+			if m.Migrate != nil {
+				if err := m.Migrate(tx); err != nil {
+					return err
+				}
+			}
+			return tx.Put(metaBucket, versionKey, m.Version)
+		})
+		if err != nil {
+			return fmt.Errorf("state migration %d (%s) failed: %v", m.Version, m.Description, err)
+		}
+		version = m.Version
+	}
+	if version > latest {
+		log.Printf("WARNING: state schema version %d is newer than the latest known version %d", version, latest)
+	}
+	return nil
+}
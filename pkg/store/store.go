@@ -0,0 +1,55 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Store is a key-value store for the Shodan state. Values are encoded as JSON and grouped into buckets.
+type Store interface {
+	// Get decodes the value stored under the key into v. It returns false when the key does not exist.
+	Get(bucket, key string, v interface{}) (bool, error)
+	// Put stores the value under the key.
+	Put(bucket, key string, v interface{}) error
+	// Delete removes the key, removing missing key is not an error.
+	Delete(bucket, key string) error
+	// ForEach calls fn for every key and its raw JSON value in the bucket, in no particular order.
+	// The store must not be modified from fn.
+	ForEach(bucket string, fn func(key string, value json.RawMessage) error) error
+	// Batch runs fn with exclusive access to the store and applies all its changes at once.
+	// When fn returns error or the changes can't be persisted, none of them are applied.
+	// Batches are also used to check and change a value atomically.
+	Batch(fn func(tx Store) error) error
+}
+
+// Open opens the store persisted in the file at path, or in-memory store when the path is ":memory:".
+func Open(path string) (Store, error) {
+	if path == ":memory:" {
+		return NewMemory(), nil
+	}
+	return OpenFile(path)
+}
+
+// DeleteOlder removes keys of the bucket whose values are timestamps older than age.
+// It is used to forget old deduplication records, values that are not timestamps are removed too.
+func DeleteOlder(s Store, bucket string, age time.Duration) error {
+	var keys []string
+	err := s.ForEach(bucket, func(key string, value json.RawMessage) error {
+		var at time.Time
+		if err := json.Unmarshal(value, &at); err != nil || time.Since(at) > age {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+	return s.Batch(func(tx Store) error {
+		for _, key := range keys {
+			if err := tx.Delete(bucket, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
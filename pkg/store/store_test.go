@@ -0,0 +1,346 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// backends returns a fresh store of every kind.
+func backends(t *testing.T) map[string]Store {
+	file, err := Open(filepath.Join(t.TempDir(), "state", "shodan-state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Store{"memory": memory, "file": file}
+}
+
+func keys(t *testing.T, s Store, bucket string) []string {
+	t.Helper()
+	var result []string
+	if err := s.ForEach(bucket, func(key string, _ json.RawMessage) error {
+		result = append(result, key)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestPutGetDelete(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			type value struct{ Name string }
+			if err := s.Put("b", "k1", &value{Name: "one"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Put("b", "k2", &value{Name: "two"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Put("b", "k1", &value{Name: "uno"}); err != nil {
+				t.Fatal(err)
+			}
+
+			v := &value{}
+			if ok, err := s.Get("b", "k1", v); err != nil || !ok || v.Name != "uno" {
+				t.Errorf("expected uno, got %v %v %+v", ok, err, v)
+			}
+			if ok, err := s.Get("b", "missing", v); err != nil || ok {
+				t.Errorf("expected missing key, got %v %v", ok, err)
+			}
+			if ok, err := s.Get("missing", "k1", v); err != nil || ok {
+				t.Errorf("expected missing bucket, got %v %v", ok, err)
+			}
+			if k := keys(t, s, "b"); !reflect.DeepEqual(k, []string{"k1", "k2"}) {
+				t.Errorf("unexpected keys %v", k)
+			}
+
+			if err := s.Delete("b", "k1"); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Delete("b", "k1"); err != nil {
+				t.Errorf("deleting missing key failed: %v", err)
+			}
+			if k := keys(t, s, "b"); !reflect.DeepEqual(k, []string{"k2"}) {
+				t.Errorf("unexpected keys %v", k)
+			}
+		})
+	}
+}
+
+func TestDeleteOlder(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			for key, value := range map[string]interface{}{
+				"fresh":   now.Add(-time.Minute),
+				"old":     now.Add(-2 * time.Hour),
+				"older":   now.Add(-48 * time.Hour),
+				"invalid": "not a timestamp",
+			} {
+				if err := s.Put("b", key, value); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.Put("other", "old", now.Add(-2*time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := DeleteOlder(s, "b", time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			if k := keys(t, s, "b"); !reflect.DeepEqual(k, []string{"fresh"}) {
+				t.Errorf("expected only fresh key left, got %v", k)
+			}
+			if k := keys(t, s, "other"); !reflect.DeepEqual(k, []string{"old"}) {
+				t.Errorf("expected other bucket untouched, got %v", k)
+			}
+		})
+	}
+}
+
+func TestBatch(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := s.Put("b", "keep", 1); err != nil {
+				t.Fatal(err)
+			}
+			failed := errors.New("failed")
+			err := s.Batch(func(tx Store) error {
+				if err := tx.Put("b", "keep", 2); err != nil {
+					return err
+				}
+				if err := tx.Put("new", "k", 3); err != nil {
+					return err
+				}
+				if err := tx.Delete("b", "keep"); err != nil {
+					return err
+				}
+				return failed
+			})
+			if err != failed {
+				t.Fatalf("expected batch error, got %v", err)
+			}
+			value := 0
+			if ok, err := s.Get("b", "keep", &value); err != nil || !ok || value != 1 {
+				t.Errorf("expected the original value restored, got %v %v %d", ok, err, value)
+			}
+			if k := keys(t, s, "new"); len(k) != 0 {
+				t.Errorf("expected no keys added by failed batch, got %v", k)
+			}
+
+			if err := s.Batch(func(tx Store) error {
+				if err := tx.Put("b", "keep", 2); err != nil {
+					return err
+				}
+				// nested batch joins the outer one
+				return tx.Batch(func(tx Store) error {
+					return tx.Put("new", "k", 3)
+				})
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := s.Get("b", "keep", &value); err != nil || !ok || value != 2 {
+				t.Errorf("expected the batch applied, got %v %v %d", ok, err, value)
+			}
+			if k := keys(t, s, "new"); !reflect.DeepEqual(k, []string{"k"}) {
+				t.Errorf("expected key added by nested batch, got %v", k)
+			}
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			var ran []int
+			migrations := []Migration{
+				{Version: 1, Description: "first"},
+				{Version: 2, Description: "add bucket", Migrate: func(s Store) error {
+					ran = append(ran, 2)
+					return s.Put("new", "k", "v")
+				}},
+			}
+			if err := Migrate(s, migrations); err != nil {
+				t.Fatal(err)
+			}
+			if version, err := Version(s); err != nil || version != 2 {
+				t.Errorf("expected version 2, got %d %v", version, err)
+			}
+
+			// migrations already applied are not run again, failed migration leaves nothing behind
+			migrations = append(migrations, Migration{Version: 3, Description: "broken", Migrate: func(s Store) error {
+				ran = append(ran, 3)
+				if err := s.Put("broken", "k", "v"); err != nil {
+					return err
+				}
+				return errors.New("failed")
+			}})
+			if err := Migrate(s, migrations); err == nil {
+				t.Fatal("expected failed migration")
+			}
+			if version, err := Version(s); err != nil || version != 2 {
+				t.Errorf("expected version 2 after failed migration, got %d %v", version, err)
+			}
+			if k := keys(t, s, "broken"); len(k) != 0 {
+				t.Errorf("expected failed migration rolled back, got %v", k)
+			}
+			if !reflect.DeepEqual(ran, []int{2, 3}) {
+				t.Errorf("unexpected migrations run %v", ran)
+			}
+
+			if err := Migrate(s, []Migration{{Version: 2}, {Version: 1}}); err == nil {
+				t.Error("expected error for migrations out of order")
+			}
+		})
+	}
+}
+
+func TestFileReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shodan-state.json")
+	s, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("b", "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("expected temporary file renamed, got %v", err)
+	}
+
+	reopened, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := ""
+	if ok, err := reopened.Get("b", "k", &value); err != nil || !ok || value != "v" {
+		t.Errorf("expected persisted value, got %v %v %q", ok, err, value)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFile(path); err == nil {
+		t.Error("expected error for corrupted file")
+	}
+}
+
+func TestFilePersistFailure(t *testing.T) {
+	s, err := OpenFile(filepath.Join(t.TempDir(), "shodan-state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("b", "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+
+	// writes to closed journal fail
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("b", "k", "changed"); err == nil {
+		t.Fatal("expected persist error")
+	}
+	if err := s.Delete("b", "k"); err == nil {
+		t.Fatal("expected persist error")
+	}
+	value := ""
+	if ok, err := s.Get("b", "k", &value); err != nil || !ok || value != "v" {
+		t.Errorf("expected value unchanged after failed writes, got %v %v %q", ok, err, value)
+	}
+}
+
+func TestFileJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shodan-state.json")
+	s, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("b", "k1", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Batch(func(tx Store) error {
+		if err := tx.Put("b", "k2", "v2"); err != nil {
+			return err
+		}
+		return tx.Delete("b", "k1")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("b", "null", nil); err != nil {
+		t.Fatal(err)
+	}
+	// the changes are appended to the journal, the snapshot is written on open and compaction only
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected no snapshot yet, got %v", err)
+	}
+	journal, err := ioutil.ReadFile(path + ".journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(journal), "\n"); lines != 3 {
+		t.Errorf("expected line per batch, got %q", journal)
+	}
+	s.Close()
+
+	// a crash in the middle of append leaves incomplete line at the end
+	if err := ioutil.WriteFile(path+".journal", append(journal, `[{"b":"b","k":"k3","v":`...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if k := keys(t, reopened, "b"); !reflect.DeepEqual(k, []string{"k2", "null"}) {
+		t.Errorf("expected the journal replayed, got %v", k)
+	}
+	if info, err := os.Stat(path + ".journal"); err != nil || info.Size() != 0 {
+		t.Errorf("expected the journal compacted on open, got %v %v", info, err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected snapshot written on open: %v", err)
+	}
+}
+
+func TestFileCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shodan-state.json")
+	s, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	// every value replaces the previous one, so the journal grows past the snapshot holding the single key
+	value := strings.Repeat("x", 1024)
+	for i := 0; i < compactSize/1024; i++ {
+		if err := s.Put("b", "k", value+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.journalSize > compactSize {
+		t.Errorf("expected the journal compacted, got %d bytes", s.journalSize)
+	}
+	reopened, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	stored := ""
+	if ok, err := reopened.Get("b", "k", &stored); err != nil || !ok || stored != value+strconv.Itoa(compactSize/1024-1) {
+		t.Errorf("expected the last value persisted, got %v %v", ok, err)
+	}
+}
@@ -0,0 +1,203 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/render"
+	"github.com/mfojtik/shodan/pkg/unfurl"
+	"github.com/slack-go/slack"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// pollMaxResults is the number of changed issues fetched per subscription and poll, the rest comes in the next poll.
+	pollMaxResults = 50
+	// pollSpacing spaces the searches of a single poll, so Jira does not get all of them at once.
+	pollSpacing = time.Second
+	// pollOverlap extends the searched period, covering clock differences between Shodan and Jira.
+	pollOverlap = 2 * time.Minute
+	// maxBackoff is the longest pause after Jira rate limited the poller.
+	maxBackoff = time.Hour
+	// requestTimeout bounds a single search.
+	requestTimeout = 30 * time.Second
+)
+
+// rateLimitedError is returned when Jira rejects the search with "429 Too Many Requests".
+type rateLimitedError struct {
+	// retryAfter is how long Jira asked to wait, zero when it did not say
+	retryAfter time.Duration
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("rate limited by jira (retry after %s)", e.retryAfter)
+}
+
+// Poller periodically searches Jira for issues changed since the last poll and posts them to the subscribed channels.
+// It is used instead of webhooks, when they are not installed in Jira.
+type Poller struct {
+	instances     jiraclient.Instances
+	slackClient   *slack.Client
+	unfurler      *unfurl.Unfurler
+	subscriptions *Store
+	interval      time.Duration
+
+	// backoff is the current pause after being rate limited
+	backoff time.Duration
+	// onChanged are called for every changed issue
+	onChanged []func(ctx context.Context, instance *jiraclient.Instance, key string)
+}
+
+func NewPoller(instances jiraclient.Instances, slackClient *slack.Client, unfurler *unfurl.Unfurler, subscriptions *Store, interval time.Duration) *Poller {
+	return &Poller{
+		instances:     instances,
+		slackClient:   slackClient,
+		unfurler:      unfurler,
+		subscriptions: subscriptions,
+		interval:      interval,
+	}
+}
+
+// OnChanged registers function called whenever the poller finds a changed issue, eg. to refresh its cards posted earlier.
+func (p *Poller) OnChanged(fn func(ctx context.Context, instance *jiraclient.Instance, key string)) {
+	p.onChanged = append(p.onChanged, fn)
+}
+
+// Run polls all subscriptions every interval until the context is done.
+// When Jira rate limits the poller, the poll is aborted and the next one is postponed with exponential backoff.
+func (p *Poller) Run(ctx context.Context) {
+	for {
+		wait := p.interval
+		var limited *rateLimitedError
+		switch err := p.pollAll(ctx); {
+		case errors.As(err, &limited):
+			p.backoff *= 2
+			if p.backoff < p.interval {
+				p.backoff = p.interval
+			}
+			if p.backoff > maxBackoff {
+				p.backoff = maxBackoff
+			}
+			wait = p.backoff
+			if limited.retryAfter > wait {
+				wait = limited.retryAfter
+			}
+			log.Printf("subscription poll %v, next poll in %s", err, wait)
+		case err != nil:
+			log.Printf("subscription poll failed: %v", err)
+		default:
+			p.backoff = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (p *Poller) pollAll(ctx context.Context) error {
+	subs, err := p.subscriptions.List("")
+	if err != nil {
+		return err
+	}
+	// issues matched by multiple subscriptions are reported as changed once
+	changed := map[string]bool{}
+	for i, sub := range subs {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(pollSpacing):
+			}
+		}
+		var limited *rateLimitedError
+		if err := p.poll(ctx, sub, changed); errors.As(err, &limited) {
+			return err
+		} else if err != nil {
+			log.Printf("failed to poll subscription %s (%s): %v", sub.ID, sub.Describe(), err)
+		}
+	}
+	return nil
+}
+
+// poll posts the digest of issues changed since the subscription cursor and moves the cursor to the last change.
+// Issues not in the reported map yet are reported to OnChanged functions and added to it.
+func (p *Poller) poll(ctx context.Context, sub *Subscription, reported map[string]bool) error {
+	instance := p.instances.ByName(sub.Instance)
+	if instance == nil {
+		return fmt.Errorf("unknown jira instance %q", sub.Instance)
+	}
+	cursor := sub.Cursor
+	if cursor.IsZero() {
+		cursor = sub.CreatedAt
+	}
+
+	// relative dates avoid guessing the time zone Jira interprets absolute dates in, the overlap is filtered below
+	minutes := int((time.Since(cursor)+pollOverlap)/time.Minute) + 1
+	jql := fmt.Sprintf("(%s) AND updated >= -%dm ORDER BY updated ASC", sub.Query(), minutes)
+	searchCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	issues, resp, err := instance.Client.Issue.SearchWithContext(searchCtx, jql, &jira.SearchOptions{
+		MaxResults: pollMaxResults,
+		Fields:     []string{"summary", "status", "assignee", "project", "labels", "security", "created", "updated"},
+	})
+	if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return &rateLimitedError{retryAfter: time.Duration(seconds) * time.Second}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to search %q: %v", jql, err)
+	}
+
+	var lines []string
+	changed, newCursor := 0, cursor
+	for i := range issues {
+		issue := &issues[i]
+		updated := time.Time(issue.Fields.Updated)
+		if !updated.After(cursor) {
+			continue
+		}
+		if updated.After(newCursor) {
+			newCursor = updated
+		}
+		p.unfurler.Invalidate(instance, issue.Key)
+		if id := instance.Name + "/" + issue.Key; !reported[id] {
+			reported[id] = true
+			for _, fn := range p.onChanged {
+				fn(ctx, instance, issue.Key)
+			}
+		}
+		line, ok := p.unfurler.IssueLine(sub.Channel, instance, issue)
+		if !ok {
+			continue
+		}
+		changed++
+		if len(lines) == unfurl.SearchResultsLimit {
+			continue
+		}
+		if time.Time(issue.Fields.Created).After(cursor) {
+			line = ":new: " + line
+		}
+		lines = append(lines, line)
+	}
+	// only the issues the cursor moves past are counted, issues that did not fit in this poll
+	// (or were filtered as not changed since the cursor) are counted by the next one
+	if changed > 0 {
+		blocks := render.Digest(sub.Describe(), lines, changed, instance.SearchURL(sub.Query()))
+		text := fmt.Sprintf("%d issue(s) changed in %s", changed, sub.Describe())
+		if _, _, err := p.slackClient.PostMessageContext(ctx, sub.Channel, slack.MsgOptionText(text, false), slack.MsgOptionBlocks(blocks...)); err != nil {
+			return fmt.Errorf("failed to post digest to %s: %v", sub.Channel, err)
+		}
+	}
+	if newCursor.Equal(sub.Cursor) {
+		return nil
+	}
+	sub.Cursor = newCursor
+	return p.subscriptions.Update(sub)
+}
@@ -0,0 +1,67 @@
+package subscription
+
+import (
+	"context"
+	"fmt"
+	"github.com/mfojtik/shodan/pkg/config"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/policy"
+	"github.com/mfojtik/shodan/pkg/store"
+	"github.com/mfojtik/shodan/pkg/unfurl"
+	"github.com/slack-go/slack"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPollCountsOnlyFetchedChanges(t *testing.T) {
+	cursor := time.Date(2022, 10, 5, 20, 0, 0, 0, time.UTC)
+	jiraTime := func(t time.Time) string { return t.Format("2006-01-02T15:04:05.000-0700") }
+
+	// Jira has 120 changed issues, but returns the first page only
+	jiraServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var issues []string
+		for i, updated := range []time.Time{cursor, cursor.Add(time.Minute), cursor.Add(2 * time.Minute)} {
+			issues = append(issues, fmt.Sprintf(`{"key": "API-%d", "fields": {"summary": "Issue %d", "created": %q, "updated": %q}}`, i+1, i+1, jiraTime(cursor.Add(-time.Hour)), jiraTime(updated)))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"startAt": 0, "maxResults": 3, "total": 120, "issues": [%s]}`, strings.Join(issues, ","))
+	}))
+	defer jiraServer.Close()
+
+	var posted []string
+	slackServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted = append(posted, r.FormValue("text"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok": true, "channel": "C1", "ts": "1.1"}`))
+	}))
+	defer slackServer.Close()
+	slackClient := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.URL+"/"))
+
+	instance, err := jiraclient.NewInstance("jira", "Jira", jiraServer.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	instances := jiraclient.Instances{instance}
+	unfurler := unfurl.New(instances, slackClient, policy.New(nil), nil, &config.UnfurlConfig{Workers: 1, Deadline: time.Second}, &config.CacheConfig{})
+	subscriptions := NewStore(store.NewMemory())
+	sub := &Subscription{Instance: "jira", Channel: "C1", Kind: Project, Value: "API"}
+	if err := subscriptions.Add(sub); err != nil {
+		t.Fatal(err)
+	}
+	sub.Cursor = cursor
+
+	poller := NewPoller(instances, slackClient, unfurler, subscriptions, time.Minute)
+	if err := poller.poll(context.Background(), sub, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	// the issue updated at the cursor was reported by the previous poll
+	if len(posted) != 1 || posted[0] != "2 issue(s) changed in project API" {
+		t.Errorf("expected two changed issues posted, got %q", posted)
+	}
+	if subs, _ := subscriptions.List("C1"); len(subs) != 1 || !subs[0].Cursor.Equal(cursor.Add(2*time.Minute)) {
+		t.Errorf("expected cursor moved to the last fetched change, got %+v", subs)
+	}
+}
@@ -0,0 +1,153 @@
+package subscription
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/store"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bucket stores subscriptions keyed by their ID.
+const bucket = "subscriptions"
+
+// Kind is what the subscription watches.
+type Kind string
+
+const (
+	// Project watches all issues in the project.
+	Project Kind = "project"
+	// Issue watches single issue.
+	Issue Kind = "issue"
+	// JQL watches issues matching the JQL query.
+	JQL Kind = "jql"
+)
+
+// Subscription delivers notifications about issue changes to a channel.
+type Subscription struct {
+	ID       string `json:"id"`
+	Instance string `json:"instance"`
+	Channel  string `json:"channel"`
+	Kind     Kind   `json:"kind"`
+	// Value is the project key, issue key or JQL query
+	Value     string    `json:"value"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Cursor is the last update of a matching issue notified by the poller
+	Cursor time.Time `json:"cursor,omitempty"`
+}
+
+// Store keeps the subscriptions in the Shodan state.
+type Store struct {
+	store store.Store
+
+	// lock makes sure updates don't bring back removed subscriptions
+	lock sync.Mutex
+}
+
+func NewStore(s store.Store) *Store {
+	return &Store{store: s}
+}
+
+// Add saves the subscription, assigning it a new ID.
+func (s *Store) Add(sub *Subscription) error {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	sub.ID = hex.EncodeToString(id)
+	sub.CreatedAt = time.Now()
+	return s.store.Put(bucket, sub.ID, sub)
+}
+
+// Update saves the changed subscription, unless it was removed meanwhile.
+func (s *Store) Update(sub *Subscription) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if ok, err := s.store.Get(bucket, sub.ID, &Subscription{}); err != nil || !ok {
+		return err
+	}
+	return s.store.Put(bucket, sub.ID, sub)
+}
+
+// Remove deletes the subscription of the channel. It returns false when the channel has no such subscription.
+func (s *Store) Remove(channel, id string) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	sub := &Subscription{}
+	if ok, err := s.store.Get(bucket, id, sub); err != nil || !ok || sub.Channel != channel {
+		return false, err
+	}
+	return true, s.store.Delete(bucket, id)
+}
+
+// List returns subscriptions of the channel (all subscriptions when the channel is empty), oldest first.
+func (s *Store) List(channel string) ([]*Subscription, error) {
+	var subs []*Subscription
+	err := s.store.ForEach(bucket, func(_ string, value json.RawMessage) error {
+		sub := &Subscription{}
+		if err := json.Unmarshal(value, sub); err != nil {
+			return err
+		}
+		if channel == "" || sub.Channel == channel {
+			subs = append(subs, sub)
+		}
+		return nil
+	})
+	sort.Slice(subs, func(i, j int) bool { return subs[i].CreatedAt.Before(subs[j].CreatedAt) })
+	return subs, err
+}
+
+// Matches returns true when the issue of the instance is watched by the subscription.
+// JQL subscriptions are checked by searching for the issue with the query in Jira.
+func (sub *Subscription) Matches(ctx context.Context, instance *jiraclient.Instance, issue *jira.Issue) (bool, error) {
+	if sub.Instance != instance.Name {
+		return false, nil
+	}
+	switch sub.Kind {
+	case Project:
+		return issue.Fields != nil && strings.EqualFold(issue.Fields.Project.Key, sub.Value), nil
+	case Issue:
+		return strings.EqualFold(issue.Key, sub.Value), nil
+	case JQL:
+		jql := fmt.Sprintf("key = %s AND (%s)", issue.Key, WithoutOrder(sub.Value))
+		issues, _, err := instance.Client.Issue.SearchWithContext(ctx, jql, &jira.SearchOptions{MaxResults: 1, Fields: []string{"key"}})
+		if err != nil {
+			return false, fmt.Errorf("failed to match %s with %q: %v", issue.Key, sub.Value, err)
+		}
+		return len(issues) > 0, nil
+	}
+	return false, nil
+}
+
+// Query returns JQL query matching the issues watched by the subscription.
+func (sub *Subscription) Query() string {
+	switch sub.Kind {
+	case Project:
+		return fmt.Sprintf("project = %q", sub.Value)
+	case Issue:
+		return "key = " + sub.Value
+	default:
+		return WithoutOrder(sub.Value)
+	}
+}
+
+// Describe renders the subscription as "project API", "issue API-1" or "jql <query>".
+func (sub *Subscription) Describe() string {
+	return fmt.Sprintf("%s %s", sub.Kind, sub.Value)
+}
+
+// WithoutOrder strips the ORDER BY clause, so the query can be combined with other conditions.
+func WithoutOrder(jql string) string {
+	if i := strings.Index(strings.ToUpper(jql), "ORDER BY"); i >= 0 {
+		return strings.TrimSpace(jql[:i])
+	}
+	return jql
+}
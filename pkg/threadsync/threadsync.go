@@ -0,0 +1,242 @@
+package threadsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/identity"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/markup"
+	"github.com/mfojtik/shodan/pkg/policy"
+	"github.com/mfojtik/shodan/pkg/store"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// syncsBucket stores the synced threads, keyed by "<channel>/<thread>".
+	syncsBucket = "thread-syncs"
+	// postedBucket records replies already posted as comments, keyed by "<channel>/<message>".
+	// Socket Mode redelivers events that were not acknowledged in time, this makes sure every reply is posted once.
+	postedBucket = "thread-sync-posted"
+	// postedMemory is how long posted replies are remembered, redeliveries come within minutes.
+	postedMemory = 7 * 24 * time.Hour
+	// requestTimeout bounds posting a single reply.
+	requestTimeout = 30 * time.Second
+)
+
+var slackMentionPattern = regexp.MustCompile(`<@([A-Z0-9]+)(?:\|[^>]*)?>`)
+
+// errRestricted is returned when the visibility policy does not allow the issue in the channel.
+var errRestricted = errors.New("the issue is restricted in this channel")
+
+// Sync is a Slack thread mirrored to a Jira issue.
+type Sync struct {
+	Instance  string    `json:"instance"`
+	Key       string    `json:"key"`
+	Channel   string    `json:"channel"`
+	Thread    string    `json:"thread"`
+	StartedBy string    `json:"startedBy"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// Syncer posts replies in synced Slack threads as comments of the Jira issue.
+type Syncer struct {
+	instances   jiraclient.Instances
+	slackClient *slack.Client
+	identities  *identity.Resolver
+	policy      *policy.Policy
+	store       store.Store
+	botUserID   string
+
+	// lock serializes the check and record of posted replies
+	lock sync.Mutex
+}
+
+func New(instances jiraclient.Instances, slackClient *slack.Client, identities *identity.Resolver, visibility *policy.Policy, s store.Store, botUserID string) *Syncer {
+	syncer := &Syncer{
+		instances:   instances,
+		slackClient: slackClient,
+		identities:  identities,
+		policy:      visibility,
+		store:       s,
+		botUserID:   botUserID,
+	}
+	if err := syncer.forgetPosted(); err != nil {
+		log.Printf("failed to prune posted thread replies: %v", err)
+	}
+	return syncer
+}
+
+// Start mirrors the thread replies posted from now on to the issue.
+// A thread can be synced to a single issue only, starting another sync replaces the previous one.
+// The visibility policy must allow the issue in the channel and the user's Jira account must be allowed to comment it,
+// as the replies are posted with Shodan account.
+func (s *Syncer) Start(ctx context.Context, instance *jiraclient.Instance, key, channel, thread, slackUserID string) error {
+	issue, _, err := instance.Client.Issue.GetWithContext(ctx, key, &jira.GetQueryOptions{Fields: "project,labels,security"})
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %v", key, err)
+	}
+	if s.policy.Evaluate(channel, issue) != policy.Allow {
+		return errRestricted
+	}
+	if _, err := s.identities.Authorize(ctx, instance, slackUserID, key, "ADD_COMMENTS"); err != nil {
+		return err
+	}
+	permalink, err := s.slackClient.GetPermalinkContext(ctx, &slack.PermalinkParameters{Channel: channel, Ts: thread})
+	if err != nil {
+		return fmt.Errorf("failed to get permalink of the thread: %v", err)
+	}
+	comment := fmt.Sprintf("%s started mirroring [Slack thread|%s] replies to this issue.", s.identities.Attribution(ctx, instance, slackUserID), permalink)
+	if _, _, err := instance.Client.Issue.AddCommentWithContext(ctx, key, &jira.Comment{Body: comment}); err != nil {
+		return fmt.Errorf("failed to comment %s: %v", key, err)
+	}
+	return s.store.Put(syncsBucket, channel+"/"+thread, &Sync{
+		Instance:  instance.Name,
+		Key:       key,
+		Channel:   channel,
+		Thread:    thread,
+		StartedBy: slackUserID,
+		StartedAt: time.Now(),
+	})
+}
+
+// Stop stops mirroring the thread. It returns the stopped sync, or nil when the thread was not synced.
+func (s *Syncer) Stop(channel, thread string) (*Sync, error) {
+	synced := &Sync{}
+	if ok, err := s.store.Get(syncsBucket, channel+"/"+thread, synced); err != nil || !ok {
+		return nil, err
+	}
+	return synced, s.store.Delete(syncsBucket, channel+"/"+thread)
+}
+
+// Syncs returns the threads synced in the channel, oldest first.
+func (s *Syncer) Syncs(channel string) ([]*Sync, error) {
+	var syncs []*Sync
+	err := s.store.ForEach(syncsBucket, func(_ string, value json.RawMessage) error {
+		synced := &Sync{}
+		if err := json.Unmarshal(value, synced); err != nil {
+			return err
+		}
+		if synced.Channel == channel {
+			syncs = append(syncs, synced)
+		}
+		return nil
+	})
+	sort.Slice(syncs, func(i, j int) bool { return syncs[i].StartedAt.Before(syncs[j].StartedAt) })
+	return syncs, err
+}
+
+// HandleMessage posts the reply in a synced thread as Jira comment attributed to the Slack author.
+// Attached files are referenced by their Slack permalinks.
+func (s *Syncer) HandleMessage(ev *slackevents.MessageEvent) error {
+	if len(ev.ThreadTimeStamp) == 0 || ev.ThreadTimeStamp == ev.TimeStamp {
+		return nil
+	}
+	// ignore edits, deletes and joins as well as bots (including our own confirmations)
+	if ev.SubType != "" && ev.SubType != "thread_broadcast" && ev.SubType != "file_share" {
+		return nil
+	}
+	if len(ev.BotID) > 0 || ev.User == s.botUserID {
+		return nil
+	}
+	// commands for Shodan (eg. "@shodan sync stop") are not part of the discussion
+	if strings.Contains(ev.Text, "<@"+s.botUserID+">") {
+		return nil
+	}
+	synced := &Sync{}
+	if ok, err := s.store.Get(syncsBucket, ev.Channel+"/"+ev.ThreadTimeStamp, synced); err != nil || !ok {
+		return err
+	}
+	instance := s.instances.ByName(synced.Instance)
+	if instance == nil {
+		return fmt.Errorf("unknown jira instance %q of %s sync", synced.Instance, synced.Key)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	postedKey := ev.Channel + "/" + ev.TimeStamp
+	var postedAt time.Time
+	if ok, err := s.store.Get(postedBucket, postedKey, &postedAt); err != nil || ok {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	text := markup.FromSlack(ev.Text, func(slackUserID string) string {
+		return s.identities.Attribution(ctx, instance, slackUserID)
+	})
+	body := fmt.Sprintf("%s wrote in Slack:\n\n%s", s.identities.Attribution(ctx, instance, ev.User), text)
+	if len(ev.Files) > 0 {
+		body += "\n\nAttachments:"
+		for _, f := range ev.Files {
+			body += fmt.Sprintf("\n* [%s|%s]", strings.NewReplacer("[", "(", "]", ")", "|", "/").Replace(f.Name), f.Permalink)
+		}
+	}
+	if _, _, err := instance.Client.Issue.AddCommentWithContext(ctx, synced.Key, &jira.Comment{Body: body}); err != nil {
+		return fmt.Errorf("failed to comment %s: %v", synced.Key, err)
+	}
+	return s.store.Put(postedBucket, postedKey, time.Now())
+}
+
+// forgetPosted drops records of replies posted more than postedMemory ago.
+func (s *Syncer) forgetPosted() error {
+	return store.DeleteOlder(s.store, postedBucket, postedMemory)
+}
+
+// HandleMention handles "@shodan sync <KEY>" and "@shodan sync stop" mentions in threads and confirms them in the thread.
+// Slash commands don't tell what thread they were sent from, so this is how the thread sync is started.
+// It returns false when the mention is not a sync command.
+func (s *Syncer) HandleMention(ev *slackevents.AppMentionEvent) (bool, error) {
+	args := strings.Fields(slackMentionPattern.ReplaceAllString(ev.Text, " "))
+	if len(args) == 0 || !strings.EqualFold(args[0], "sync") {
+		return false, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	var text string
+	switch {
+	case len(ev.ThreadTimeStamp) == 0:
+		text = "Mention me with `sync <KEY>` in a thread to mirror its replies to the Jira issue."
+	case len(args) != 2:
+		text = "Usage: `sync <KEY>` to start mirroring this thread to the Jira issue, `sync stop` to stop it."
+	case strings.EqualFold(args[1], "stop"):
+		synced, err := s.Stop(ev.Channel, ev.ThreadTimeStamp)
+		if err != nil {
+			return true, err
+		}
+		text = "This thread is not synced to any Jira issue."
+		if synced != nil {
+			text = fmt.Sprintf(":black_square_for_stop: Stopped mirroring this thread to %s.", synced.Key)
+		}
+	default:
+		key := strings.ToUpper(args[1])
+		instance := s.instances.ForKey(key)
+		switch err := s.Start(ctx, instance, key, ev.Channel, ev.ThreadTimeStamp, ev.User); {
+		case errors.Is(err, errRestricted):
+			text = fmt.Sprintf(":warning: %s can't be synced to this channel.", key)
+		case errors.Is(err, identity.ErrForbidden):
+			text = fmt.Sprintf(":warning: Your Jira account is not allowed to comment %s.", key)
+		case err != nil:
+			text = fmt.Sprintf(":warning: Failed to sync this thread to %s: %v", key, err)
+		default:
+			text = fmt.Sprintf(":link: Replies in this thread are now added as comments to <%s|%s>. Mention me with `sync stop` to stop.", instance.BrowseURL(key), key)
+		}
+	}
+
+	thread := ev.ThreadTimeStamp
+	if len(thread) == 0 {
+		thread = ev.TimeStamp
+	}
+	_, _, err := s.slackClient.PostMessageContext(ctx, ev.Channel, slack.MsgOptionTS(thread), slack.MsgOptionText(text, false))
+	return true, err
+}
@@ -0,0 +1,186 @@
+package threadsync
+
+import (
+	"encoding/json"
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/config"
+	"github.com/mfojtik/shodan/pkg/identity"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/policy"
+	"github.com/mfojtik/shodan/pkg/store"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeServices serves Slack and Jira for the syncer. Slack users U<NAME> have email <name>@example.com,
+// matching Jira user <name>, and only alice can comment the issues.
+type fakeServices struct {
+	lock     sync.Mutex
+	comments []string
+	posted   []string
+}
+
+func (f *fakeServices) serveJira(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	path := strings.TrimPrefix(r.URL.Path, "/rest/api/2/")
+	switch {
+	case path == "user/search":
+		name, _, _ := strings.Cut(r.URL.Query().Get("username"), "@")
+		fmt.Fprintf(w, `[{"name": %q, "emailAddress": "%s@example.com", "active": true}]`, name, name)
+	case path == "user/permission/search":
+		if q := r.URL.Query(); q.Get("permissions") == "ADD_COMMENTS" && q.Get("username") == "alice" {
+			w.Write([]byte(`[{"name": "alice"}]`))
+			return
+		}
+		w.Write([]byte(`[]`))
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/comment"):
+		comment := &jira.Comment{}
+		json.NewDecoder(r.Body).Decode(comment)
+		f.lock.Lock()
+		f.comments = append(f.comments, strings.TrimSuffix(strings.TrimPrefix(path, "issue/"), "/comment")+": "+comment.Body)
+		f.lock.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": "10000"}`))
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "issue/"):
+		key := strings.TrimPrefix(path, "issue/")
+		project, _, _ := strings.Cut(key, "-")
+		fmt.Fprintf(w, `{"key": %q, "fields": {"project": {"key": %q}}}`, key, project)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeServices) serveSlack(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/users.info":
+		id := r.FormValue("user")
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "user": slack.User{
+			ID:      id,
+			Profile: slack.UserProfile{Email: strings.ToLower(strings.TrimPrefix(id, "U")) + "@example.com"},
+		}})
+	case "/chat.getPermalink":
+		w.Write([]byte(`{"ok": true, "permalink": "https://example.slack.com/archives/C1/p1"}`))
+	case "/chat.postMessage":
+		f.lock.Lock()
+		f.posted = append(f.posted, r.FormValue("text"))
+		f.lock.Unlock()
+		w.Write([]byte(`{"ok": true, "channel": "C1", "ts": "9.9"}`))
+	default:
+		w.Write([]byte(`{"ok": false, "error": "unknown_method"}`))
+	}
+}
+
+func newTestSyncer(t *testing.T) (*Syncer, *fakeServices) {
+	f := &fakeServices{}
+	jiraServer := httptest.NewServer(http.HandlerFunc(f.serveJira))
+	t.Cleanup(jiraServer.Close)
+	slackServer := httptest.NewServer(http.HandlerFunc(f.serveSlack))
+	t.Cleanup(slackServer.Close)
+
+	instance, err := jiraclient.NewInstance("jira", "Jira", jiraServer.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slackClient := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.URL+"/"))
+	s := store.NewMemory()
+	visibility := policy.New([]*config.PolicyRule{{Projects: []string{"SEC"}, Action: "redact"}})
+	return New(jiraclient.Instances{instance}, slackClient, identity.NewResolver(slackClient, s), visibility, s, "USHODAN"), f
+}
+
+func TestHandleMentionSync(t *testing.T) {
+	tests := []struct {
+		name          string
+		user, key     string
+		expectPosted  string
+		expectComment string
+	}{
+		{
+			name:          "allowed",
+			user:          "UALICE",
+			key:           "api-1",
+			expectPosted:  ":link: Replies in this thread are now added as comments to",
+			expectComment: "API-1: [~alice] started mirroring [Slack thread|https://example.slack.com/archives/C1/p1] replies to this issue.",
+		},
+		{
+			name:         "user can't comment",
+			user:         "UBOB",
+			key:          "API-1",
+			expectPosted: ":warning: Your Jira account is not allowed to comment API-1.",
+		},
+		{
+			name:         "issue restricted in the channel",
+			user:         "UALICE",
+			key:          "SEC-1",
+			expectPosted: ":warning: SEC-1 can't be synced to this channel.",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			syncer, f := newTestSyncer(t)
+			handled, err := syncer.HandleMention(&slackevents.AppMentionEvent{
+				User: test.user, Channel: "C1", Text: "<@USHODAN> sync " + test.key, TimeStamp: "1.2", ThreadTimeStamp: "1.1",
+			})
+			if err != nil || !handled {
+				t.Fatalf("expected the mention handled, got %v %v", handled, err)
+			}
+			if len(f.posted) != 1 || !strings.HasPrefix(f.posted[0], test.expectPosted) {
+				t.Errorf("expected posted %q, got %q", test.expectPosted, f.posted)
+			}
+			syncs, err := syncer.Syncs("C1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(test.expectComment) == 0 {
+				if len(f.comments) > 0 || len(syncs) > 0 {
+					t.Errorf("expected no sync, got comments %q and syncs %v", f.comments, syncs)
+				}
+				return
+			}
+			if len(f.comments) != 1 || f.comments[0] != test.expectComment {
+				t.Errorf("expected comment %q, got %q", test.expectComment, f.comments)
+			}
+			if len(syncs) != 1 || syncs[0].Key != "API-1" || syncs[0].Thread != "1.1" {
+				t.Errorf("expected the thread synced to API-1, got %v", syncs)
+			}
+		})
+	}
+}
+
+func TestHandleMessage(t *testing.T) {
+	syncer, f := newTestSyncer(t)
+	if err := syncer.store.Put(syncsBucket, "C1/1.1", &Sync{Instance: "jira", Key: "API-1", Channel: "C1", Thread: "1.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reply := &slackevents.MessageEvent{
+		User: "UALICE", Channel: "C1", TimeStamp: "1.2", ThreadTimeStamp: "1.1",
+		Text: "ask <@UBOB> about {config} in <https://example.com/a|[docs]> &amp; _not_ *this*",
+	}
+	for _, ev := range []*slackevents.MessageEvent{
+		reply,
+		// redelivered by Socket Mode
+		reply,
+		{User: "UALICE", Channel: "C1", TimeStamp: "1.1", Text: "the thread itself"},
+		{User: "UALICE", Channel: "C1", TimeStamp: "2.2", ThreadTimeStamp: "2.1", Text: "not synced thread"},
+		{BotID: "B1", Channel: "C1", TimeStamp: "1.3", ThreadTimeStamp: "1.1", Text: "bot"},
+		{User: "UALICE", Channel: "C1", TimeStamp: "1.4", ThreadTimeStamp: "1.1", Text: "<@USHODAN> sync stop"},
+		{User: "UALICE", Channel: "C1", TimeStamp: "1.5", ThreadTimeStamp: "1.1", SubType: "message_changed"},
+	} {
+		if err := syncer.HandleMessage(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := `API-1: [~alice] wrote in Slack:
+
+ask [~bob] about \{config\} in [(docs)|https://example.com/a] & _not_ *this*`
+	if len(f.comments) != 1 || f.comments[0] != expected {
+		t.Errorf("expected single comment:\n%s\ngot %q", expected, f.comments)
+	}
+}
@@ -0,0 +1,177 @@
+package triage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/config"
+	"github.com/mfojtik/shodan/pkg/identity"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/render"
+	"github.com/mfojtik/shodan/pkg/store"
+	"github.com/mfojtik/shodan/pkg/unfurl"
+	"github.com/slack-go/slack"
+	"log"
+	"time"
+)
+
+const (
+	// reportedBucket records issues posted by the rules, keyed by "<rule>/<instance>/<key>".
+	reportedBucket = "triage-reported"
+	// snoozedBucket stores until when the issues are not posted, keyed by "<instance>/<key>".
+	snoozedBucket = "triage-snoozed"
+	// searchLimit is the number of issues fetched per rule evaluation.
+	searchLimit = 50
+	// findingsLimit is the number of issues posted per rule evaluation, the rest is posted in the next one.
+	findingsLimit = 10
+	// requestTimeout bounds a single search.
+	requestTimeout = 30 * time.Second
+)
+
+// Triager periodically evaluates the triage rules and posts the issues that need attention to the triage channel.
+// Issues are posted again only after the remind period, or never while they are snoozed.
+type Triager struct {
+	instances   jiraclient.Instances
+	slackClient *slack.Client
+	unfurler    *unfurl.Unfurler
+	identities  *identity.Resolver
+	store       store.Store
+	config      *config.TriageConfig
+}
+
+func New(instances jiraclient.Instances, slackClient *slack.Client, unfurler *unfurl.Unfurler, identities *identity.Resolver, s store.Store, cfg *config.TriageConfig) *Triager {
+	return &Triager{
+		instances:   instances,
+		slackClient: slackClient,
+		unfurler:    unfurler,
+		identities:  identities,
+		store:       s,
+		config:      cfg,
+	}
+}
+
+// Run evaluates the rules every interval until the context is done.
+func (t *Triager) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.config.Interval)
+	defer ticker.Stop()
+	for {
+		if err := store.DeleteOlder(t.store, reportedBucket, t.config.Remind); err != nil {
+			log.Printf("failed to prune reported triage issues: %v", err)
+		}
+		if err := store.DeleteOlder(t.store, snoozedBucket, 0); err != nil {
+			log.Printf("failed to prune snoozed triage issues: %v", err)
+		}
+		for _, rule := range t.config.Rules {
+			if err := t.evaluate(ctx, rule); err != nil {
+				log.Printf("failed to evaluate triage rule %q: %v", rule.Name, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Snooze stops posting the issue until the duration passes.
+func (t *Triager) Snooze(instance *jiraclient.Instance, key string, d time.Duration) (time.Time, error) {
+	until := time.Now().Add(d)
+	return until, t.store.Put(snoozedBucket, instance.Name+"/"+key, until)
+}
+
+func (t *Triager) evaluate(ctx context.Context, rule *config.TriageRule) error {
+	instance := t.instances.Default()
+	if len(rule.Instance) > 0 {
+		if instance = t.instances.ByName(rule.Instance); instance == nil {
+			return fmt.Errorf("unknown jira instance %q", rule.Instance)
+		}
+	}
+	channel := rule.Channel
+	if len(channel) == 0 {
+		channel = t.config.Channel
+	}
+
+	searchCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	issues, resp, err := instance.Client.Issue.SearchWithContext(searchCtx, rule.JQL, &jira.SearchOptions{
+		MaxResults: searchLimit,
+		Fields:     []string{"summary", "status", "assignee", "project", "labels", "security"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to search %q: %v", rule.JQL, jira.NewJiraError(resp, err))
+	}
+
+	var (
+		findings []render.TriageFinding
+		found    []*jira.Issue
+	)
+	// total counts the fetched issues the rule posts, snoozed, reported and skipped ones are left out
+	total := 0
+	for i := range issues {
+		issue := &issues[i]
+		if skip, err := t.skip(rule, instance, issue.Key); err != nil || skip {
+			if err != nil {
+				log.Printf("failed to check triage state of %s: %v", issue.Key, err)
+			}
+			continue
+		}
+		line, ok := t.unfurler.IssueLine(channel, instance, issue)
+		if !ok {
+			continue
+		}
+		total++
+		if len(findings) == findingsLimit {
+			continue
+		}
+		ref := &unfurl.IssueRef{Instance: instance.Name, Key: issue.Key}
+		findings = append(findings, render.TriageFinding{BlockID: ref.BlockID(), Line: line})
+		found = append(found, issue)
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+
+	blocks := render.TriageFindings(rule.Name, findings, total, instance.SearchURL(rule.JQL))
+	text := fmt.Sprintf("%s: %d issue(s) need attention", rule.Name, total)
+	if _, _, err := t.slackClient.PostMessageContext(ctx, channel, slack.MsgOptionText(text, false), slack.MsgOptionBlocks(blocks...)); err != nil {
+		return fmt.Errorf("failed to post to %s: %v", channel, err)
+	}
+	for i, issue := range found {
+		if err := t.store.Put(reportedBucket, rule.Name+"/"+instance.Name+"/"+issue.Key, time.Now()); err != nil {
+			return err
+		}
+		if rule.NotifyAssignees && issue.Fields.Assignee != nil {
+			t.notifyAssignee(ctx, rule, instance, issue, findings[i])
+		}
+	}
+	return nil
+}
+
+// skip returns true when the issue was snoozed or already posted by the rule within the remind period.
+func (t *Triager) skip(rule *config.TriageRule, instance *jiraclient.Instance, key string) (bool, error) {
+	var until time.Time
+	if ok, err := t.store.Get(snoozedBucket, instance.Name+"/"+key, &until); err != nil || (ok && time.Now().Before(until)) {
+		return true, err
+	}
+	var reportedAt time.Time
+	ok, err := t.store.Get(reportedBucket, rule.Name+"/"+instance.Name+"/"+key, &reportedAt)
+	return ok && time.Since(reportedAt) < t.config.Remind, err
+}
+
+// notifyAssignee sends the issue to its assignee as direct message, assignees without Slack account are skipped.
+func (t *Triager) notifyAssignee(ctx context.Context, rule *config.TriageRule, instance *jiraclient.Instance, issue *jira.Issue, finding render.TriageFinding) {
+	slackUserID, err := t.identities.SlackUserID(ctx, instance, issue.Fields.Assignee)
+	if err != nil {
+		if !errors.Is(err, identity.ErrNotMapped) {
+			log.Printf("failed to map %s assignee to slack: %v", issue.Key, err)
+		}
+		return
+	}
+	blocks := render.TriageFindings(rule.Name, []render.TriageFinding{finding}, 1, instance.BrowseURL(issue.Key))
+	text := fmt.Sprintf("%s: %s needs attention", rule.Name, issue.Key)
+	if _, _, err := t.slackClient.PostMessageContext(ctx, slackUserID, slack.MsgOptionText(text, false), slack.MsgOptionBlocks(blocks...)); err != nil {
+		log.Printf("failed to notify %s assignee: %v", issue.Key, err)
+	}
+}
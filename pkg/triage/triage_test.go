@@ -0,0 +1,219 @@
+package triage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mfojtik/shodan/pkg/config"
+	"github.com/mfojtik/shodan/pkg/identity"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/policy"
+	"github.com/mfojtik/shodan/pkg/store"
+	"github.com/mfojtik/shodan/pkg/unfurl"
+	"github.com/slack-go/slack"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// posted is a message posted to Slack, keys are the issues listed in it.
+type posted struct {
+	channel string
+	text    string
+	keys    []string
+}
+
+// fakeServices serves the Jira search returning the issues and the Slack endpoints the triager uses.
+// Slack users U<NAME> have email <name>@example.com, Jira users named "nobody" have no Slack account.
+type fakeServices struct {
+	lock   sync.Mutex
+	issues []string
+	// assignees are the Jira usernames assigned to the issues
+	assignees map[string]string
+	posted    []posted
+}
+
+func (f *fakeServices) serveJira(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Path != "/rest/api/2/search" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var issues []string
+	for _, key := range f.issues {
+		project, _, _ := strings.Cut(key, "-")
+		assignee := "null"
+		if name, ok := f.assignees[key]; ok {
+			assignee = fmt.Sprintf(`{"name": %q, "emailAddress": "%s@example.com"}`, name, name)
+		}
+		issues = append(issues, fmt.Sprintf(`{"key": %q, "fields": {"summary": "Issue %s", "project": {"key": %q}, "status": {"name": "New"}, "assignee": %s}}`,
+			key, key, project, assignee))
+	}
+	fmt.Fprintf(w, `{"startAt": 0, "maxResults": 50, "total": %d, "issues": [%s]}`, len(issues)+100, strings.Join(issues, ","))
+}
+
+func (f *fakeServices) serveSlack(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/users.lookupByEmail":
+		name, _, _ := strings.Cut(r.FormValue("email"), "@")
+		if name == "nobody" {
+			w.Write([]byte(`{"ok": false, "error": "users_not_found"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "user": slack.User{ID: "U" + strings.ToUpper(name)}})
+	case "/chat.postMessage":
+		var blocks []struct {
+			BlockID string `json:"block_id"`
+		}
+		json.Unmarshal([]byte(r.FormValue("blocks")), &blocks)
+		p := posted{channel: r.FormValue("channel"), text: r.FormValue("text")}
+		for _, block := range blocks {
+			var ref unfurl.IssueRef
+			if json.Unmarshal([]byte(block.BlockID), &ref) == nil {
+				p.keys = append(p.keys, ref.Key)
+			}
+		}
+		f.lock.Lock()
+		f.posted = append(f.posted, p)
+		f.lock.Unlock()
+		w.Write([]byte(`{"ok": true, "channel": "C1", "ts": "1.1"}`))
+	default:
+		w.Write([]byte(`{"ok": false, "error": "unknown_method"}`))
+	}
+}
+
+func newTestTriager(t *testing.T, f *fakeServices, remind time.Duration, rules ...*config.PolicyRule) (*Triager, *jiraclient.Instance) {
+	t.Helper()
+	jiraServer := httptest.NewServer(http.HandlerFunc(f.serveJira))
+	t.Cleanup(jiraServer.Close)
+	slackServer := httptest.NewServer(http.HandlerFunc(f.serveSlack))
+	t.Cleanup(slackServer.Close)
+
+	instance, err := jiraclient.NewInstance("jira", "Jira", jiraServer.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	instances := jiraclient.Instances{instance}
+	slackClient := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.URL+"/"))
+	identities := identity.NewResolver(slackClient, store.NewMemory())
+	unfurler := unfurl.New(instances, slackClient, policy.New(rules), identities,
+		&config.UnfurlConfig{Workers: 1, Deadline: time.Second}, &config.CacheConfig{})
+	return New(instances, slackClient, unfurler, identities, store.NewMemory(), &config.TriageConfig{Channel: "CTRIAGE", Remind: remind}), instance
+}
+
+func issueKeys(from, to int) []string {
+	var keys []string
+	for i := from; i <= to; i++ {
+		keys = append(keys, fmt.Sprintf("API-%d", i))
+	}
+	return keys
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name   string
+		issues []string
+		remind time.Duration
+		// snoozed are snoozed before the first evaluation
+		snoozed []string
+		rules   []*config.PolicyRule
+		// expected are the keys posted by the consecutive evaluations, the texts their summaries
+		expected      [][]string
+		expectedTexts []string
+	}{
+		{
+			name:          "reported issues are not repeated within the remind period",
+			issues:        []string{"API-1", "API-2"},
+			remind:        time.Hour,
+			expected:      [][]string{{"API-1", "API-2"}, nil},
+			expectedTexts: []string{"Blockers: 2 issue(s) need attention"},
+		},
+		{
+			name:          "reported issues are repeated after the remind period",
+			issues:        []string{"API-1"},
+			expected:      [][]string{{"API-1"}, {"API-1"}},
+			expectedTexts: []string{"Blockers: 1 issue(s) need attention", "Blockers: 1 issue(s) need attention"},
+		},
+		{
+			name:          "snoozed issues are not posted nor counted",
+			issues:        []string{"API-1", "API-2", "API-3"},
+			remind:        time.Hour,
+			snoozed:       []string{"API-2"},
+			expected:      [][]string{{"API-1", "API-3"}, nil},
+			expectedTexts: []string{"Blockers: 2 issue(s) need attention"},
+		},
+		{
+			name:          "issues skipped by the policy are not posted nor counted",
+			issues:        []string{"API-1", "SEC-1"},
+			remind:        time.Hour,
+			rules:         []*config.PolicyRule{{Projects: []string{"SEC"}, Action: "skip"}},
+			expected:      [][]string{{"API-1"}},
+			expectedTexts: []string{"Blockers: 1 issue(s) need attention"},
+		},
+		{
+			name:     "issues over the limit are posted by the next evaluation",
+			issues:   issueKeys(1, 12),
+			remind:   time.Hour,
+			expected: [][]string{issueKeys(1, 10), {"API-11", "API-12"}, nil},
+			expectedTexts: []string{
+				"Blockers: 12 issue(s) need attention",
+				"Blockers: 2 issue(s) need attention",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := &fakeServices{issues: test.issues}
+			triager, instance := newTestTriager(t, f, test.remind, test.rules...)
+			for _, key := range test.snoozed {
+				if _, err := triager.Snooze(instance, key, time.Hour); err != nil {
+					t.Fatal(err)
+				}
+			}
+			rule := &config.TriageRule{Name: "Blockers", JQL: "priority = Blocker"}
+			for i, expected := range test.expected {
+				f.posted = nil
+				if err := triager.evaluate(context.Background(), rule); err != nil {
+					t.Fatal(err)
+				}
+				if expected == nil {
+					if len(f.posted) != 0 {
+						t.Errorf("evaluation %d: expected nothing posted, got %+v", i, f.posted)
+					}
+					continue
+				}
+				if len(f.posted) != 1 {
+					t.Fatalf("evaluation %d: expected single message, got %+v", i, f.posted)
+				}
+				if p := f.posted[0]; p.channel != "CTRIAGE" || !reflect.DeepEqual(p.keys, expected) || p.text != test.expectedTexts[i] {
+					t.Errorf("evaluation %d: expected %q with %v in CTRIAGE, got %+v", i, test.expectedTexts[i], expected, p)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateNotifiesAssignees(t *testing.T) {
+	f := &fakeServices{
+		issues:    []string{"API-1", "API-2", "API-3"},
+		assignees: map[string]string{"API-1": "alice", "API-2": "nobody"},
+	}
+	triager, _ := newTestTriager(t, f, time.Hour)
+	rule := &config.TriageRule{Name: "Blockers", JQL: "priority = Blocker", Channel: "CRULE", NotifyAssignees: true}
+	if err := triager.evaluate(context.Background(), rule); err != nil {
+		t.Fatal(err)
+	}
+	// the unassigned issue and the assignee without Slack account get no direct message
+	expected := []posted{
+		{channel: "CRULE", text: "Blockers: 3 issue(s) need attention", keys: []string{"API-1", "API-2", "API-3"}},
+		{channel: "UALICE", text: "Blockers: API-1 needs attention", keys: []string{"API-1"}},
+	}
+	if !reflect.DeepEqual(f.posted, expected) {
+		t.Errorf("expected posted %+v, got %+v", expected, f.posted)
+	}
+}
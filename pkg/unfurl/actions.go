@@ -0,0 +1,81 @@
+package unfurl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/render"
+	"github.com/slack-go/slack"
+	"log"
+	"time"
+)
+
+const (
+	// maxBlockIDLength is the maximum length of Block Kit block ID.
+	maxBlockIDLength = 255
+	// transitionsTTL is how long the workflow transitions of an issue are cached for its cards.
+	// The actions re-check the transition when it is used, so a stale list only offers a transition that fails.
+	transitionsTTL = time.Minute
+)
+
+// IssueRef identifies the issue of a card in its actions. It is encoded in the card actions block ID.
+type IssueRef struct {
+	Instance string `json:"i"`
+	Key      string `json:"k"`
+	// URL is the unfurled link, empty when the card was posted by Shodan
+	URL string `json:"u,omitempty"`
+}
+
+// BlockID encodes the reference. Links too long for block ID are dropped, the card then can't be refreshed in place.
+func (r *IssueRef) BlockID() string {
+	encoded, _ := json.Marshal(r)
+	if len(encoded) > maxBlockIDLength {
+		encoded, _ = json.Marshal(&IssueRef{Instance: r.Instance, Key: r.Key})
+	}
+	return string(encoded)
+}
+
+// ParseIssueRef decodes the reference from the card actions block ID.
+func ParseIssueRef(blockID string) (*IssueRef, error) {
+	ref := &IssueRef{}
+	if err := json.Unmarshal([]byte(blockID), ref); err != nil || len(ref.Key) == 0 {
+		return nil, fmt.Errorf("invalid issue reference %q", blockID)
+	}
+	return ref, nil
+}
+
+// actionsBlock renders the card actions. When the workflow transitions can't be fetched, the card goes without them.
+// Transitions are cached briefly, as the same issue is often unfurled several times in a row (eg. in search results).
+func (u *Unfurler) actionsBlock(ctx context.Context, instance *jiraclient.Instance, ref *IssueRef) slack.Block {
+	transitions, err := u.transitions.Get(issueCacheKey(instance, ref.Key), func() ([]jira.Transition, error) {
+		ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+		transitions, _, err := instance.Client.Issue.GetTransitionsWithContext(ctx, ref.Key)
+		return transitions, err
+	})
+	if err != nil {
+		log.Printf("failed to get transitions of %s: %v", ref.Key, err)
+	}
+	return render.IssueActions(ref.BlockID(), transitions)
+}
+
+// Refresh unfurls the link in the message again, eg. after the issue was changed by card action.
+func (u *Unfurler) Refresh(ctx context.Context, channel, messageTimeStamp, rawURL string) error {
+	link := ParseLink(u.instances, rawURL)
+	if link == nil {
+		return fmt.Errorf("unsupported link %s", rawURL)
+	}
+	blocks, err := u.LinkBlocks(ctx, channel, link)
+	if err != nil {
+		return err
+	}
+	if len(blocks) == 0 {
+		return nil
+	}
+	_, _, _, err = u.slackClient.UnfurlMessageContext(ctx, channel, messageTimeStamp, map[string]slack.Attachment{
+		rawURL: {Blocks: slack.Blocks{BlockSet: blocks}},
+	})
+	return err
+}
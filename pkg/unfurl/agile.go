@@ -0,0 +1,86 @@
+package unfurl
+
+import (
+	"context"
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/render"
+	"github.com/slack-go/slack"
+)
+
+// progressIssuesLimit caps the number of issues counted for sprint and epic progress.
+const progressIssuesLimit = 1000
+
+// BoardBlocks renders the sprint card for the given sprint or for all active sprints of the board when sprintID is 0.
+func (u *Unfurler) BoardBlocks(ctx context.Context, instance *jiraclient.Instance, boardID, sprintID int) ([]slack.Block, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*requestTimeout)
+	defer cancel()
+
+	var sprints []jira.Sprint
+	if sprintID > 0 {
+		req, err := instance.Client.NewRequestWithContext(ctx, "GET", fmt.Sprintf("rest/agile/1.0/sprint/%d", sprintID), nil)
+		if err != nil {
+			return nil, err
+		}
+		sprint := jira.Sprint{}
+		if resp, err := instance.Client.Do(req, &sprint); err != nil {
+			return nil, fmt.Errorf("failed to get sprint %d: %v", sprintID, jira.NewJiraError(resp, err))
+		}
+		sprints = append(sprints, sprint)
+	} else {
+		list, _, err := instance.Client.Board.GetAllSprintsWithOptionsWithContext(ctx, boardID, &jira.GetAllSprintsOptions{State: "active"})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get active sprints of board %d: %v", boardID, err)
+		}
+		sprints = list.Values
+	}
+
+	if len(sprints) == 0 {
+		text := fmt.Sprintf(":runner: <%s|Board %d> has no active sprint.", instance.BoardURL(boardID), boardID)
+		return []slack.Block{slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil)}, nil
+	}
+
+	var blocks []slack.Block
+	for i := range sprints {
+		jql := fmt.Sprintf("sprint = %d", sprints[i].ID)
+		counts, err := countStatuses(ctx, instance, jql)
+		if err != nil {
+			return nil, err
+		}
+		if len(blocks) > 0 {
+			blocks = append(blocks, slack.NewDividerBlock())
+		}
+		blocks = append(blocks, render.Sprint(&sprints[i], instance.SearchURL(jql), counts, u.renderOptions(ctx, instance))...)
+	}
+	return blocks, nil
+}
+
+// epicBlocks renders the epic card with the progress of issues in the epic.
+func (u *Unfurler) epicBlocks(ctx context.Context, instance *jiraclient.Instance, epic *jira.Issue) ([]slack.Block, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*requestTimeout)
+	defer cancel()
+	counts, err := countStatuses(ctx, instance, fmt.Sprintf(`"Epic Link" = %s`, epic.Key))
+	if err != nil {
+		return nil, err
+	}
+	return render.Epic(epic, instance.BrowseURL(epic.Key), counts, u.renderOptions(ctx, instance)), nil
+}
+
+// countStatuses counts issues matching the JQL by their status category.
+func countStatuses(ctx context.Context, instance *jiraclient.Instance, jql string) (render.StatusCounts, error) {
+	counts := render.StatusCounts{}
+	err := instance.Client.Issue.SearchPagesWithContext(ctx, jql, &jira.SearchOptions{MaxResults: 100, Fields: []string{"status"}}, func(issue jira.Issue) error {
+		counts.Add(&issue)
+		if counts.Total() >= progressIssuesLimit {
+			return errLimitReached
+		}
+		return nil
+	})
+	if err != nil && err != errLimitReached {
+		return counts, fmt.Errorf("failed to search %q: %v", jql, err)
+	}
+	return counts, nil
+}
+
+var errLimitReached = fmt.Errorf("limit of %d issues reached", progressIssuesLimit)
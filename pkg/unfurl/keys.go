@@ -0,0 +1,72 @@
+package unfurl
+
+import (
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"regexp"
+	"strings"
+)
+
+var (
+	issueKeyPattern   = regexp.MustCompile(`\b([A-Z][A-Z0-9_]+)-([1-9][0-9]*)\b`)
+	codeBlockPattern  = regexp.MustCompile("(?s)```.*?```")
+	inlineCodePattern = regexp.MustCompile("`[^`\n]*`")
+	// Slack wraps links, user and channel mentions in <...>, keys in there are handled by link_shared or are not keys at all.
+	slackLinkPattern = regexp.MustCompile(`<[^>\n]*>`)
+	// slackURLPattern captures the URL of links in <url> or <url|text> form
+	slackURLPattern = regexp.MustCompile(`<(https?://[^|>\n]+)(?:\|[^>\n]*)?>`)
+)
+
+// IssueKey is an issue key found in a message, with the Jira instance that owns its project.
+type IssueKey struct {
+	Instance *jiraclient.Instance
+	Key      string
+}
+
+// FindIssueKeys returns unique issue keys mentioned in the message text whose project is configured in one of the instances.
+// Keys inside code blocks, inline code and links are ignored.
+func FindIssueKeys(text string, instances jiraclient.Instances) []IssueKey {
+	text = codeBlockPattern.ReplaceAllString(text, " ")
+	text = inlineCodePattern.ReplaceAllString(text, " ")
+	text = slackLinkPattern.ReplaceAllString(text, " ")
+
+	var keys []IssueKey
+	seen := map[string]bool{}
+	for _, match := range issueKeyPattern.FindAllStringSubmatch(text, -1) {
+		key := strings.ToUpper(match[0])
+		if seen[key] {
+			continue
+		}
+		instance := instances.ForProject(match[1])
+		if instance == nil {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, IssueKey{Instance: instance, Key: key})
+	}
+	return keys
+}
+
+// FindIssues returns unique issues mentioned in the message text either by key or by link to the issue (or its comment).
+func FindIssues(text string, instances jiraclient.Instances) []IssueKey {
+	var issues []IssueKey
+	seen := map[string]bool{}
+	for _, match := range slackURLPattern.FindAllStringSubmatch(codeBlockPattern.ReplaceAllString(text, " "), -1) {
+		link := ParseLink(instances, match[1])
+		if link == nil || len(link.IssueKey) == 0 {
+			continue
+		}
+		key := strings.ToUpper(link.IssueKey)
+		if seen[link.Instance.Name+"/"+key] {
+			continue
+		}
+		seen[link.Instance.Name+"/"+key] = true
+		issues = append(issues, IssueKey{Instance: link.Instance, Key: key})
+	}
+	for _, key := range FindIssueKeys(text, instances) {
+		if !seen[key.Instance.Name+"/"+key.Key] {
+			seen[key.Instance.Name+"/"+key.Key] = true
+			issues = append(issues, key)
+		}
+	}
+	return issues
+}
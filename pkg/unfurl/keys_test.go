@@ -0,0 +1,81 @@
+package unfurl
+
+import (
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"reflect"
+	"testing"
+)
+
+func testInstances(t *testing.T) jiraclient.Instances {
+	t.Helper()
+	var instances jiraclient.Instances
+	for name, projects := range map[string][]string{"jira": {"API", "UI"}, "other": {"OPS"}} {
+		instance, err := jiraclient.NewInstance(name, name, "https://"+name+".example.com", "token")
+		if err != nil {
+			t.Fatal(err)
+		}
+		instance.Projects = projects
+		instances = append(instances, instance)
+	}
+	return instances
+}
+
+// keyNames returns the issue keys as "<instance>/<key>".
+func keyNames(keys []IssueKey) []string {
+	var names []string
+	for _, k := range keys {
+		names = append(names, k.Instance.Name+"/"+k.Key)
+	}
+	return names
+}
+
+func TestFindIssueKeys(t *testing.T) {
+	instances := testInstances(t)
+	tests := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{name: "plain keys", text: "see API-1 and OPS-22", expected: []string{"jira/API-1", "other/OPS-22"}},
+		{name: "punctuation", text: "(API-1), UI-2. API-3?", expected: []string{"jira/API-1", "jira/UI-2", "jira/API-3"}},
+		{name: "duplicates", text: "API-1 API-1 API-2 API-1", expected: []string{"jira/API-1", "jira/API-2"}},
+		{name: "unknown project", text: "FOO-1 and API-1", expected: []string{"jira/API-1"}},
+		{name: "lowercase is not a key", text: "api-1"},
+		{name: "zero and leading zeros", text: "API-0 API-01"},
+		{name: "part of a word", text: "XAPI-1 API-1x"},
+		{name: "inline code", text: "run `make API-1` for API-2", expected: []string{"jira/API-2"}},
+		{name: "code block", text: "```\nAPI-1\nUI-1\n``` API-2", expected: []string{"jira/API-2"}},
+		{name: "links", text: "<https://jira.example.com/browse/API-1|API-1> and <https://example.com/UI-1> but OPS-1", expected: []string{"other/OPS-1"}},
+		{name: "mentions and channels", text: "<@U123> in <#C123|API-1>"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if names := keyNames(FindIssueKeys(test.text, instances)); !reflect.DeepEqual(names, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, names)
+			}
+		})
+	}
+}
+
+func TestFindIssues(t *testing.T) {
+	instances := testInstances(t)
+	tests := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{name: "link and key", text: "<https://jira.example.com/browse/API-1> is like API-2", expected: []string{"jira/API-1", "jira/API-2"}},
+		{name: "link with text", text: "<https://other.example.com/browse/OPS-1|the outage>", expected: []string{"other/OPS-1"}},
+		{name: "link and key of the same issue", text: "<https://jira.example.com/browse/API-1|API-1> API-1", expected: []string{"jira/API-1"}},
+		{name: "link to issue of project not recognized as key", text: "<https://jira.example.com/browse/FOO-1>", expected: []string{"jira/FOO-1"}},
+		{name: "link to unknown instance", text: "<https://unknown.example.com/browse/API-1>"},
+		{name: "link in code block", text: "```<https://jira.example.com/browse/API-1>```"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if names := keyNames(FindIssues(test.text, instances)); !reflect.DeepEqual(names, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, names)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package unfurl
+
+import (
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type LinkKind int
+
+const (
+	// IssueLink is a link to a single issue (/browse/API-1299).
+	IssueLink LinkKind = iota
+	// CommentLink is a permalink to an issue comment (/browse/API-1299?focusedCommentId=123).
+	CommentLink
+	// SearchLink is a link to saved filter (/issues/?filter=12345) or JQL search (/issues/?jql=...).
+	SearchLink
+	// BoardLink is a link to an agile board (/secure/RapidBoard.jspa?rapidView=123), optionally focused on a sprint (&sprint=456).
+	BoardLink
+)
+
+// Link is a parsed link pointing to one of the configured Jira instances.
+type Link struct {
+	Kind     LinkKind
+	Instance *jiraclient.Instance
+	// URL is the link as it was shared
+	URL string
+
+	// IssueKey is set for IssueLink and CommentLink
+	IssueKey string
+	// CommentID is set for CommentLink
+	CommentID string
+	// FilterID or JQL is set for SearchLink
+	FilterID int
+	JQL      string
+	// BoardID and optional SprintID are set for BoardLink
+	BoardID  int
+	SprintID int
+}
+
+// ParseLink parses the URL into a Jira link Shodan knows how to unfurl.
+// It returns nil if the URL does not point to a configured instance or is not a supported kind of link.
+func ParseLink(instances jiraclient.Instances, rawURL string) *Link {
+	link := parseLink(instances, rawURL)
+	if link != nil {
+		link.URL = rawURL
+	}
+	return link
+}
+
+func parseLink(instances jiraclient.Instances, rawURL string) *Link {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	instance, path := instances.ForURL(u)
+	if instance == nil {
+		return nil
+	}
+
+	comps := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(comps) == 2 && comps[0] == "browse" && len(comps[1]) > 0:
+		if commentID := commentID(u); len(commentID) > 0 {
+			return &Link{Kind: CommentLink, Instance: instance, IssueKey: comps[1], CommentID: commentID}
+		}
+		return &Link{Kind: IssueLink, Instance: instance, IssueKey: comps[1]}
+	case (len(comps) == 1 && comps[0] == "issues") || path == "secure/IssueNavigator.jspa":
+		query := u.Query()
+		if jql := strings.TrimSpace(query.Get("jql")); len(jql) > 0 {
+			return &Link{Kind: SearchLink, Instance: instance, JQL: jql}
+		}
+		if filterID, err := strconv.Atoi(query.Get("filter")); err == nil && filterID > 0 {
+			return &Link{Kind: SearchLink, Instance: instance, FilterID: filterID}
+		}
+	case path == "secure/RapidBoard.jspa":
+		if boardID, err := strconv.Atoi(u.Query().Get("rapidView")); err == nil && boardID > 0 {
+			sprintID, _ := strconv.Atoi(u.Query().Get("sprint"))
+			return &Link{Kind: BoardLink, Instance: instance, BoardID: boardID, SprintID: sprintID}
+		}
+	default:
+		// newer Jira UI: /jira/software/c/projects/API/boards/123
+		for i := 0; i+1 < len(comps); i++ {
+			if comps[i] != "boards" || comps[0] != "jira" {
+				continue
+			}
+			if boardID, err := strconv.Atoi(comps[i+1]); err == nil && boardID > 0 {
+				sprintID, _ := strconv.Atoi(u.Query().Get("sprint"))
+				return &Link{Kind: BoardLink, Instance: instance, BoardID: boardID, SprintID: sprintID}
+			}
+		}
+	}
+	return nil
+}
+
+// commentID returns the ID of the comment the browse URL is focused on, if any.
+// Jira uses focusedCommentId (older UI) or focusedId query parameters and #comment-<id> fragment.
+func commentID(u *url.URL) string {
+	query := u.Query()
+	for _, id := range []string{query.Get("focusedCommentId"), query.Get("focusedId"), strings.TrimPrefix(u.Fragment, "comment-")} {
+		if _, err := strconv.Atoi(id); err == nil {
+			return id
+		}
+	}
+	return ""
+}
@@ -0,0 +1,191 @@
+package unfurl
+
+import (
+	"context"
+	"fmt"
+	"github.com/mfojtik/shodan/pkg/store"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// unfurledBucket records issue keys already unfurled in threads, keyed by "<channel>/<thread>/<key>".
+	unfurledBucket = "unfurled-keys"
+	// threadMemory is how long we remember which keys were already unfurled in a thread.
+	threadMemory = 24 * time.Hour
+	// settingsBucket stores the channel settings, keyed by channel ID.
+	settingsBucket = "channel-settings"
+)
+
+// ChannelSettings are the unfurl settings changed in the channel, unset settings fall back to the configuration.
+type ChannelSettings struct {
+	IssueKeys *bool `json:"issueKeys,omitempty"`
+}
+
+// MessageListener replies in thread with issue cards for bare issue keys (eg. "see API-1299") mentioned in messages.
+type MessageListener struct {
+	unfurler  *Unfurler
+	botUserID string
+	channels  map[string]bool
+	// store tracks keys already unfurled per thread, so the same card is not repeated (even after restart)
+	store store.Store
+
+	// lock serializes the check and record of unfurled keys
+	lock sync.Mutex
+	// pruned is when old unfurled keys were forgotten last time
+	pruned time.Time
+}
+
+// NewMessageListener returns listener for messages in the opted-in channels.
+// Messages posted by botUserID (Shodan itself) are ignored.
+func NewMessageListener(unfurler *Unfurler, s store.Store, botUserID string, channels []string) *MessageListener {
+	l := &MessageListener{
+		unfurler:  unfurler,
+		botUserID: botUserID,
+		channels:  map[string]bool{},
+		store:     s,
+	}
+	for _, c := range channels {
+		l.channels[c] = true
+	}
+	return l
+}
+
+// HandleMessage unfurls the issue keys found in the message as a reply in its thread.
+func (l *MessageListener) HandleMessage(ev *slackevents.MessageEvent) error {
+	if enabled, err := l.IssueKeysEnabled(ev.Channel); err != nil || !enabled {
+		return err
+	}
+	// ignore edits, deletes, joins and other non-user messages as well as our own
+	if ev.SubType != "" && ev.SubType != "thread_broadcast" {
+		return nil
+	}
+	if len(ev.BotID) > 0 || ev.User == l.botUserID {
+		return nil
+	}
+
+	threadTimeStamp := ev.ThreadTimeStamp
+	if len(threadTimeStamp) == 0 {
+		threadTimeStamp = ev.TimeStamp
+	}
+
+	var keys []IssueKey
+	for _, key := range FindIssueKeys(ev.Text, l.unfurler.instances) {
+		if l.markUnfurled(ev.Channel, threadTimeStamp, key.Key) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.unfurler.deadline)
+	defer cancel()
+	results := l.unfurler.fetchAll(ctx, len(keys), func(ctx context.Context, i int) ([]slack.Block, error) {
+		return l.unfurler.IssueBlocks(ctx, ev.Channel, keys[i].Instance, keys[i].Key)
+	})
+
+	for i, blocks := range results {
+		if blocks == nil {
+			// let the key be unfurled by later message when this one failed
+			l.forget(ev.Channel, threadTimeStamp, keys[i].Key)
+			continue
+		}
+		_, timeStamp, err := l.unfurler.slackClient.PostMessage(ev.Channel,
+			slack.MsgOptionTS(threadTimeStamp),
+			slack.MsgOptionText(keys[i].Key, false),
+			slack.MsgOptionBlocks(blocks...),
+		)
+		if err != nil {
+			// release this and the remaining keys, so a later message unfurls them
+			for _, key := range keys[i:] {
+				l.forget(ev.Channel, threadTimeStamp, key.Key)
+			}
+			return err
+		}
+		l.unfurler.shared(&Shared{
+			Instance:         keys[i].Instance,
+			Key:              keys[i].Key,
+			Channel:          ev.Channel,
+			MessageTimeStamp: timeStamp,
+			ThreadTimeStamp:  threadTimeStamp,
+		})
+	}
+	return nil
+}
+
+// IssueKeysEnabled returns true when bare issue keys are unfurled in the channel.
+func (l *MessageListener) IssueKeysEnabled(channel string) (bool, error) {
+	settings := &ChannelSettings{}
+	if _, err := l.store.Get(settingsBucket, channel, settings); err != nil {
+		return false, err
+	}
+	if settings.IssueKeys != nil {
+		return *settings.IssueKeys, nil
+	}
+	return l.channels[channel], nil
+}
+
+// SetIssueKeys turns unfurling of bare issue keys in the channel on or off, overriding the configuration.
+func (l *MessageListener) SetIssueKeys(channel string, enabled bool) error {
+	settings := &ChannelSettings{}
+	if _, err := l.store.Get(settingsBucket, channel, settings); err != nil {
+		return err
+	}
+	settings.IssueKeys = &enabled
+	return l.store.Put(settingsBucket, channel, settings)
+}
+
+// markUnfurled records the key as unfurled in the thread and returns false if it already was.
+func (l *MessageListener) markUnfurled(channel, threadTimeStamp, key string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.pruned) > time.Hour {
+		if err := store.DeleteOlder(l.store, unfurledBucket, threadMemory); err != nil {
+			log.Printf("failed to prune unfurled keys: %v", err)
+		}
+		l.pruned = now
+	}
+
+	id := channel + "/" + threadTimeStamp + "/" + key
+	var unfurledAt time.Time
+	if ok, err := l.store.Get(unfurledBucket, id, &unfurledAt); err == nil && ok && now.Sub(unfurledAt) < threadMemory {
+		return false
+	}
+	if err := l.store.Put(unfurledBucket, id, now); err != nil {
+		log.Printf("failed to record %s unfurled: %v", key, err)
+	}
+	return true
+}
+
+func (l *MessageListener) forget(channel, threadTimeStamp, key string) {
+	if err := l.store.Delete(unfurledBucket, channel+"/"+threadTimeStamp+"/"+key); err != nil {
+		log.Printf("failed to forget %s unfurled: %v", key, err)
+	}
+}
+
+// GetMessage fetches single message from the channel, including replies in threads.
+func GetMessage(ctx context.Context, slackClient *slack.Client, channel, timeStamp string) (*slack.Message, error) {
+	messages, _, _, err := slackClient.GetConversationRepliesContext(ctx, &slack.GetConversationRepliesParameters{
+		ChannelID: channel,
+		Timestamp: timeStamp,
+		Oldest:    timeStamp,
+		Latest:    timeStamp,
+		Inclusive: true,
+		Limit:     1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message %s in %s: %v", timeStamp, channel, err)
+	}
+	for i := range messages {
+		if messages[i].Timestamp == timeStamp {
+			return &messages[i], nil
+		}
+	}
+	return nil, fmt.Errorf("message %s not found in %s", timeStamp, channel)
+}
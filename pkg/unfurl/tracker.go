@@ -0,0 +1,222 @@
+package unfurl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/store"
+	"github.com/slack-go/slack"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sharedBucket stores issue cards posted to Slack, keyed by "<instance>/<key>/<channel>/<message>".
+	sharedBucket = "shared-cards"
+	// refreshWindow is how long cards are kept up to date, nobody looks at week old messages.
+	refreshWindow = 7 * 24 * time.Hour
+	// maxCardsPerIssue is the number of the most recent cards of a single issue kept up to date.
+	maxCardsPerIssue = 20
+	// refreshWorkers is the number of issues whose cards are refreshed concurrently.
+	refreshWorkers = 4
+	// refreshQueueSize is the number of changed issues waiting for refresh, changes over it are dropped.
+	refreshQueueSize = 1000
+)
+
+// trackedCard is an issue card posted to Slack.
+type trackedCard struct {
+	Channel          string    `json:"channel"`
+	MessageTimeStamp string    `json:"message"`
+	URL              string    `json:"url,omitempty"`
+	SharedAt         time.Time `json:"sharedAt"`
+
+	key string
+}
+
+// changedIssue is an issue waiting for its cards to be refreshed.
+type changedIssue struct {
+	instance *jiraclient.Instance
+	key      string
+}
+
+// Tracker remembers the recently posted issue cards and updates them in place when the issue changes,
+// so the cards don't show stale status or assignee.
+// Cards are refreshed in background by Run, so webhooks and pollers reporting the changes are not slowed down by Slack.
+type Tracker struct {
+	unfurler *Unfurler
+	store    store.Store
+
+	// lock serializes the pruning of cards
+	lock sync.Mutex
+
+	// queue holds the changed issues until Run refreshes them
+	queue chan changedIssue
+	// queuedLock guards queued, the issues in the queue, so an issue changed many times is refreshed once
+	queuedLock sync.Mutex
+	queued     map[string]bool
+}
+
+func NewTracker(unfurler *Unfurler, s store.Store) *Tracker {
+	t := &Tracker{
+		unfurler: unfurler,
+		store:    s,
+		queue:    make(chan changedIssue, refreshQueueSize),
+		queued:   map[string]bool{},
+	}
+	if _, err := t.cards(""); err != nil {
+		log.Printf("failed to prune shared cards: %v", err)
+	}
+	return t
+}
+
+// HandleShared remembers the posted card.
+func (t *Tracker) HandleShared(_ context.Context, shared *Shared) {
+	prefix := cardPrefix(shared.Instance, shared.Key)
+	err := t.store.Put(sharedBucket, prefix+shared.Channel+"/"+shared.MessageTimeStamp, &trackedCard{
+		Channel:          shared.Channel,
+		MessageTimeStamp: shared.MessageTimeStamp,
+		URL:              shared.URL,
+		SharedAt:         time.Now(),
+	})
+	if err == nil {
+		_, err = t.cards(prefix)
+	}
+	if err != nil {
+		log.Printf("failed to track %s card: %v", shared.Key, err)
+	}
+}
+
+// Refresh queues update of all recent cards of the changed issue, the update is done by Run.
+func (t *Tracker) Refresh(_ context.Context, instance *jiraclient.Instance, key string) {
+	t.unfurler.Invalidate(instance, key)
+	prefix := cardPrefix(instance, key)
+	t.queuedLock.Lock()
+	defer t.queuedLock.Unlock()
+	if t.queued[prefix] {
+		return
+	}
+	select {
+	case t.queue <- changedIssue{instance: instance, key: key}:
+		t.queued[prefix] = true
+	default:
+		log.Printf("too many changed issues, not refreshing %s cards", key)
+	}
+}
+
+// Run refreshes the cards of the changed issues, using refreshWorkers concurrent workers, until the context is done.
+func (t *Tracker) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < refreshWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case changed := <-t.queue:
+					// the issue may change again while refreshed, it is queued again then
+					t.queuedLock.Lock()
+					delete(t.queued, cardPrefix(changed.instance, changed.key))
+					t.queuedLock.Unlock()
+
+					refreshCtx, cancel := context.WithTimeout(ctx, time.Minute)
+					t.refreshCards(refreshCtx, changed.instance, changed.key)
+					cancel()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// refreshCards updates all recent cards of the issue: links are unfurled again, cards posted by Shodan are updated.
+// Cards of messages that are gone are forgotten.
+func (t *Tracker) refreshCards(ctx context.Context, instance *jiraclient.Instance, key string) {
+	cards, err := t.cards(cardPrefix(instance, key))
+	if err != nil {
+		log.Printf("failed to get %s cards: %v", key, err)
+		return
+	}
+	for _, card := range cards {
+		if err := t.refresh(ctx, instance, key, card); err != nil {
+			log.Printf("failed to refresh %s card in %s: %v", key, card.Channel, err)
+			if gone(err) {
+				if err := t.store.Delete(sharedBucket, card.key); err != nil {
+					log.Printf("failed to forget %s card: %v", key, err)
+				}
+			}
+		}
+	}
+}
+
+func (t *Tracker) refresh(ctx context.Context, instance *jiraclient.Instance, key string, card *trackedCard) error {
+	if len(card.URL) > 0 {
+		return t.unfurler.Refresh(ctx, card.Channel, card.MessageTimeStamp, card.URL)
+	}
+	blocks, err := t.unfurler.IssueBlocks(ctx, card.Channel, instance, key)
+	if err != nil || len(blocks) == 0 {
+		return err
+	}
+	_, _, _, err = t.unfurler.slackClient.UpdateMessageContext(ctx, card.Channel, card.MessageTimeStamp,
+		slack.MsgOptionText(key, false),
+		slack.MsgOptionBlocks(blocks...),
+	)
+	return err
+}
+
+// cards returns the cards with the key prefix (all cards when empty), newest first.
+// Cards older than refreshWindow and cards over maxCardsPerIssue are removed.
+func (t *Tracker) cards(prefix string) ([]*trackedCard, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var cards, old []*trackedCard
+	err := t.store.ForEach(sharedBucket, func(key string, value json.RawMessage) error {
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		card := &trackedCard{key: key}
+		if err := json.Unmarshal(value, card); err != nil || time.Since(card.SharedAt) > refreshWindow {
+			old = append(old, card)
+			return nil
+		}
+		cards = append(cards, card)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(cards, func(i, j int) bool { return cards[i].SharedAt.After(cards[j].SharedAt) })
+	if len(prefix) > 0 && len(cards) > maxCardsPerIssue {
+		cards, old = cards[:maxCardsPerIssue], append(old, cards[maxCardsPerIssue:]...)
+	}
+	for _, card := range old {
+		if err := t.store.Delete(sharedBucket, card.key); err != nil {
+			return nil, err
+		}
+	}
+	return cards, nil
+}
+
+func cardPrefix(instance *jiraclient.Instance, key string) string {
+	return fmt.Sprintf("%s/%s/", instance.Name, strings.ToUpper(key))
+}
+
+// gone returns true for Slack errors telling the message can't be updated anymore.
+func gone(err error) bool {
+	var slackErr slack.SlackErrorResponse
+	if !errors.As(err, &slackErr) {
+		return false
+	}
+	switch slackErr.Err {
+	case "message_not_found", "channel_not_found", "cant_update_message", "cannot_unfurl_message", "is_archived":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mfojtik/shodan/pkg/config"
+	"github.com/mfojtik/shodan/pkg/identity"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/policy"
+	"github.com/mfojtik/shodan/pkg/store"
+	"github.com/slack-go/slack"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGone(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{err: slack.SlackErrorResponse{Err: "message_not_found"}, expected: true},
+		{err: fmt.Errorf("failed to update: %w", slack.SlackErrorResponse{Err: "is_archived"}), expected: true},
+		{err: slack.SlackErrorResponse{Err: "ratelimited"}},
+		{err: errors.New("message_not_found")},
+	}
+	for _, test := range tests {
+		if actual := gone(test.err); actual != test.expected {
+			t.Errorf("expected gone(%v) %v, got %v", test.err, test.expected, actual)
+		}
+	}
+}
+
+// fakeCards serves the Jira issues and records the cards updated in Slack as "<method> <channel>/<message>".
+// Messages in channel CGONE are deleted already.
+type fakeCards struct {
+	lock    sync.Mutex
+	updated []string
+}
+
+func (f *fakeCards) serveJira(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	path := strings.TrimPrefix(r.URL.Path, "/rest/api/2/")
+	switch {
+	case strings.HasSuffix(path, "/transitions"):
+		w.Write([]byte(`{"transitions": []}`))
+	case strings.HasPrefix(path, "issue/"):
+		key := strings.TrimPrefix(path, "issue/")
+		fmt.Fprintf(w, `{"key": %q, "fields": {"summary": "Issue %s", "project": {"key": "API"}, "status": {"name": "New"}, "issuetype": {"name": "Bug"}}}`, key, key)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeCards) serveSlack(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.FormValue("channel") == "CGONE" {
+		w.Write([]byte(`{"ok": false, "error": "message_not_found"}`))
+		return
+	}
+	f.lock.Lock()
+	f.updated = append(f.updated, strings.TrimPrefix(r.URL.Path, "/")+" "+r.FormValue("channel")+"/"+r.FormValue("ts"))
+	f.lock.Unlock()
+	w.Write([]byte(`{"ok": true, "channel": "C1", "ts": "1.1"}`))
+}
+
+func TestTrackerRefresh(t *testing.T) {
+	f := &fakeCards{}
+	jiraServer := httptest.NewServer(http.HandlerFunc(f.serveJira))
+	defer jiraServer.Close()
+	slackServer := httptest.NewServer(http.HandlerFunc(f.serveSlack))
+	defer slackServer.Close()
+
+	instance, err := jiraclient.NewInstance("jira", "Jira", jiraServer.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slackClient := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.URL+"/"))
+	unfurler := New(jiraclient.Instances{instance}, slackClient, policy.New(nil), identity.NewResolver(slackClient, store.NewMemory()),
+		&config.UnfurlConfig{Workers: 1, Deadline: time.Second}, &config.CacheConfig{})
+	s := store.NewMemory()
+	tracker := NewTracker(unfurler, s)
+
+	ctx := context.Background()
+	for _, shared := range []*Shared{
+		{Instance: instance, Key: "API-1", Channel: "C1", MessageTimeStamp: "1.1"},
+		{Instance: instance, Key: "API-1", Channel: "C2", MessageTimeStamp: "2.2", URL: instance.BrowseURL("API-1")},
+		{Instance: instance, Key: "API-1", Channel: "CGONE", MessageTimeStamp: "3.3"},
+		{Instance: instance, Key: "API-2", Channel: "C1", MessageTimeStamp: "4.4"},
+	} {
+		tracker.HandleShared(ctx, shared)
+	}
+
+	// changes are queued without waiting for Slack, an issue changed repeatedly is refreshed once
+	tracker.Refresh(ctx, instance, "API-1")
+	tracker.Refresh(ctx, instance, "api-1")
+	if len(tracker.queue) != 1 || len(f.updated) != 0 {
+		t.Fatalf("expected single refresh queued and nothing updated, got %d queued and %v updated", len(tracker.queue), f.updated)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		tracker.Run(runCtx)
+		close(done)
+	}()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		tracker.queuedLock.Lock()
+		queued := len(tracker.queued)
+		tracker.queuedLock.Unlock()
+		f.lock.Lock()
+		updated := len(f.updated)
+		f.lock.Unlock()
+		if queued == 0 && updated == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the cards refreshed, got %v", f.updated)
+		}
+	}
+	// the gone card is forgotten after the updates, once its refresh failed
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if cards, err := tracker.cards(cardPrefix(instance, "API-1")); err != nil || len(cards) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the card of deleted message forgotten")
+		}
+	}
+	cancel()
+	<-done
+
+	sort.Strings(f.updated)
+	if expected := []string{"chat.unfurl C2/2.2", "chat.update C1/1.1"}; !reflect.DeepEqual(f.updated, expected) {
+		t.Errorf("expected updated %v, got %v", expected, f.updated)
+	}
+}
@@ -0,0 +1,418 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/cache"
+	"github.com/mfojtik/shodan/pkg/config"
+	"github.com/mfojtik/shodan/pkg/identity"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/markup"
+	"github.com/mfojtik/shodan/pkg/policy"
+	"github.com/mfojtik/shodan/pkg/render"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// requestTimeout bounds every single request to Jira.
+const requestTimeout = 10 * time.Second
+
+// SearchResultsLimit is the number of issues listed when unfurling filter and JQL links.
+const SearchResultsLimit = 10
+
+// ErrIssueNotFound is returned when the issue does not exist or Shodan can't see it.
+var ErrIssueNotFound = errors.New("issue not found")
+
+// Unfurler turns Jira links and issue keys shared in Slack into issue cards.
+type Unfurler struct {
+	instances   jiraclient.Instances
+	slackClient *slack.Client
+	issues      *cache.LRU[*jira.Issue]
+	transitions *cache.LRU[[]jira.Transition]
+	policy      *policy.Policy
+	// identities render Jira users as Slack mentions, when set
+	identities *identity.Resolver
+
+	// workers limits the number of concurrent Jira fetches per message
+	workers int
+	// deadline bounds the time to unfurl all links in a message
+	deadline time.Duration
+
+	// onShared are called for every issue card posted to Slack
+	onShared []func(ctx context.Context, shared *Shared)
+}
+
+// Shared is an issue card posted to Slack, either as link unfurl or as a message posted by Shodan.
+type Shared struct {
+	Instance *jiraclient.Instance
+	Key      string
+	Channel  string
+	// MessageTimeStamp is the message with the card (the unfurled message or the message Shodan posted)
+	MessageTimeStamp string
+	// ThreadTimeStamp is the thread the card is in, the message itself when it is not a reply
+	ThreadTimeStamp string
+	// URL is the unfurled link, empty when the card was posted by Shodan
+	URL string
+}
+
+func New(instances jiraclient.Instances, slackClient *slack.Client, visibility *policy.Policy, identities *identity.Resolver, unfurlConfig *config.UnfurlConfig, cacheConfig *config.CacheConfig) *Unfurler {
+	return &Unfurler{
+		instances:   instances,
+		slackClient: slackClient,
+		policy:      visibility,
+		identities:  identities,
+		workers:     unfurlConfig.Workers,
+		deadline:    unfurlConfig.Deadline,
+		issues: cache.New[*jira.Issue](cacheConfig.Size, cacheConfig.TTL, cacheConfig.NegativeTTL, func(err error) bool {
+			return errors.Is(err, ErrIssueNotFound)
+		}),
+		transitions: cache.New[[]jira.Transition](cacheConfig.Size, transitionsTTL, 0, nil),
+	}
+}
+
+// Invalidate drops the cached issue and its transitions, so the next unfurl fetches them fresh from Jira.
+func (u *Unfurler) Invalidate(instance *jiraclient.Instance, key string) {
+	u.issues.Invalidate(issueCacheKey(instance, key))
+	u.transitions.Invalidate(issueCacheKey(instance, key))
+}
+
+// OnShared registers function called in background whenever an issue card is posted, eg. to link the thread back to Jira.
+func (u *Unfurler) OnShared(fn func(ctx context.Context, shared *Shared)) {
+	u.onShared = append(u.onShared, fn)
+}
+
+func (u *Unfurler) shared(shared *Shared) {
+	for _, fn := range u.onShared {
+		go func(fn func(ctx context.Context, shared *Shared)) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			fn(ctx, shared)
+		}(fn)
+	}
+}
+
+// CacheStats returns the issue cache counters.
+func (u *Unfurler) CacheStats() cache.Stats {
+	return u.issues.Stats()
+}
+
+// HandleLinkShared unfurls all Jira links in the link_shared event.
+// Links are fetched concurrently and the cards resolved before the unfurl deadline are posted, the rest is dropped.
+func (u *Unfurler) HandleLinkShared(ev *slackevents.LinkSharedEvent) error {
+	var (
+		urls  []string
+		links []*Link
+	)
+	seen := map[string]bool{}
+	for _, l := range ev.Links {
+		// links to hosts we don't have configured or we don't understand are ignored
+		link := ParseLink(u.instances, l.URL)
+		if link == nil || seen[l.URL] {
+			continue
+		}
+		seen[l.URL] = true
+		urls = append(urls, l.URL)
+		links = append(links, link)
+	}
+	if len(links) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), u.deadline)
+	defer cancel()
+	results := u.fetchAll(ctx, len(links), func(ctx context.Context, i int) ([]slack.Block, error) {
+		return u.LinkBlocks(ctx, ev.Channel, links[i])
+	})
+
+	unfurls := map[string]slack.Attachment{}
+	for i, blocks := range results {
+		if blocks == nil {
+			continue
+		}
+		unfurls[urls[i]] = slack.Attachment{
+			Blocks: slack.Blocks{BlockSet: blocks},
+		}
+	}
+	if len(unfurls) == 0 {
+		return nil
+	}
+	if _, _, _, err := u.slackClient.UnfurlMessage(ev.Channel, ev.MessageTimeStamp, unfurls); err != nil {
+		return err
+	}
+
+	threadTimeStamp := ev.ThreadTimeStamp
+	if len(threadTimeStamp) == 0 {
+		threadTimeStamp = ev.MessageTimeStamp
+	}
+	for i, link := range links {
+		if results[i] == nil || len(link.IssueKey) == 0 {
+			continue
+		}
+		u.shared(&Shared{
+			Instance:         link.Instance,
+			Key:              strings.ToUpper(link.IssueKey),
+			Channel:          ev.Channel,
+			MessageTimeStamp: ev.MessageTimeStamp,
+			ThreadTimeStamp:  threadTimeStamp,
+			URL:              link.URL,
+		})
+	}
+	return nil
+}
+
+// fetchAll calls fetch for every index in [0,n) using at most u.workers concurrent calls.
+// It returns the blocks in the same order, with nil for the fetches that failed or did not finish before ctx is done.
+func (u *Unfurler) fetchAll(ctx context.Context, n int, fetch func(ctx context.Context, i int) ([]slack.Block, error)) [][]slack.Block {
+	type result struct {
+		index  int
+		blocks []slack.Block
+	}
+	// buffered, so workers finishing after the deadline never block
+	results := make(chan result, n)
+	workers := make(chan struct{}, u.workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			select {
+			case workers <- struct{}{}:
+				defer func() { <-workers }()
+			case <-ctx.Done():
+				return
+			}
+			blocks, err := fetch(ctx, i)
+			if err != nil {
+				log.Printf("failed to unfurl: %v", err)
+				return
+			}
+			results <- result{index: i, blocks: blocks}
+		}(i)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	blocks := make([][]slack.Block, n)
+	for {
+		select {
+		case r, ok := <-results:
+			if !ok {
+				return blocks
+			}
+			blocks[r.index] = r.blocks
+		case <-ctx.Done():
+			log.Printf("unfurl deadline exceeded, returning partial results")
+			return blocks
+		}
+	}
+}
+
+// LinkBlocks renders the card for the parsed link to be posted in the channel.
+// It returns no blocks when the visibility policy does not allow unfurling the link in the channel.
+func (u *Unfurler) LinkBlocks(ctx context.Context, channel string, link *Link) ([]slack.Block, error) {
+	switch link.Kind {
+	case CommentLink:
+		return u.CommentBlocks(ctx, channel, link.Instance, link.IssueKey, link.CommentID)
+	case SearchLink:
+		return u.SearchBlocks(ctx, channel, link.Instance, link.FilterID, link.JQL)
+	case BoardLink:
+		return u.BoardBlocks(ctx, link.Instance, link.BoardID, link.SprintID)
+	default:
+		return u.issueBlocks(ctx, channel, link.Instance, link.IssueKey, link.URL)
+	}
+}
+
+// IssueBlocks fetches the issue from the Jira instance and renders its card with actions.
+// Epics are rendered together with progress of their child issues.
+func (u *Unfurler) IssueBlocks(ctx context.Context, channel string, instance *jiraclient.Instance, key string) ([]slack.Block, error) {
+	return u.issueBlocks(ctx, channel, instance, key, "")
+}
+
+// issueBlocks renders the issue card, the unfurlURL is the link the card unfurls (empty for cards Shodan posts itself).
+func (u *Unfurler) issueBlocks(ctx context.Context, channel string, instance *jiraclient.Instance, key, unfurlURL string) ([]slack.Block, error) {
+	issue, err := u.getIssue(ctx, instance, key)
+	if err != nil {
+		return nil, err
+	}
+	if blocks, restricted := u.restricted(channel, instance, issue); restricted {
+		return blocks, nil
+	}
+	var blocks []slack.Block
+	if issue.Fields.Type.Name == "Epic" {
+		if blocks, err = u.epicBlocks(ctx, instance, issue); err != nil {
+			log.Printf("failed to get progress of epic %s: %v", issue.Key, err)
+		}
+	}
+	if blocks == nil {
+		blocks = render.Issue(issue, instance.BrowseURL(issue.Key), u.renderOptions(ctx, instance))
+	}
+	ref := &IssueRef{Instance: instance.Name, Key: issue.Key, URL: unfurlURL}
+	return append(blocks, u.actionsBlock(ctx, instance, ref)), nil
+}
+
+// UpdateBlocks renders the notification about the issue update to be posted in the channel.
+// The issue comes with the update (eg. in Jira webhook), so it is not fetched.
+// It returns no blocks when the visibility policy does not allow the issue in the channel.
+func (u *Unfurler) UpdateBlocks(ctx context.Context, channel string, instance *jiraclient.Instance, issue *jira.Issue, update *render.Update) []slack.Block {
+	if blocks, restricted := u.restricted(channel, instance, issue); restricted {
+		return blocks
+	}
+	return render.IssueUpdate(issue, instance.BrowseURL(issue.Key), update, u.renderOptions(ctx, instance))
+}
+
+// CommentBlocks fetches the issue comment and renders it together with the issue header.
+func (u *Unfurler) CommentBlocks(ctx context.Context, channel string, instance *jiraclient.Instance, key, commentID string) ([]slack.Block, error) {
+	issue, err := u.getIssue(ctx, instance, key)
+	if err != nil {
+		return nil, err
+	}
+	if blocks, restricted := u.restricted(channel, instance, issue); restricted {
+		return blocks, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := instance.Client.NewRequestWithContext(ctx, "GET", fmt.Sprintf("rest/api/2/issue/%s/comment/%s", issue.Key, commentID), nil)
+	if err != nil {
+		return nil, err
+	}
+	comment := &jira.Comment{}
+	if resp, err := instance.Client.Do(req, comment); err != nil {
+		return nil, fmt.Errorf("failed to get comment %s of %s: %v", commentID, issue.Key, jira.NewJiraError(resp, err))
+	}
+	return render.Comment(issue, comment, instance.BrowseURL(issue.Key), instance.CommentURL(issue.Key, commentID), u.renderOptions(ctx, instance)), nil
+}
+
+// SearchBlocks runs the saved filter (when filterID is set) or the JQL query and renders the top matching issues.
+func (u *Unfurler) SearchBlocks(ctx context.Context, channel string, instance *jiraclient.Instance, filterID int, jql string) ([]slack.Block, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	title, viewAllURL := jql, instance.SearchURL(jql)
+	if filterID > 0 {
+		filter, _, err := instance.Client.Filter.GetWithContext(ctx, filterID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get filter %d: %v", filterID, err)
+		}
+		title, jql, viewAllURL = filter.Name, filter.Jql, instance.FilterURL(filterID)
+	}
+
+	lines, total, err := u.SearchLines(ctx, channel, instance, jql, 0, SearchResultsLimit)
+	if err != nil {
+		return nil, err
+	}
+	return render.SearchResults(title, lines, total, viewAllURL), nil
+}
+
+// SearchLines runs the JQL query and renders one line per issue for issues from startAt up to the limit.
+// Issues the visibility policy does not allow in the channel are redacted or left out (and not counted in total).
+func (u *Unfurler) SearchLines(ctx context.Context, channel string, instance *jiraclient.Instance, jql string, startAt, limit int) ([]string, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	issues, resp, err := instance.Client.Issue.SearchWithContext(ctx, jql, &jira.SearchOptions{
+		StartAt:    startAt,
+		MaxResults: limit,
+		Fields:     []string{"summary", "status", "assignee", "project", "labels", "security"},
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search %q: %v", jql, err)
+	}
+	total := startAt + len(issues)
+	if resp != nil && resp.Total > total {
+		total = resp.Total
+	}
+
+	var lines []string
+	for i := range issues {
+		if line, ok := u.IssueLine(channel, instance, &issues[i]); ok {
+			lines = append(lines, line)
+		} else {
+			total--
+		}
+	}
+	return lines, total, nil
+}
+
+// IssueLine renders the issue as a line of issue list posted in the channel, redacted when the visibility policy says so.
+// It returns false when the issue should not be listed in the channel at all.
+func (u *Unfurler) IssueLine(channel string, instance *jiraclient.Instance, issue *jira.Issue) (string, bool) {
+	switch u.policy.Evaluate(channel, issue) {
+	case policy.Skip:
+		return "", false
+	case policy.Redact:
+		return render.RestrictedIssueLine(issue.Key, instance.BrowseURL(issue.Key)), true
+	default:
+		return render.IssueLine(issue, instance.BrowseURL(issue.Key)), true
+	}
+}
+
+// Visible returns whether the visibility policy allows the issue in the channel, neither skipped nor redacted.
+// Actions triggered from the channel (eg. by reactions) are run only on visible issues, so they don't act on restricted ones.
+func (u *Unfurler) Visible(ctx context.Context, channel string, instance *jiraclient.Instance, key string) (bool, error) {
+	issue, err := u.getIssue(ctx, instance, key)
+	if err != nil {
+		return false, err
+	}
+	_, restricted := u.restricted(channel, instance, issue)
+	return !restricted, nil
+}
+
+func (u *Unfurler) getIssue(ctx context.Context, instance *jiraclient.Instance, key string) (*jira.Issue, error) {
+	return u.issues.Get(issueCacheKey(instance, key), func() (*jira.Issue, error) {
+		ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+		issue, resp, err := instance.Client.Issue.GetWithContext(ctx, key, nil)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%s: %w", key, ErrIssueNotFound)
+		}
+		return issue, err
+	})
+}
+
+// restricted returns true when the visibility policy does not allow showing the issue in the channel,
+// together with blocks to post instead (none when the issue should not be unfurled at all).
+func (u *Unfurler) restricted(channel string, instance *jiraclient.Instance, issue *jira.Issue) ([]slack.Block, bool) {
+	switch u.policy.Evaluate(channel, issue) {
+	case policy.Skip:
+		return nil, true
+	case policy.Redact:
+		return render.Restricted(issue.Key, instance.BrowseURL(issue.Key)), true
+	default:
+		return nil, false
+	}
+}
+
+func issueCacheKey(instance *jiraclient.Instance, key string) string {
+	return instance.Name + "/" + strings.ToUpper(key)
+}
+
+// renderOptions returns options for rendering cards of the instance issues.
+// The instance display name is only shown when there is more than one instance.
+func (u *Unfurler) renderOptions(ctx context.Context, instance *jiraclient.Instance) render.Options {
+	var opts render.Options
+	if len(u.instances) > 1 {
+		opts.Source = instance.DisplayName
+	}
+	if u.identities != nil {
+		mention := u.identities.Mention(ctx, instance)
+		opts.User = mention
+		opts.Markup = &markup.Converter{UserMention: func(username string) string {
+			if s := mention(&jira.User{Name: username}); len(s) > 0 {
+				return s
+			}
+			return "@" + username
+		}}
+	}
+	return opts
+}
@@ -0,0 +1,136 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/mfojtik/shodan/pkg/render"
+	"time"
+)
+
+// ErrIgnored is returned for webhook events Shodan does not notify about (eg. deleted issues or worklogs).
+var ErrIgnored = errors.New("webhook event ignored")
+
+// Kind is the kind of issue change.
+type Kind string
+
+const (
+	Created      Kind = "created"
+	Updated      Kind = "updated"
+	Commented    Kind = "commented"
+	Transitioned Kind = "transitioned"
+)
+
+// ignoredFields are changelog fields not worth a notification.
+var ignoredFields = map[string]bool{
+	"Rank":            true,
+	"RemoteIssueLink": true,
+	"WorklogId":       true,
+	"timeestimate":    true,
+	"timespent":       true,
+}
+
+// Event is the issue change delivered by Jira webhook.
+type Event struct {
+	Kind      Kind
+	Issue     *jira.Issue
+	Actor     *jira.User
+	Comment   *jira.Comment
+	Changes   []render.FieldChange
+	Timestamp time.Time
+
+	// id identifies the delivery, so retried (or doubled) deliveries are notified once
+	id string
+}
+
+// payload is the webhook body as sent by Jira Server and Jira Cloud.
+// See https://developer.atlassian.com/server/jira/platform/webhooks/
+type payload struct {
+	Timestamp          int64         `json:"timestamp"`
+	WebhookEvent       string        `json:"webhookEvent"`
+	IssueEventTypeName string        `json:"issue_event_type_name"`
+	User               *jira.User    `json:"user"`
+	Issue              *jira.Issue   `json:"issue"`
+	Comment            *jira.Comment `json:"comment"`
+	Changelog          *struct {
+		Items []struct {
+			Field      string `json:"field"`
+			FromString string `json:"fromString"`
+			ToString   string `json:"toString"`
+		} `json:"items"`
+	} `json:"changelog"`
+}
+
+// Parse decodes the webhook body. It returns error wrapping ErrIgnored for events that should not be notified.
+func Parse(body []byte) (*Event, error) {
+	p := &payload{}
+	if err := json.Unmarshal(body, p); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %v", err)
+	}
+	if p.Issue == nil || len(p.Issue.Key) == 0 || p.Issue.Fields == nil {
+		return nil, fmt.Errorf("%w: %s without issue", ErrIgnored, p.WebhookEvent)
+	}
+	event := &Event{
+		Issue:     p.Issue,
+		Actor:     p.User,
+		Comment:   p.Comment,
+		Timestamp: time.UnixMilli(p.Timestamp),
+		id:        fmt.Sprintf("%s/%s/%d", p.WebhookEvent, p.Issue.Key, p.Timestamp),
+	}
+	if p.Changelog != nil {
+		for _, item := range p.Changelog.Items {
+			if ignoredFields[item.Field] {
+				continue
+			}
+			event.Changes = append(event.Changes, render.FieldChange{Field: item.Field, From: item.FromString, To: item.ToString})
+		}
+	}
+
+	switch {
+	case p.WebhookEvent == "jira:issue_created":
+		event.Kind, event.Changes = Created, nil
+	case p.WebhookEvent == "comment_created" || (p.WebhookEvent == "jira:issue_updated" && p.IssueEventTypeName == "issue_commented"):
+		if p.Comment == nil {
+			return nil, fmt.Errorf("%w: %s of %s without comment", ErrIgnored, p.WebhookEvent, p.Issue.Key)
+		}
+		// Jira sends both events for a single comment when the webhook subscribes to both
+		event.Kind, event.Changes, event.id = Commented, nil, "comment/"+p.Comment.ID
+		if event.Actor == nil {
+			event.Actor = &p.Comment.Author
+		}
+	case p.WebhookEvent == "jira:issue_updated" && len(event.Changes) > 0:
+		event.Kind = Updated
+		for _, c := range event.Changes {
+			if c.Field == "status" {
+				event.Kind = Transitioned
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s %s of %s", ErrIgnored, p.WebhookEvent, p.IssueEventTypeName, p.Issue.Key)
+	}
+	return event, nil
+}
+
+// Update describes the event for the notification.
+func (e *Event) Update() *render.Update {
+	update := &render.Update{Actor: e.Actor}
+	switch e.Kind {
+	case Created:
+		update.Icon, update.Action = ":new:", "created the issue"
+	case Commented:
+		update.Icon, update.Action, update.Comment = ":speech_balloon:", "commented", e.Comment
+	case Transitioned:
+		update.Icon, update.Action = ":arrow_forward:", "moved the issue"
+		for _, c := range e.Changes {
+			if c.Field == "status" {
+				update.Action = fmt.Sprintf("moved the issue from *%s* to *%s*", render.Escape(c.From), render.Escape(c.To))
+				continue
+			}
+			update.Changes = append(update.Changes, c)
+		}
+	default:
+		update.Icon, update.Action, update.Changes = ":pencil2:", "updated the issue", e.Changes
+	}
+	return update
+}
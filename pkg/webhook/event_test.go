@@ -0,0 +1,98 @@
+package webhook
+
+import (
+	"errors"
+	"github.com/mfojtik/shodan/pkg/render"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	body, err := ioutil.ReadFile(filepath.Join("testdata", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		fixture string
+		kind    Kind
+		actor   string
+		changes []render.FieldChange
+		id      string
+		action  string
+	}{
+		{
+			fixture: "created",
+			kind:    Created,
+			actor:   "alice",
+			id:      "jira:issue_created/API-1/1665000000000",
+			action:  "created the issue",
+		},
+		{
+			fixture: "updated",
+			kind:    Updated,
+			actor:   "bob",
+			changes: []render.FieldChange{{Field: "priority", From: "Minor", To: "Major"}},
+			id:      "jira:issue_updated/API-1/1665000060000",
+			action:  "updated the issue",
+		},
+		{
+			fixture: "commented",
+			kind:    Commented,
+			actor:   "carol",
+			id:      "comment/30001",
+			action:  "commented",
+		},
+		{
+			fixture: "transitioned",
+			kind:    Transitioned,
+			actor:   "bob",
+			changes: []render.FieldChange{{Field: "status", From: "New", To: "In Progress"}, {Field: "assignee", To: "Bob"}},
+			id:      "jira:issue_updated/API-1/1665000180000",
+			action:  "moved the issue from *New* to *In Progress*",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			event, err := Parse(readFixture(t, test.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if event.Kind != test.kind || event.Issue.Key != "API-1" || event.id != test.id {
+				t.Errorf("unexpected event %s %s %s", event.Kind, event.Issue.Key, event.id)
+			}
+			if event.Actor == nil || event.Actor.Name != test.actor {
+				t.Errorf("expected actor %s, got %+v", test.actor, event.Actor)
+			}
+			if !reflect.DeepEqual(event.Changes, test.changes) {
+				t.Errorf("expected changes %+v, got %+v", test.changes, event.Changes)
+			}
+			if action := event.Update().Action; action != test.action {
+				t.Errorf("expected action %q, got %q", test.action, action)
+			}
+		})
+	}
+}
+
+func TestParseIgnored(t *testing.T) {
+	for name, body := range map[string]string{
+		"worklog":              `{"webhookEvent": "worklog_created"}`,
+		"rank only":            `{"webhookEvent": "jira:issue_updated", "issue": {"key": "API-1", "fields": {}}, "changelog": {"items": [{"field": "Rank"}]}}`,
+		"comment without body": `{"webhookEvent": "comment_created", "issue": {"key": "API-1", "fields": {}}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse([]byte(body)); !errors.Is(err, ErrIgnored) {
+				t.Errorf("expected ignored event, got %v", err)
+			}
+		})
+	}
+	if _, err := Parse([]byte("{")); err == nil || errors.Is(err, ErrIgnored) {
+		t.Errorf("expected invalid payload error, got %v", err)
+	}
+}
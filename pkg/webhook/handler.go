@@ -0,0 +1,207 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/store"
+	"github.com/mfojtik/shodan/pkg/subscription"
+	"github.com/mfojtik/shodan/pkg/unfurl"
+	"github.com/slack-go/slack"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxBodySize limits the webhook body, issues with long descriptions and comments come in a few hundred kB.
+	maxBodySize = 10 << 20
+	// deliveredBucket records the notified events, keyed by "<instance>/<event ID>", so redeliveries are not posted again
+	// even when they come after restart.
+	deliveredBucket = "webhook-delivered"
+	// deliveredMemory is how long delivered events are remembered, Jira retries failed deliveries within hours.
+	deliveredMemory = 24 * time.Hour
+)
+
+// Handler receives Jira webhooks and posts the issue changes to the subscribed channels.
+//
+// Requests are authenticated by the shared secret, sent either as bearer token or used to sign the body
+// (Jira Cloud "X-Hub-Signature" header). The secret is never accepted in the URL, as URLs end up in access logs.
+// The instance is the one named by "instance" query parameter, or the one the issue URL points to.
+type Handler struct {
+	instances     jiraclient.Instances
+	slackClient   *slack.Client
+	unfurler      *unfurl.Unfurler
+	subscriptions *subscription.Store
+	store         store.Store
+	secret        string
+
+	// lock serializes the check and record of delivered events, pruned is when old ones were forgotten last time
+	lock   sync.Mutex
+	pruned time.Time
+	// onChanged are called for every changed issue
+	onChanged []func(ctx context.Context, instance *jiraclient.Instance, key string)
+}
+
+func New(instances jiraclient.Instances, slackClient *slack.Client, unfurler *unfurl.Unfurler, subscriptions *subscription.Store, s store.Store, secret string) *Handler {
+	return &Handler{
+		instances:     instances,
+		slackClient:   slackClient,
+		unfurler:      unfurler,
+		subscriptions: subscriptions,
+		store:         s,
+		secret:        secret,
+	}
+}
+
+// OnChanged registers function called whenever an issue changes, eg. to refresh its cards posted earlier.
+func (h *Handler) OnChanged(fn func(ctx context.Context, instance *jiraclient.Instance, key string)) {
+	h.onChanged = append(h.onChanged, fn)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.authenticated(r, body) {
+		log.Printf("rejected unauthenticated jira webhook from %s", r.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	event, err := Parse(body)
+	switch {
+	case errors.Is(err, ErrIgnored):
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	instance := h.instance(r, event)
+	if instance == nil {
+		http.Error(w, fmt.Sprintf("unknown jira instance of %s", event.Issue.Key), http.StatusBadRequest)
+		return
+	}
+
+	// Jira gives up on slow webhooks, notifying all channels happens in background
+	w.WriteHeader(http.StatusAccepted)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := h.Notify(ctx, instance, event); err != nil {
+			log.Printf("failed to notify %s %s: %v", event.Issue.Key, event.Kind, err)
+		}
+	}()
+}
+
+// markDelivered records the event as delivered and returns true if it already was.
+func (h *Handler) markDelivered(id string) (bool, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(h.pruned) > time.Hour {
+		if err := store.DeleteOlder(h.store, deliveredBucket, deliveredMemory); err != nil {
+			log.Printf("failed to prune delivered webhooks: %v", err)
+		}
+		h.pruned = now
+	}
+	delivered := false
+	err := h.store.Batch(func(tx store.Store) error {
+		var deliveredAt time.Time
+		if ok, err := tx.Get(deliveredBucket, id, &deliveredAt); err != nil || ok {
+			delivered = ok
+			return err
+		}
+		return tx.Put(deliveredBucket, id, now)
+	})
+	return delivered, err
+}
+
+// Notify posts the event to every channel subscribed to the issue, once per channel.
+func (h *Handler) Notify(ctx context.Context, instance *jiraclient.Instance, event *Event) error {
+	if delivered, err := h.markDelivered(instance.Name + "/" + event.id); err != nil || delivered {
+		return err
+	}
+	// the issue changed, unfurls should not show the cached one anymore
+	h.unfurler.Invalidate(instance, event.Issue.Key)
+	for _, fn := range h.onChanged {
+		fn(ctx, instance, event.Issue.Key)
+	}
+
+	subs, err := h.subscriptions.List("")
+	if err != nil {
+		return err
+	}
+	notified := map[string]bool{}
+	update := event.Update()
+	for _, sub := range subs {
+		if notified[sub.Channel] {
+			continue
+		}
+		if ok, err := sub.Matches(ctx, instance, event.Issue); err != nil {
+			log.Printf("failed to match subscription %s: %v", sub.ID, err)
+			continue
+		} else if !ok {
+			continue
+		}
+		notified[sub.Channel] = true
+
+		blocks := h.unfurler.UpdateBlocks(ctx, sub.Channel, instance, event.Issue, update)
+		if len(blocks) == 0 {
+			continue
+		}
+		text := fmt.Sprintf("%s %s", event.Issue.Key, event.Kind)
+		if _, _, err := h.slackClient.PostMessageContext(ctx, sub.Channel, slack.MsgOptionText(text, false), slack.MsgOptionBlocks(blocks...)); err != nil {
+			log.Printf("failed to notify %s about %s: %v", sub.Channel, event.Issue.Key, err)
+		}
+	}
+	return nil
+}
+
+// authenticated returns true when the request carries the secret or is signed by it.
+func (h *Handler) authenticated(r *http.Request, body []byte) bool {
+	if signature := r.Header.Get("X-Hub-Signature"); len(signature) > 0 {
+		mac := hmac.New(sha256.New, []byte(h.secret))
+		mac.Write(body)
+		return hmac.Equal([]byte(signature), []byte("sha256="+hex.EncodeToString(mac.Sum(nil))))
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	return len(token) > 0 && subtle.ConstantTimeCompare([]byte(token), []byte(h.secret)) == 1
+}
+
+// instance returns the Jira instance that sent the webhook.
+func (h *Handler) instance(r *http.Request, event *Event) *jiraclient.Instance {
+	if name := r.URL.Query().Get("instance"); len(name) > 0 {
+		return h.instances.ByName(name)
+	}
+	if self, err := url.Parse(event.Issue.Self); err == nil {
+		if instance, _ := h.instances.ForURL(self); instance != nil {
+			return instance
+		}
+	}
+	if len(h.instances) == 1 {
+		return h.instances.Default()
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/mfojtik/shodan/pkg/config"
+	"github.com/mfojtik/shodan/pkg/jiraclient"
+	"github.com/mfojtik/shodan/pkg/policy"
+	"github.com/mfojtik/shodan/pkg/store"
+	"github.com/mfojtik/shodan/pkg/subscription"
+	"github.com/mfojtik/shodan/pkg/unfurl"
+	"github.com/slack-go/slack"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSecret = "s3cret"
+
+// fakeSlack records the channels messages were posted to.
+type fakeSlack struct {
+	lock     sync.Mutex
+	channels []string
+	posted   chan string
+}
+
+func (f *fakeSlack) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	channel := r.FormValue("channel")
+	if r.URL.Path == "/chat.postMessage" {
+		f.lock.Lock()
+		f.channels = append(f.channels, channel)
+		f.lock.Unlock()
+		f.posted <- channel
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok": true, "channel": "` + channel + `", "ts": "1.1"}`))
+}
+
+func (f *fakeSlack) postedChannels() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	channels := append([]string{}, f.channels...)
+	sort.Strings(channels)
+	return channels
+}
+
+// newTestHandler returns handler posting to fake Slack, with the given subscriptions of "jira" and "other" instances.
+func newTestHandler(t *testing.T, subs ...*subscription.Subscription) (*Handler, *fakeSlack) {
+	t.Helper()
+	fake := &fakeSlack{posted: make(chan string, 100)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	slackClient := slack.New("xoxb-test", slack.OptionAPIURL(server.URL+"/"))
+
+	var instances jiraclient.Instances
+	for _, name := range []string{"jira", "other"} {
+		instance, err := jiraclient.NewInstance(name, name, "https://"+name+".example.com", "token")
+		if err != nil {
+			t.Fatal(err)
+		}
+		instances = append(instances, instance)
+	}
+	subscriptions := subscription.NewStore(store.NewMemory())
+	for _, sub := range subs {
+		if err := subscriptions.Add(sub); err != nil {
+			t.Fatal(err)
+		}
+	}
+	unfurler := unfurl.New(instances, slackClient, policy.New(nil), nil, &config.UnfurlConfig{Workers: 1, Deadline: time.Second}, &config.CacheConfig{})
+	return New(instances, slackClient, unfurler, subscriptions, store.NewMemory(), testSecret), fake
+}
+
+func sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestServeHTTPAuthentication(t *testing.T) {
+	body := readFixture(t, "created")
+	tests := []struct {
+		name     string
+		url      string
+		header   map[string]string
+		expected int
+	}{
+		{name: "no secret", url: "/webhooks/jira", expected: http.StatusUnauthorized},
+		{name: "secret in query", url: "/webhooks/jira?secret=" + testSecret, expected: http.StatusUnauthorized},
+		{name: "wrong bearer", url: "/webhooks/jira", header: map[string]string{"Authorization": "Bearer nope"}, expected: http.StatusUnauthorized},
+		{name: "bearer", url: "/webhooks/jira", header: map[string]string{"Authorization": "Bearer " + testSecret}, expected: http.StatusAccepted},
+		{name: "wrong signature", url: "/webhooks/jira", header: map[string]string{"X-Hub-Signature": sign(body, "nope")}, expected: http.StatusUnauthorized},
+		{name: "signature", url: "/webhooks/jira", header: map[string]string{"X-Hub-Signature": sign(body, testSecret)}, expected: http.StatusAccepted},
+		{
+			name:     "wrong signature with bearer",
+			url:      "/webhooks/jira",
+			header:   map[string]string{"X-Hub-Signature": sign(body, "nope"), "Authorization": "Bearer " + testSecret},
+			expected: http.StatusUnauthorized,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler, _ := newTestHandler(t)
+			req := httptest.NewRequest(http.MethodPost, test.url, bytes.NewReader(body))
+			for k, v := range test.header {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != test.expected {
+				t.Errorf("expected %d, got %d", test.expected, w.Code)
+			}
+		})
+	}
+}
+
+func TestServeHTTPRequests(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		expected int
+	}{
+		{name: "get", method: http.MethodGet, url: "/webhooks/jira", expected: http.StatusMethodNotAllowed},
+		{name: "ignored event", method: http.MethodPost, url: "/webhooks/jira", body: `{"webhookEvent": "worklog_created"}`, expected: http.StatusNoContent},
+		{name: "invalid body", method: http.MethodPost, url: "/webhooks/jira", body: `{`, expected: http.StatusBadRequest},
+		{name: "unknown instance", method: http.MethodPost, url: "/webhooks/jira?instance=nope", body: string(readFixture(t, "created")), expected: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler, _ := newTestHandler(t)
+			req := httptest.NewRequest(test.method, test.url, bytes.NewReader([]byte(test.body)))
+			req.Header.Set("Authorization", "Bearer "+testSecret)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != test.expected {
+				t.Errorf("expected %d, got %d", test.expected, w.Code)
+			}
+		})
+	}
+}
+
+func TestServeHTTPNotifies(t *testing.T) {
+	handler, fake := newTestHandler(t, &subscription.Subscription{Instance: "jira", Channel: "C1", Kind: subscription.Project, Value: "API"})
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/jira", bytes.NewReader(readFixture(t, "commented")))
+	req.Header.Set("Authorization", "Bearer "+testSecret)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	select {
+	case channel := <-fake.posted:
+		if channel != "C1" {
+			t.Errorf("expected notification in C1, got %s", channel)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification posted")
+	}
+}
+
+func TestNotifyRouting(t *testing.T) {
+	handler, fake := newTestHandler(t,
+		&subscription.Subscription{Instance: "jira", Channel: "C1", Kind: subscription.Project, Value: "api"},
+		&subscription.Subscription{Instance: "jira", Channel: "C1", Kind: subscription.Issue, Value: "API-1"},
+		&subscription.Subscription{Instance: "jira", Channel: "C2", Kind: subscription.Issue, Value: "API-1"},
+		&subscription.Subscription{Instance: "jira", Channel: "C3", Kind: subscription.Issue, Value: "API-2"},
+		&subscription.Subscription{Instance: "jira", Channel: "C4", Kind: subscription.Project, Value: "WEB"},
+		&subscription.Subscription{Instance: "other", Channel: "C5", Kind: subscription.Project, Value: "API"},
+	)
+	event, err := Parse(readFixture(t, "transitioned"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.Notify(context.Background(), handler.instances.ByName("jira"), event); err != nil {
+		t.Fatal(err)
+	}
+	if channels := fake.postedChannels(); len(channels) != 2 || channels[0] != "C1" || channels[1] != "C2" {
+		t.Errorf("expected notifications in C1 and C2, got %v", channels)
+	}
+}
+
+func TestNotifyDedupe(t *testing.T) {
+	handler, fake := newTestHandler(t, &subscription.Subscription{Instance: "jira", Channel: "C1", Kind: subscription.Issue, Value: "API-1"})
+	instance := handler.instances.ByName("jira")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// every delivery is parsed separately, as the webhook retries are
+			event, err := Parse(readFixture(t, "updated"))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if err := handler.Notify(context.Background(), instance, event); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if channels := fake.postedChannels(); len(channels) != 1 {
+		t.Errorf("expected single notification, got %v", channels)
+	}
+
+	// delivered events are remembered in the store, so they are not posted again after restart
+	restarted := New(handler.instances, handler.slackClient, handler.unfurler, handler.subscriptions, handler.store, testSecret)
+	event, err := Parse(readFixture(t, "updated"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.Notify(context.Background(), instance, event); err != nil {
+		t.Fatal(err)
+	}
+	if channels := fake.postedChannels(); len(channels) != 1 {
+		t.Errorf("expected redelivery after restart not posted, got %v", channels)
+	}
+}